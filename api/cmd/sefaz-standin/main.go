@@ -0,0 +1,57 @@
+// Command sefaz-standin serves saved NFC-e consultation pages so QR code
+// imports can be exercised offline. Point the API at it with
+// NFCE_PORTAL_URL=http://localhost:8099.
+//
+// For a request with ?p=<access key>|..., it serves <dir>/<access key>.html if
+// present, otherwise <dir>/<uf>.html for the state encoded in the key.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"buybuddy-api/nfce"
+)
+
+func main() {
+	addr := flag.String("addr", ":8099", "listen address")
+	dir := flag.String("dir", "nfce/testdata", "directory with fixture pages")
+	flag.Parse()
+
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		payload := r.URL.Query().Get("p")
+		if payload == "" {
+			payload = r.URL.Query().Get("chNFe")
+		}
+
+		qr, err := nfce.ParseQRCode(payload)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		candidates := []string{
+			filepath.Join(*dir, qr.AccessKey.Key+".html"),
+			filepath.Join(*dir, strings.ToLower(qr.AccessKey.State)+".html"),
+		}
+		for _, path := range candidates {
+			page, err := os.ReadFile(path)
+			if err != nil {
+				continue
+			}
+			log.Printf("%s %s -> %s", r.Method, r.URL.Path, path)
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write(page)
+			return
+		}
+
+		http.NotFound(w, r)
+	})
+
+	log.Printf("SEFAZ stand-in serving %s on %s", *dir, *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
@@ -3,17 +3,31 @@ package config
 import (
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type Config struct {
 	Port           string
 	JWTSecret      string
 	GoogleClientID string
-	GeminiAPIKey   string
 	Environment    string
 	CORSOrigins    []string
+	NFCePortalURL  string
 	Database       DatabaseConfig
+	Storage        StorageConfig
+	ReceiptJobs    JobsConfig
+	LLM            LLMConfig
+
+	// LegacyReceiptList keeps GET /api/receipts returning every receipt as a
+	// plain array when no paging or filter parameter is given.
+	LegacyReceiptList bool
+
+	// TrashRetentionDays is how long deleted receipts stay in the trash
+	// before they are purged for good, and how long the originals of an
+	// upload are kept without being saved as a receipt.
+	TrashRetentionDays int
 }
 
 type DatabaseConfig struct {
@@ -25,6 +39,51 @@ type DatabaseConfig struct {
 	SSLMode  string
 }
 
+type StorageConfig struct {
+	Driver    string
+	LocalPath string
+	S3        S3Config
+}
+
+type S3Config struct {
+	Endpoint     string
+	Region       string
+	Bucket       string
+	AccessKey    string
+	SecretKey    string
+	UsePathStyle bool
+}
+
+// LLMConfig picks the model providers. Gemini models keep their own IDs;
+// models of the OpenAI-compatible server are listed as "openai:<model>".
+type LLMConfig struct {
+	// Providers lists the enabled providers: "gemini", "openai" and "fake".
+	Providers    []string
+	GeminiAPIKey string
+	OpenAI       OpenAIConfig
+
+	// ReceiptModel, AssistantModel and IntentModel are the default model
+	// IDs. Empty picks the first model of the first provider, and the
+	// assistant model for intents.
+	ReceiptModel   string
+	AssistantModel string
+	IntentModel    string
+}
+
+// OpenAIConfig points at an OpenAI-compatible server, such as OpenAI,
+// Ollama or vLLM, and lists the models to offer from it.
+type OpenAIConfig struct {
+	BaseURL         string
+	APIKey          string
+	ReceiptModels   []string
+	AssistantModels []string
+}
+
+type JobsConfig struct {
+	Workers     int
+	MaxAttempts int
+}
+
 func (d DatabaseConfig) ConnectionString() string {
 	return fmt.Sprintf(
 		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
@@ -32,14 +91,19 @@ func (d DatabaseConfig) ConnectionString() string {
 	)
 }
 
+// TrashRetention is TrashRetentionDays as a duration.
+func (c *Config) TrashRetention() time.Duration {
+	return time.Duration(c.TrashRetentionDays) * 24 * time.Hour
+}
+
 func Load() *Config {
 	return &Config{
 		Port:           getEnv("PORT", "38763"),
 		JWTSecret:      getEnv("JWT_SECRET", "dev-secret-key-change-in-production"),
 		GoogleClientID: getEnv("GOOGLE_CLIENT_ID", ""),
-		GeminiAPIKey:   getEnv("GEMINI_API_KEY", ""),
 		Environment:    getEnv("ENV", "development"),
 		CORSOrigins:    parseOrigins(getEnv("CORS_ORIGINS", "*")),
+		NFCePortalURL:  getEnv("NFCE_PORTAL_URL", ""),
 		Database: DatabaseConfig{
 			Host:     getEnv("DB_HOST", "localhost"),
 			Port:     getEnv("DB_PORT", "5432"),
@@ -48,6 +112,37 @@ func Load() *Config {
 			Password: getEnv("DB_PASSWORD", "postgres"),
 			SSLMode:  getEnv("DB_SSLMODE", "disable"),
 		},
+		Storage: StorageConfig{
+			Driver:    getEnv("STORAGE_DRIVER", "local"),
+			LocalPath: getEnv("STORAGE_LOCAL_PATH", "data"),
+			S3: S3Config{
+				Endpoint:     getEnv("S3_ENDPOINT", ""),
+				Region:       getEnv("S3_REGION", "us-east-1"),
+				Bucket:       getEnv("S3_BUCKET", ""),
+				AccessKey:    getEnv("S3_ACCESS_KEY", ""),
+				SecretKey:    getEnv("S3_SECRET_KEY", ""),
+				UsePathStyle: getEnv("S3_USE_PATH_STYLE", "true") == "true",
+			},
+		},
+		ReceiptJobs: JobsConfig{
+			Workers:     getEnvInt("RECEIPT_JOB_WORKERS", 2),
+			MaxAttempts: getEnvInt("RECEIPT_JOB_MAX_ATTEMPTS", 3),
+		},
+		LLM: LLMConfig{
+			Providers:    parseList(getEnv("LLM_PROVIDERS", "gemini")),
+			GeminiAPIKey: getEnv("GEMINI_API_KEY", ""),
+			OpenAI: OpenAIConfig{
+				BaseURL:         getEnv("OPENAI_BASE_URL", "https://api.openai.com/v1"),
+				APIKey:          getEnv("OPENAI_API_KEY", ""),
+				ReceiptModels:   parseList(getEnv("OPENAI_RECEIPT_MODELS", "")),
+				AssistantModels: parseList(getEnv("OPENAI_ASSISTANT_MODELS", "")),
+			},
+			ReceiptModel:   getEnv("LLM_RECEIPT_MODEL", ""),
+			AssistantModel: getEnv("LLM_ASSISTANT_MODEL", ""),
+			IntentModel:    getEnv("LLM_INTENT_MODEL", ""),
+		},
+		LegacyReceiptList:  getEnv("LEGACY_RECEIPT_LIST", "true") == "true",
+		TrashRetentionDays: getEnvInt("TRASH_RETENTION_DAYS", 30),
 	}
 }
 
@@ -58,9 +153,27 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+func getEnvInt(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil && value > 0 {
+		return value
+	}
+	return defaultValue
+}
+
 func parseOrigins(origins string) []string {
 	if origins == "*" {
 		return []string{"*"}
 	}
 	return strings.Split(origins, ",")
 }
+
+// parseList splits a comma-separated setting, dropping empty entries.
+func parseList(value string) []string {
+	var list []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
@@ -0,0 +1,22 @@
+package database
+
+// receiptSetup makes an access key unique per user among receipts that are
+// not in the trash, in place of the global index AutoMigrate used to create,
+// so a deleted receipt can be imported again and two users can save the same
+// shared receipt.
+var receiptSetup = []string{
+	`DROP INDEX IF EXISTS idx_receipts_access_key`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS idx_receipts_user_access_key ON receipts (user_id, access_key)
+		WHERE deleted_at IS NULL AND access_key <> ''`,
+}
+
+// SetupReceipts creates the receipt indexes AutoMigrate can't express. Run it
+// after Migrate.
+func SetupReceipts() error {
+	for _, statement := range receiptSetup {
+		if err := DB.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
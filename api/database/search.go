@@ -0,0 +1,44 @@
+package database
+
+// searchSetup creates what item search needs on top of the tables
+// AutoMigrate builds: the unaccent and pg_trgm extensions, a Portuguese text
+// search configuration that ignores accents, a generated tsvector on
+// receipt_items and GIN indexes for full-text and trigram matching. Every
+// statement is idempotent.
+var searchSetup = []string{
+	`CREATE EXTENSION IF NOT EXISTS unaccent`,
+	`CREATE EXTENSION IF NOT EXISTS pg_trgm`,
+	// unaccent() is only STABLE, which indexes don't accept; the dictionary
+	// is fixed here, so it is safe to declare immutable.
+	`CREATE OR REPLACE FUNCTION immutable_unaccent(text) RETURNS text
+		LANGUAGE sql IMMUTABLE PARALLEL SAFE STRICT
+		AS $$ SELECT public.unaccent('public.unaccent', $1) $$`,
+	`DO $$ BEGIN
+		IF NOT EXISTS (SELECT 1 FROM pg_ts_config WHERE cfgname = 'portuguese_unaccent') THEN
+			CREATE TEXT SEARCH CONFIGURATION portuguese_unaccent (COPY = portuguese);
+			ALTER TEXT SEARCH CONFIGURATION portuguese_unaccent
+				ALTER MAPPING FOR hword, hword_part, word WITH unaccent, portuguese_stem;
+		END IF;
+	END $$`,
+	`ALTER TABLE receipt_items ADD COLUMN IF NOT EXISTS search_vector tsvector
+		GENERATED ALWAYS AS (
+			setweight(to_tsvector('portuguese_unaccent', coalesce(name, '')), 'A') ||
+			setweight(to_tsvector('portuguese_unaccent', coalesce(brand, '')), 'B') ||
+			setweight(to_tsvector('portuguese_unaccent', coalesce(raw_name, '')), 'C')
+		) STORED`,
+	`CREATE INDEX IF NOT EXISTS idx_receipt_items_search ON receipt_items USING GIN (search_vector)`,
+	`CREATE INDEX IF NOT EXISTS idx_receipt_items_search_trgm ON receipt_items
+		USING GIN (immutable_unaccent(lower(name || ' ' || raw_name || ' ' || coalesce(brand, ''))) gin_trgm_ops)`,
+	`CREATE INDEX IF NOT EXISTS idx_products_name_trgm ON products
+		USING GIN (immutable_unaccent(lower(name)) gin_trgm_ops)`,
+}
+
+// SetupSearch prepares the database for item search. Run it after Migrate.
+func SetupSearch() error {
+	for _, statement := range searchSetup {
+		if err := DB.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+// Package export writes receipt items, one row at a time, as CSV, JSON or
+// plain-text accounting journals for hledger/ledger and beancount.
+package export
+
+import (
+	"buybuddy-api/models"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Writer writes export rows as they are read. Rows of a receipt must be
+// consecutive. Close finishes the output but does not close the underlying
+// writer.
+type Writer interface {
+	Write(row *models.ExportRow) error
+	Close() error
+}
+
+type format struct {
+	contentType string
+	extension   string
+}
+
+var formats = map[string]format{
+	models.ExportCSV:       {"text/csv; charset=utf-8", "csv"},
+	models.ExportJSON:      {"application/json", "json"},
+	models.ExportLedger:    {"text/plain; charset=utf-8", "journal"},
+	models.ExportBeancount: {"text/plain; charset=utf-8", "beancount"},
+}
+
+// IsFormat reports whether name is one of the models.Export* formats.
+func IsFormat(name string) bool {
+	_, ok := formats[name]
+	return ok
+}
+
+// ContentType is the MIME type of a format's output.
+func ContentType(name string) string {
+	return formats[name].contentType
+}
+
+// Extension is the file extension for a format, without the dot.
+func Extension(name string) string {
+	return formats[name].extension
+}
+
+// NewWriter returns a writer of the named format. accounts only applies to
+// the ledger formats and may be nil.
+func NewWriter(name string, w io.Writer, accounts *models.ExportAccounts) (Writer, error) {
+	switch name {
+	case models.ExportCSV:
+		return newCSVWriter(w)
+	case models.ExportJSON:
+		return &jsonWriter{w: w}, nil
+	case models.ExportLedger:
+		return newJournalWriter(w, accounts, ledgerSyntax), nil
+	case models.ExportBeancount:
+		return newJournalWriter(w, accounts, beancountSyntax), nil
+	default:
+		return nil, fmt.Errorf("unknown export format %q", name)
+	}
+}
+
+var csvHeader = []string{
+	"receipt_id", "date", "store", "store_cnpj", "access_key", "payment_method",
+	"item_id", "name", "raw_name", "brand", "barcode", "category", "subcategory",
+	"quantity", "unit", "unit_price", "discount", "total_price",
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer) (*csvWriter, error) {
+	writer := &csvWriter{w: csv.NewWriter(w)}
+	if err := writer.w.Write(csvHeader); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+func (c *csvWriter) Write(row *models.ExportRow) error {
+	return c.w.Write([]string{
+		row.ReceiptID,
+		row.Date.Format("2006-01-02"),
+		row.Store,
+		row.StoreCNPJ,
+		row.AccessKey,
+		row.PaymentMethod,
+		strconv.FormatUint(uint64(row.ItemID), 10),
+		row.Name,
+		row.RawName,
+		row.Brand,
+		row.Barcode,
+		row.Category,
+		row.Subcategory,
+		strconv.FormatFloat(row.Quantity, 'f', -1, 64),
+		row.Unit,
+		formatMoney(row.UnitPrice),
+		formatMoney(row.Discount),
+		formatMoney(row.TotalPrice),
+	})
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// jsonWriter writes a JSON array of rows without holding them in memory.
+type jsonWriter struct {
+	w     io.Writer
+	count int
+}
+
+func (j *jsonWriter) Write(row *models.ExportRow) error {
+	separator := ",\n"
+	if j.count == 0 {
+		separator = "[\n"
+	}
+	data, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+	j.count++
+	if _, err := io.WriteString(j.w, separator); err != nil {
+		return err
+	}
+	_, err = j.w.Write(data)
+	return err
+}
+
+func (j *jsonWriter) Close() error {
+	end := "\n]\n"
+	if j.count == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(j.w, end)
+	return err
+}
+
+func formatMoney(value float64) string {
+	return strconv.FormatFloat(value, 'f', 2, 64)
+}
@@ -0,0 +1,277 @@
+package export
+
+import (
+	"buybuddy-api/models"
+	"buybuddy-api/normalize"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	currency = "BRL"
+	// accountWidth aligns the amounts of postings with shorter accounts.
+	accountWidth = 48
+
+	uncategorizedAccount = "Expenses:Uncategorized"
+	discountAccount      = "Income:Discounts"
+	checkingAccount      = "Assets:Checking"
+)
+
+// defaultPaymentAccounts pays receipts by payment method when the user
+// mapped no account.
+var defaultPaymentAccounts = map[string]string{
+	models.PaymentCredit:  "Liabilities:CreditCard",
+	models.PaymentDebit:   checkingAccount,
+	models.PaymentPIX:     checkingAccount,
+	models.PaymentCash:    "Assets:Cash",
+	models.PaymentVoucher: "Assets:MealVoucher",
+}
+
+type syntax int
+
+const (
+	ledgerSyntax syntax = iota
+	beancountSyntax
+)
+
+type posting struct {
+	account string
+	amount  float64
+	comment string
+}
+
+// journalWriter writes one transaction per receipt: a posting per item to
+// its category's expense account, one for the part of the receipt discount
+// the items don't already carry, and the balance to the payment account.
+type journalWriter struct {
+	w        io.Writer
+	syntax   syntax
+	accounts accountMap
+	receipt  *models.ExportRow
+	postings []posting
+	opened   map[string]bool
+	// itemDiscounts is the part of the receipt discount already in the
+	// item postings: item discounts and discount lines.
+	itemDiscounts float64
+}
+
+func newJournalWriter(w io.Writer, accounts *models.ExportAccounts, syntax syntax) *journalWriter {
+	return &journalWriter{
+		w:        w,
+		syntax:   syntax,
+		accounts: newAccountMap(accounts),
+		opened:   make(map[string]bool),
+	}
+}
+
+func (j *journalWriter) Write(row *models.ExportRow) error {
+	if j.receipt != nil && j.receipt.ReceiptID != row.ReceiptID {
+		if err := j.flush(); err != nil {
+			return err
+		}
+	}
+	if j.receipt == nil {
+		receipt := *row
+		j.receipt = &receipt
+	}
+
+	if row.TotalPrice < 0 {
+		j.itemDiscounts -= row.TotalPrice
+	} else {
+		j.itemDiscounts += row.Discount
+	}
+	j.postings = append(j.postings, posting{
+		account: j.accounts.category(row.Category, row.Subcategory),
+		amount:  row.TotalPrice,
+		comment: itemComment(row),
+	})
+	return nil
+}
+
+func (j *journalWriter) Close() error {
+	if j.receipt == nil {
+		return nil
+	}
+	return j.flush()
+}
+
+func (j *journalWriter) flush() error {
+	receipt := j.receipt
+	if discount := math.Round((receipt.ReceiptDiscount-j.itemDiscounts)*100) / 100; discount > 0 {
+		j.postings = append(j.postings, posting{account: j.accounts.discount, amount: -discount})
+	}
+	payment := j.accounts.payment(receipt.PaymentMethod)
+	date := receipt.Date.Format("2006-01-02")
+
+	var b strings.Builder
+	if j.syntax == beancountSyntax {
+		for _, account := range append(postingAccounts(j.postings), payment) {
+			account = beancountAccount(account)
+			if !j.opened[account] {
+				j.opened[account] = true
+				fmt.Fprintf(&b, "%s open %s\n", date, account)
+			}
+		}
+		fmt.Fprintf(&b, "%s * %s \"\"\n", date, quote(receipt.Store))
+		fmt.Fprintf(&b, "  receipt: %s\n", quote(receipt.ReceiptID))
+		for _, p := range j.postings {
+			writePosting(&b, "  ", beancountAccount(p.account), p)
+		}
+		fmt.Fprintf(&b, "  %s\n\n", beancountAccount(payment))
+	} else {
+		fmt.Fprintf(&b, "%s * %s\n", date, oneLine(receipt.Store))
+		fmt.Fprintf(&b, "    ; receipt: %s\n", receipt.ReceiptID)
+		for _, p := range j.postings {
+			writePosting(&b, "    ", p.account, p)
+		}
+		fmt.Fprintf(&b, "    %s\n\n", payment)
+	}
+
+	j.receipt = nil
+	j.postings = j.postings[:0]
+	j.itemDiscounts = 0
+	_, err := io.WriteString(j.w, b.String())
+	return err
+}
+
+func writePosting(b *strings.Builder, indent, account string, p posting) {
+	fmt.Fprintf(b, "%s%-*s  %10s %s", indent, accountWidth, account, formatMoney(p.amount), currency)
+	if p.comment != "" {
+		fmt.Fprintf(b, "  ; %s", p.comment)
+	}
+	b.WriteString("\n")
+}
+
+func postingAccounts(postings []posting) []string {
+	accounts := make([]string, 0, len(postings))
+	for _, p := range postings {
+		accounts = append(accounts, p.account)
+	}
+	return accounts
+}
+
+// itemComment describes the item of a posting: "Arroz Tio João" or
+// "Banana Prata 1.235 kg @ 6.99".
+func itemComment(row *models.ExportRow) string {
+	comment := oneLine(row.Name)
+	if row.Quantity != 1 || !strings.EqualFold(row.Unit, "un") {
+		comment += fmt.Sprintf(" %s %s @ %s", strconv.FormatFloat(row.Quantity, 'f', -1, 64), oneLine(row.Unit), formatMoney(row.UnitPrice))
+	}
+	return comment
+}
+
+// accountMap resolves the accounts of a user's export, matching category
+// names without regard to case or accents.
+type accountMap struct {
+	categories map[string]string
+	payments   map[string]string
+	discount   string
+}
+
+func newAccountMap(accounts *models.ExportAccounts) accountMap {
+	m := accountMap{
+		categories: make(map[string]string),
+		payments:   make(map[string]string),
+		discount:   discountAccount,
+	}
+	for method, account := range defaultPaymentAccounts {
+		m.payments[method] = account
+	}
+	if accounts == nil {
+		return m
+	}
+
+	for name, account := range accounts.Categories {
+		if account = ledgerAccount(account); account != "" {
+			m.categories[normalize.Key(name)] = account
+		}
+	}
+	for method, account := range accounts.Payments {
+		if account = ledgerAccount(account); account != "" {
+			m.payments[method] = account
+		}
+	}
+	if account := ledgerAccount(accounts.Discount); account != "" {
+		m.discount = account
+	}
+	return m
+}
+
+// category maps "Category:Subcategory", then "Category", and otherwise
+// defaults to Expenses:Category:Subcategory.
+func (m accountMap) category(category, subcategory string) string {
+	if category == "" {
+		return uncategorizedAccount
+	}
+	if subcategory != "" {
+		if account, ok := m.categories[normalize.Key(category+":"+subcategory)]; ok {
+			return account
+		}
+	}
+	if account, ok := m.categories[normalize.Key(category)]; ok {
+		return account
+	}
+
+	account := "Expenses:" + accountComponent(category)
+	if subcategory != "" {
+		account += ":" + accountComponent(subcategory)
+	}
+	return account
+}
+
+func (m accountMap) payment(method string) string {
+	if account, ok := m.payments[method]; ok {
+		return account
+	}
+	return checkingAccount
+}
+
+// ledgerAccount tidies a configured account name: ledger ends an account at
+// two spaces, so runs of whitespace become one.
+func ledgerAccount(account string) string {
+	components := strings.Split(account, ":")
+	for i, component := range components {
+		components[i] = strings.Join(strings.Fields(component), " ")
+	}
+	return strings.Trim(strings.Join(components, ":"), ":")
+}
+
+// accountComponent turns a category name into one account component.
+func accountComponent(name string) string {
+	return strings.Join(strings.Fields(strings.ReplaceAll(name, ":", " ")), " ")
+}
+
+// beancountAccount rewrites an account to beancount's stricter syntax, where
+// components are ASCII letters and digits starting with a capital:
+// "Expenses:Alimentação:Frutas e verduras" becomes
+// "Expenses:Alimentacao:FrutasEVerduras".
+func beancountAccount(account string) string {
+	components := strings.Split(account, ":")
+	for i, component := range components {
+		words := strings.FieldsFunc(normalize.RemoveAccents(component), func(r rune) bool {
+			return r > unicode.MaxASCII || !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		var b strings.Builder
+		for _, word := range words {
+			b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+		}
+		components[i] = b.String()
+		if components[i] == "" {
+			components[i] = "Other"
+		}
+	}
+	return strings.Join(components, ":")
+}
+
+func quote(value string) string {
+	value = strings.ReplaceAll(oneLine(value), `\`, `\\`)
+	return `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+}
+
+func oneLine(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
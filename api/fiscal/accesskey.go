@@ -0,0 +1,161 @@
+package fiscal
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const AccessKeyLength = 44
+
+const (
+	ModelNFe  = "55"
+	ModelNFCe = "65"
+)
+
+var (
+	ErrInvalidLength     = errors.New("access key must have 44 digits")
+	ErrInvalidCharacters = errors.New("access key must contain only digits")
+	ErrInvalidCheckDigit = errors.New("access key check digit does not match")
+	ErrUnknownState      = errors.New("access key has an unknown state code")
+	ErrInvalidModel      = errors.New("access key model must be 55 (NF-e) or 65 (NFC-e)")
+	ErrInvalidMonth      = errors.New("access key has an invalid emission month")
+)
+
+// stateCodes maps the IBGE numeric code used in the key to the UF abbreviation.
+var stateCodes = map[string]string{
+	"11": "RO", "12": "AC", "13": "AM", "14": "RR", "15": "PA", "16": "AP", "17": "TO",
+	"21": "MA", "22": "PI", "23": "CE", "24": "RN", "25": "PB", "26": "PE", "27": "AL",
+	"28": "SE", "29": "BA", "31": "MG", "32": "ES", "33": "RJ", "35": "SP", "41": "PR",
+	"42": "SC", "43": "RS", "50": "MS", "51": "MT", "52": "GO", "53": "DF",
+}
+
+// AccessKey is a decoded NF-e/NFC-e "chave de acesso".
+//
+// Layout: cUF(2) AAMM(4) CNPJ(14) mod(2) serie(3) nNF(9) tpEmis(1) cNF(8) cDV(1)
+type AccessKey struct {
+	Key          string `json:"key"`
+	StateCode    string `json:"stateCode"`
+	State        string `json:"state"`
+	Year         int    `json:"year"`
+	Month        int    `json:"month"`
+	CNPJ         string `json:"cnpj"`
+	Model        string `json:"model"`
+	Series       int    `json:"series"`
+	Number       int    `json:"number"`
+	EmissionType int    `json:"emissionType"`
+	NumericCode  string `json:"numericCode"`
+	CheckDigit   int    `json:"checkDigit"`
+}
+
+func (k *AccessKey) IsNFCe() bool {
+	return k.Model == ModelNFCe
+}
+
+// EmissionMonth returns the emission year and month as "YYYY-MM".
+func (k *AccessKey) EmissionMonth() string {
+	return fmt.Sprintf("%04d-%02d", k.Year, k.Month)
+}
+
+// Normalize strips the spaces, dots and other separators that receipts print
+// between the digit groups of the key.
+func Normalize(raw string) string {
+	var b strings.Builder
+	for _, r := range raw {
+		if r == ' ' || r == '.' || r == '-' || r == '/' || r == '\t' || r == '\n' {
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Parse validates a key and decodes its fields.
+func Parse(raw string) (*AccessKey, error) {
+	key := Normalize(raw)
+
+	if len(key) != AccessKeyLength {
+		return nil, ErrInvalidLength
+	}
+	if !isDigits(key) {
+		return nil, ErrInvalidCharacters
+	}
+
+	if CheckDigit(key[:43]) != int(key[43]-'0') {
+		return nil, ErrInvalidCheckDigit
+	}
+
+	return decode(key)
+}
+
+// Validate reports whether raw is a well-formed access key.
+func Validate(raw string) error {
+	_, err := Parse(raw)
+	return err
+}
+
+// CheckDigit computes the mod-11 check digit used by access keys (over the
+// first 43 digits) and by CNPJs.
+func CheckDigit(digits string) int {
+	sum := 0
+	weight := 2
+	for i := len(digits) - 1; i >= 0; i-- {
+		sum += int(digits[i]-'0') * weight
+		weight++
+		if weight > 9 {
+			weight = 2
+		}
+	}
+
+	rest := sum % 11
+	if rest < 2 {
+		return 0
+	}
+	return 11 - rest
+}
+
+func decode(key string) (*AccessKey, error) {
+	state, ok := stateCodes[key[0:2]]
+	if !ok {
+		return nil, ErrUnknownState
+	}
+
+	month, _ := strconv.Atoi(key[4:6])
+	if month < 1 || month > 12 {
+		return nil, ErrInvalidMonth
+	}
+
+	model := key[20:22]
+	if model != ModelNFe && model != ModelNFCe {
+		return nil, ErrInvalidModel
+	}
+
+	year, _ := strconv.Atoi(key[2:4])
+	series, _ := strconv.Atoi(key[22:25])
+	number, _ := strconv.Atoi(key[25:34])
+
+	return &AccessKey{
+		Key:          key,
+		StateCode:    key[0:2],
+		State:        state,
+		Year:         2000 + year,
+		Month:        month,
+		CNPJ:         key[6:20],
+		Model:        model,
+		Series:       series,
+		Number:       number,
+		EmissionType: int(key[34] - '0'),
+		NumericCode:  key[35:43],
+		CheckDigit:   int(key[43] - '0'),
+	}, nil
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,31 @@
+package fiscal
+
+// ValidCNPJ checks the two CNPJ check digits. The key may also carry a CPF
+// (left-padded with zeros) for individual issuers, which this rejects.
+func ValidCNPJ(cnpj string) bool {
+	if len(cnpj) != 14 || !isDigits(cnpj) {
+		return false
+	}
+
+	allSame := true
+	for i := 1; i < len(cnpj); i++ {
+		if cnpj[i] != cnpj[0] {
+			allSame = false
+			break
+		}
+	}
+	if allSame {
+		return false
+	}
+
+	return CheckDigit(cnpj[:12]) == int(cnpj[12]-'0') &&
+		CheckDigit(cnpj[:13]) == int(cnpj[13]-'0')
+}
+
+// FormatCNPJ renders a 14-digit CNPJ as 00.000.000/0000-00.
+func FormatCNPJ(cnpj string) string {
+	if len(cnpj) != 14 {
+		return cnpj
+	}
+	return cnpj[0:2] + "." + cnpj[2:5] + "." + cnpj[5:8] + "/" + cnpj[8:12] + "-" + cnpj[12:14]
+}
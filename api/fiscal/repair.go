@@ -0,0 +1,178 @@
+package fiscal
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+var ErrAmbiguousRepair = errors.New("access key is invalid and more than one correction is possible")
+
+// ocrConfusions maps characters OCR and LLMs commonly return in place of digits.
+var ocrConfusions = map[rune]byte{
+	'O': '0', 'o': '0', 'D': '0', 'Q': '0',
+	'I': '1', 'i': '1', 'l': '1', '|': '1',
+	'Z': '2', 'z': '2',
+	'S': '5', 's': '5',
+	'G': '6', 'b': '6',
+	'T': '7',
+	'B': '8',
+	'g': '9', 'q': '9',
+}
+
+type RepairResult struct {
+	Key        *AccessKey `json:"key,omitempty"`
+	Original   string     `json:"original"`
+	Repaired   bool       `json:"repaired"`
+	Candidates []string   `json:"candidates,omitempty"`
+}
+
+// Repair tries to recover a key misread by OCR. It replaces look-alike
+// characters and, if the check digit still fails, tries every single-digit
+// substitution, adjacent transposition, dropped digit and duplicated digit.
+// A correction is only accepted when exactly one plausible candidate remains;
+// emittedAt, when known, is used to discard candidates from another month.
+func Repair(raw string, emittedAt *time.Time) (*RepairResult, error) {
+	result := &RepairResult{Original: raw}
+
+	key := replaceConfusions(Normalize(raw))
+	if parsed, err := Parse(key); err == nil {
+		result.Key = parsed
+		result.Repaired = key != Normalize(raw)
+		return result, nil
+	}
+
+	if !isDigits(key) {
+		return result, ErrInvalidCharacters
+	}
+
+	var candidates []string
+	switch len(key) {
+	case AccessKeyLength:
+		candidates = substitutions(key)
+	case AccessKeyLength - 1:
+		candidates = insertions(key)
+	case AccessKeyLength + 1:
+		candidates = deletions(key)
+	default:
+		return result, ErrInvalidLength
+	}
+
+	candidates = filterPlausible(candidates, emittedAt)
+	if len(candidates) == 0 {
+		_, err := Parse(key)
+		return result, err
+	}
+	if len(candidates) > 1 {
+		result.Candidates = candidates
+		return result, ErrAmbiguousRepair
+	}
+
+	parsed, err := Parse(candidates[0])
+	if err != nil {
+		return result, err
+	}
+	result.Key = parsed
+	result.Repaired = true
+	return result, nil
+}
+
+func replaceConfusions(key string) string {
+	var b strings.Builder
+	for _, r := range key {
+		if d, ok := ocrConfusions[r]; ok {
+			b.WriteByte(d)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func substitutions(key string) []string {
+	var out []string
+	buf := []byte(key)
+	for i := range buf {
+		original := buf[i]
+		for d := byte('0'); d <= '9'; d++ {
+			if d == original {
+				continue
+			}
+			buf[i] = d
+			out = append(out, string(buf))
+		}
+		buf[i] = original
+	}
+	for i := 0; i < len(buf)-1; i++ {
+		if buf[i] == buf[i+1] {
+			continue
+		}
+		buf[i], buf[i+1] = buf[i+1], buf[i]
+		out = append(out, string(buf))
+		buf[i], buf[i+1] = buf[i+1], buf[i]
+	}
+	return out
+}
+
+func insertions(key string) []string {
+	var out []string
+	for i := 0; i <= len(key); i++ {
+		for d := byte('0'); d <= '9'; d++ {
+			out = append(out, key[:i]+string(d)+key[i:])
+		}
+	}
+	return out
+}
+
+func deletions(key string) []string {
+	out := make([]string, 0, len(key))
+	for i := 0; i < len(key); i++ {
+		out = append(out, key[:i]+key[i+1:])
+	}
+	return out
+}
+
+// filterPlausible keeps candidates that parse and, when possible, narrows them
+// down to those with a valid issuer CNPJ and a matching emission month.
+func filterPlausible(candidates []string, emittedAt *time.Time) []string {
+	seen := make(map[string]bool)
+	var valid []*AccessKey
+	for _, c := range candidates {
+		if seen[c] {
+			continue
+		}
+		seen[c] = true
+		if parsed, err := Parse(c); err == nil {
+			valid = append(valid, parsed)
+		}
+	}
+
+	valid = narrow(valid, func(k *AccessKey) bool { return ValidCNPJ(k.CNPJ) })
+	if emittedAt != nil {
+		valid = narrow(valid, func(k *AccessKey) bool {
+			return k.Year == emittedAt.Year() && k.Month == int(emittedAt.Month())
+		})
+	}
+
+	out := make([]string, len(valid))
+	for i, k := range valid {
+		out[i] = k.Key
+	}
+	sort.Strings(out)
+	return out
+}
+
+// narrow applies keep only if at least one key survives it.
+func narrow(keys []*AccessKey, keep func(*AccessKey) bool) []*AccessKey {
+	var kept []*AccessKey
+	for _, k := range keys {
+		if keep(k) {
+			kept = append(kept, k)
+		}
+	}
+	if len(kept) == 0 {
+		return keys
+	}
+	return kept
+}
@@ -0,0 +1,236 @@
+package fiscal
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html/charset"
+)
+
+var ErrNotNFeXML = errors.New("file does not contain an NF-e/NFC-e (infNFe element not found)")
+
+// Document is an authorized NF-e/NFC-e read from its XML, either the bare
+// <NFe> or the <nfeProc> envelope that also carries the authorization protocol.
+type Document struct {
+	AccessKey   string
+	IssuedAt    *time.Time
+	IssuerCNPJ  string
+	IssuerName  string
+	TradeName   string
+	Address     string
+	City        string
+	State       string
+	ProductsSum float64
+	Discount    float64
+	Total       float64
+	TaxAmount   float64 // approximate taxes (Lei 12.741/2012)
+	Change      float64
+	Payments    []Payment
+	Items       []DocumentItem
+}
+
+// Payment is one detPag entry. Code is the tPag code, e.g. "01" for cash,
+// "03" credit card, "04" debit card and "17" PIX.
+type Payment struct {
+	Code   string
+	Amount float64
+}
+
+type DocumentItem struct {
+	Number    int
+	Code      string
+	EAN       string
+	Name      string
+	NCM       string
+	Unit      string
+	Quantity  float64
+	UnitPrice float64
+	Gross     float64
+	Discount  float64
+	Other     float64
+	TaxAmount float64
+}
+
+// Net is the amount paid for the item after its discount.
+func (i DocumentItem) Net() float64 {
+	return i.Gross - i.Discount + i.Other
+}
+
+type infNFe struct {
+	ID  string `xml:"Id,attr"`
+	Ide struct {
+		DhEmi string `xml:"dhEmi"`
+		DEmi  string `xml:"dEmi"`
+	} `xml:"ide"`
+	Emit struct {
+		CNPJ      string `xml:"CNPJ"`
+		CPF       string `xml:"CPF"`
+		XNome     string `xml:"xNome"`
+		XFant     string `xml:"xFant"`
+		EnderEmit struct {
+			XLgr    string `xml:"xLgr"`
+			Nro     string `xml:"nro"`
+			XBairro string `xml:"xBairro"`
+			XMun    string `xml:"xMun"`
+			UF      string `xml:"UF"`
+		} `xml:"enderEmit"`
+	} `xml:"emit"`
+	Det []struct {
+		NItem int `xml:"nItem,attr"`
+		Prod  struct {
+			CProd  string  `xml:"cProd"`
+			CEAN   string  `xml:"cEAN"`
+			XProd  string  `xml:"xProd"`
+			NCM    string  `xml:"NCM"`
+			UCom   string  `xml:"uCom"`
+			QCom   float64 `xml:"qCom"`
+			VUnCom float64 `xml:"vUnCom"`
+			VProd  float64 `xml:"vProd"`
+			VDesc  float64 `xml:"vDesc"`
+			VOutro float64 `xml:"vOutro"`
+		} `xml:"prod"`
+		Imposto struct {
+			VTotTrib float64 `xml:"vTotTrib"`
+		} `xml:"imposto"`
+	} `xml:"det"`
+	Total struct {
+		ICMSTot struct {
+			VProd    float64 `xml:"vProd"`
+			VDesc    float64 `xml:"vDesc"`
+			VNF      float64 `xml:"vNF"`
+			VTotTrib float64 `xml:"vTotTrib"`
+		} `xml:"ICMSTot"`
+	} `xml:"total"`
+	Pag struct {
+		DetPag []struct {
+			TPag string  `xml:"tPag"`
+			VPag float64 `xml:"vPag"`
+		} `xml:"detPag"`
+		// Layout 3.10 puts a single payment directly under pag.
+		TPag   string  `xml:"tPag"`
+		VPag   float64 `xml:"vPag"`
+		VTroco float64 `xml:"vTroco"`
+	} `xml:"pag"`
+}
+
+// ParseXML reads the first infNFe in r. Namespaces are ignored, so both the
+// portalfiscal namespace and files saved without it are accepted.
+func ParseXML(r io.Reader) (*Document, error) {
+	decoder := xml.NewDecoder(r)
+	// Authorized XMLs are UTF-8, but some emitters still write ISO-8859-1.
+	decoder.CharsetReader = charset.NewReaderLabel
+
+	var inf *infNFe
+	var protocolKey string
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "infNFe":
+			if inf != nil {
+				continue
+			}
+			inf = &infNFe{}
+			if err := decoder.DecodeElement(inf, &start); err != nil {
+				return nil, err
+			}
+		case "chNFe":
+			if err := decoder.DecodeElement(&protocolKey, &start); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if inf == nil {
+		return nil, ErrNotNFeXML
+	}
+
+	doc := &Document{
+		AccessKey:   strings.TrimPrefix(strings.TrimSpace(inf.ID), "NFe"),
+		IssuerCNPJ:  inf.Emit.CNPJ,
+		IssuerName:  strings.TrimSpace(inf.Emit.XNome),
+		TradeName:   strings.TrimSpace(inf.Emit.XFant),
+		City:        inf.Emit.EnderEmit.XMun,
+		State:       inf.Emit.EnderEmit.UF,
+		ProductsSum: inf.Total.ICMSTot.VProd,
+		Discount:    inf.Total.ICMSTot.VDesc,
+		Total:       inf.Total.ICMSTot.VNF,
+		TaxAmount:   inf.Total.ICMSTot.VTotTrib,
+		Change:      inf.Pag.VTroco,
+	}
+	if doc.AccessKey == "" {
+		doc.AccessKey = strings.TrimSpace(protocolKey)
+	}
+	if doc.IssuerCNPJ == "" {
+		doc.IssuerCNPJ = inf.Emit.CPF
+	}
+
+	for _, detPag := range inf.Pag.DetPag {
+		doc.Payments = append(doc.Payments, Payment{Code: strings.TrimSpace(detPag.TPag), Amount: detPag.VPag})
+	}
+	if len(doc.Payments) == 0 && inf.Pag.TPag != "" {
+		doc.Payments = append(doc.Payments, Payment{Code: strings.TrimSpace(inf.Pag.TPag), Amount: inf.Pag.VPag})
+	}
+
+	addressParts := []string{}
+	for _, part := range []string{inf.Emit.EnderEmit.XLgr, inf.Emit.EnderEmit.Nro, inf.Emit.EnderEmit.XBairro} {
+		if part = strings.TrimSpace(part); part != "" {
+			addressParts = append(addressParts, part)
+		}
+	}
+	doc.Address = strings.Join(addressParts, ", ")
+
+	if inf.Ide.DhEmi != "" {
+		if issued, err := time.Parse(time.RFC3339, inf.Ide.DhEmi); err == nil {
+			doc.IssuedAt = &issued
+		}
+	} else if inf.Ide.DEmi != "" {
+		// Layout 2.00 only has the emission date.
+		if issued, err := time.Parse("2006-01-02", inf.Ide.DEmi); err == nil {
+			doc.IssuedAt = &issued
+		}
+	}
+
+	for _, det := range inf.Det {
+		doc.Items = append(doc.Items, DocumentItem{
+			Number:    det.NItem,
+			Code:      strings.TrimSpace(det.Prod.CProd),
+			EAN:       normalizeEAN(det.Prod.CEAN),
+			Name:      strings.TrimSpace(det.Prod.XProd),
+			NCM:       det.Prod.NCM,
+			Unit:      strings.ToLower(strings.TrimSpace(det.Prod.UCom)),
+			Quantity:  det.Prod.QCom,
+			UnitPrice: det.Prod.VUnCom,
+			Gross:     det.Prod.VProd,
+			Discount:  det.Prod.VDesc,
+			Other:     det.Prod.VOutro,
+			TaxAmount: det.Imposto.VTotTrib,
+		})
+	}
+
+	return doc, nil
+}
+
+// normalizeEAN drops the "SEM GTIN" placeholder used for products without one.
+func normalizeEAN(ean string) string {
+	ean = strings.TrimSpace(ean)
+	if ean == "" || !isDigits(ean) {
+		return ""
+	}
+	return ean
+}
@@ -1,7 +1,7 @@
 package handlers
 
 import (
-	"buybuddy-api/config"
+	"buybuddy-api/llm"
 	"buybuddy-api/models"
 	"buybuddy-api/repository"
 	"buybuddy-api/utils"
@@ -15,16 +15,16 @@ import (
 )
 
 type AssistantHandler struct {
-	cfg          *config.Config
+	llms         *llm.Registry
 	receiptRepo  *repository.ReceiptRepository
 	chatRepo     *repository.ChatRepository
 	prefsRepo    *repository.PreferencesRepository
 	categoryRepo *repository.CategoryRepository
 }
 
-func NewAssistantHandler(cfg *config.Config, receiptRepo *repository.ReceiptRepository, chatRepo *repository.ChatRepository, prefsRepo *repository.PreferencesRepository, categoryRepo *repository.CategoryRepository) *AssistantHandler {
+func NewAssistantHandler(llms *llm.Registry, receiptRepo *repository.ReceiptRepository, chatRepo *repository.ChatRepository, prefsRepo *repository.PreferencesRepository, categoryRepo *repository.CategoryRepository) *AssistantHandler {
 	return &AssistantHandler{
-		cfg:          cfg,
+		llms:         llms,
 		receiptRepo:  receiptRepo,
 		chatRepo:     chatRepo,
 		prefsRepo:    prefsRepo,
@@ -48,6 +48,26 @@ func (h *AssistantHandler) getFirstReceiptDate(userID string) *time.Time {
 	return date
 }
 
+// queryReceipts runs a query for the assistant, with receipts split with
+// other users narrowed to the user's share of them.
+func (h *AssistantHandler) queryReceipts(userID string, filter *models.AssistantQueryFilter) ([]models.Receipt, error) {
+	receipts, err := h.receiptRepo.QueryWithFilters(userID, filter, 30)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(receipts))
+	for i, receipt := range receipts {
+		ids[i] = receipt.ID
+	}
+	splits, err := h.receiptRepo.GetAcceptedSplits(ids)
+	if err != nil {
+		return nil, err
+	}
+	utils.ApplySplits(userID, receipts, splits)
+	return receipts, nil
+}
+
 func (h *AssistantHandler) AskQuestion(c echo.Context) error {
 	userID := c.Get("userID").(string)
 
@@ -71,22 +91,34 @@ func (h *AssistantHandler) AskQuestion(c echo.Context) error {
 	}
 
 	prefs, _ := h.prefsRepo.GetOrCreate(userID)
-	assistantModel := prefs.AssistantModel
-	if assistantModel == "" {
-		assistantModel = "gemini-2.5-flash-lite"
+	assistantModel := ""
+	if prefs != nil && h.llms.IsChatModel(prefs.AssistantModel) {
+		assistantModel = prefs.AssistantModel
+	}
+	chat, chatModel, err := h.llms.Chat(assistantModel)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "no assistant model is configured")
+	}
+	intentChat, intentModel, err := h.llms.Intent()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "no assistant model is configured")
 	}
 
 	firstReceiptDate := h.getFirstReceiptDate(userID)
 
 	categories, _ := h.categoryRepo.GetAll()
 
-	intent, err := utils.DetectIntentAndGenerateQuery(c.Request().Context(), req.Question, conversationHistory, firstReceiptDate, categories, h.cfg.GeminiAPIKey)
+	intent, err := utils.DetectIntentAndGenerateQuery(c.Request().Context(), intentChat, intentModel, req.Question, conversationHistory, firstReceiptDate, categories)
 	if err != nil {
 		fmt.Println("Intent detection error:", err)
-		return echo.NewHTTPError(http.StatusInternalServerError, map[string]string{
+		body := map[string]string{
 			"message": "Failed to process question",
 			"error":   err.Error(),
-		})
+		}
+		if raw, ok := llm.RawOutput(err); ok {
+			body["rawOutput"] = raw
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, body)
 	}
 
 	var answer string
@@ -100,14 +132,14 @@ func (h *AssistantHandler) AskQuestion(c echo.Context) error {
 		log.Printf("General query filters: %+v", intent.General)
 
 		if intent.Specific != nil {
-			specificResults, err = h.receiptRepo.QueryWithFilters(userID, intent.Specific, 30)
+			specificResults, err = h.queryReceipts(userID, intent.Specific)
 			if err != nil {
 				fmt.Println("Specific query error:", err)
 			}
 		}
 
 		if intent.General != nil {
-			generalResults, err = h.receiptRepo.QueryWithFilters(userID, intent.General, 30)
+			generalResults, err = h.queryReceipts(userID, intent.General)
 			if err != nil {
 				fmt.Println("General query error:", err)
 			}
@@ -116,7 +148,7 @@ func (h *AssistantHandler) AskQuestion(c echo.Context) error {
 		mergedResults := utils.MergeResults(specificResults, generalResults)
 		compactReceipts := utils.FormatReceiptsCompact(mergedResults, intent.Specific)
 
-		answer, err = utils.GenerateAnswer(c.Request().Context(), req.Question, compactReceipts, conversationHistory, h.cfg.GeminiAPIKey, assistantModel)
+		answer, err = utils.GenerateAnswer(c.Request().Context(), chat, chatModel, req.Question, compactReceipts, conversationHistory)
 		if err != nil {
 			fmt.Println("Answer generation error:", err)
 			return echo.NewHTTPError(http.StatusInternalServerError, map[string]string{
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"bufio"
+	"buybuddy-api/export"
+	"buybuddy-api/models"
+	"buybuddy-api/repository"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// exportFlushRows is how many rows are buffered before they are sent.
+const exportFlushRows = 500
+
+type ExportHandler struct {
+	receiptRepo *repository.ReceiptRepository
+	prefsRepo   *repository.PreferencesRepository
+}
+
+func NewExportHandler(receiptRepo *repository.ReceiptRepository, prefsRepo *repository.PreferencesRepository) *ExportHandler {
+	return &ExportHandler{receiptRepo: receiptRepo, prefsRepo: prefsRepo}
+}
+
+// ExportReceipts streams the user's receipt items, one row per item, oldest
+// first.
+//
+//	?format=   csv (the default), json, ledger or beancount
+//	?from=&to= dates as YYYY-MM-DD (to is inclusive) or RFC 3339
+//
+// The ledger formats book each receipt as a transaction and map categories
+// to accounts through the export_accounts preference.
+func (h *ExportHandler) ExportReceipts(c echo.Context) error {
+	userID := c.Get("userID").(string)
+
+	format := c.QueryParam("format")
+	if format == "" {
+		format = models.ExportCSV
+	}
+	if !export.IsFormat(format) {
+		return echo.NewHTTPError(http.StatusBadRequest, "format must be csv, json, ledger or beancount")
+	}
+
+	from, err := parseListDate(c.QueryParam("from"), false)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid from date")
+	}
+	to, err := parseListDate(c.QueryParam("to"), true)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid to date")
+	}
+
+	var accounts *models.ExportAccounts
+	prefs, err := h.prefsRepo.GetByUserID(userID)
+	if err == nil {
+		accounts = prefs.ExportAccounts
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get preferences")
+	}
+
+	response := c.Response()
+	buffered := bufio.NewWriter(response)
+	writer, err := export.NewWriter(format, buffered, accounts)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to start export")
+	}
+
+	filename := fmt.Sprintf("receipts-%s.%s", time.Now().Format("20060102"), export.Extension(format))
+	response.Header().Set(echo.HeaderContentType, export.ContentType(format))
+	response.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+	response.WriteHeader(http.StatusOK)
+
+	// Once rows are sent the status can't change, so a failure part way
+	// through only cuts the export short.
+	rows := 0
+	err = h.receiptRepo.ExportItems(userID, from, to, func(row *models.ExportRow) error {
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+		rows++
+		if rows%exportFlushRows == 0 {
+			if err := buffered.Flush(); err != nil {
+				return err
+			}
+			response.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return buffered.Flush()
+}
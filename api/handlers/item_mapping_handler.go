@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"buybuddy-api/models"
+	"buybuddy-api/repository"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+const maxItemMappingsPerPage = 500
+
+type ItemMappingHandler struct {
+	mappingRepo *repository.ItemMappingRepository
+}
+
+func NewItemMappingHandler(mappingRepo *repository.ItemMappingRepository) *ItemMappingHandler {
+	return &ItemMappingHandler{mappingRepo: mappingRepo}
+}
+
+// GetItemMappings lists the item names learned for the user, most used first.
+// ?q= filters by name, ?storeId= by the store last seen and ?limit= caps the
+// result.
+func (h *ItemMappingHandler) GetItemMappings(c echo.Context) error {
+	userID := c.Get("userID").(string)
+
+	limit := maxItemMappingsPerPage
+	if value, err := strconv.Atoi(c.QueryParam("limit")); err == nil && value > 0 && value < limit {
+		limit = value
+	}
+
+	var storeID *uint
+	if value := c.QueryParam("storeId"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid store id")
+		}
+		store := uint(id)
+		storeID = &store
+	}
+
+	mappings, err := h.mappingRepo.GetByUserID(userID, strings.TrimSpace(c.QueryParam("q")), storeID, limit)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch item mappings")
+	}
+
+	return c.JSON(http.StatusOK, mappings)
+}
+
+// UpdateItemMapping corrects the name a mapping gives.
+func (h *ItemMappingHandler) UpdateItemMapping(c echo.Context) error {
+	userID := c.Get("userID").(string)
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid mapping id")
+	}
+
+	var req models.UpdateItemMappingRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "name is required")
+	}
+
+	mapping, err := h.mappingRepo.GetByID(uint(id), userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "item mapping not found")
+	}
+
+	if err := h.mappingRepo.Rename(mapping, name); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to update item mapping")
+	}
+
+	return c.JSON(http.StatusOK, mapping)
+}
+
+// DeleteItemMapping forgets a bad mapping so it is no longer sent to the
+// receipt model.
+func (h *ItemMappingHandler) DeleteItemMapping(c echo.Context) error {
+	userID := c.Get("userID").(string)
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid mapping id")
+	}
+
+	if err := h.mappingRepo.Delete(uint(id), userID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "item mapping not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to delete item mapping")
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "item mapping deleted"})
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultItemSearchResults = 50
+	maxItemSearchResults     = 200
+)
+
+// SearchItems finds the user's receipt items by name, raw name or brand,
+// ignoring accents and word endings ("feijao" finds "Feijão Preto") and
+// tolerating typos, best match first.
+//
+//	?q=      the text to search for
+//	?limit=  results to return (50, up to 200)
+func (h *ReceiptHandler) SearchItems(c echo.Context) error {
+	userID := c.Get("userID").(string)
+
+	query := strings.TrimSpace(c.QueryParam("q"))
+	if query == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "q is required")
+	}
+
+	limit := defaultItemSearchResults
+	if value := c.QueryParam("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "limit must be a positive number")
+		}
+		limit = min(parsed, maxItemSearchResults)
+	}
+
+	results, err := h.receiptRepo.SearchItems(userID, query, limit)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to search items")
+	}
+
+	return c.JSON(http.StatusOK, results)
+}
@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"buybuddy-api/models"
+	"buybuddy-api/repository"
+	"buybuddy-api/utils"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// maxDryRunItems caps the items listed in a dry run; the counts cover all.
+const maxDryRunItems = 500
+
+type NormalizationRuleHandler struct {
+	ruleRepo     *repository.NormalizationRuleRepository
+	categoryRepo *repository.CategoryRepository
+}
+
+func NewNormalizationRuleHandler(ruleRepo *repository.NormalizationRuleRepository, categoryRepo *repository.CategoryRepository) *NormalizationRuleHandler {
+	return &NormalizationRuleHandler{ruleRepo: ruleRepo, categoryRepo: categoryRepo}
+}
+
+// GetRules lists the user's rules in evaluation order.
+func (h *NormalizationRuleHandler) GetRules(c echo.Context) error {
+	userID := c.Get("userID").(string)
+
+	rules, err := h.ruleRepo.GetByUserID(userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch rules")
+	}
+
+	return c.JSON(http.StatusOK, rules)
+}
+
+func (h *NormalizationRuleHandler) CreateRule(c echo.Context) error {
+	userID := c.Get("userID").(string)
+
+	var req models.NormalizationRuleRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+
+	rule := &models.NormalizationRule{UserID: userID, Enabled: true}
+	if err := h.applyRequest(rule, req); err != nil {
+		return err
+	}
+	if req.Position == nil {
+		position, err := h.ruleRepo.NextPosition(userID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to create rule")
+		}
+		rule.Position = position
+	}
+
+	if err := h.ruleRepo.Create(rule); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to create rule")
+	}
+
+	return c.JSON(http.StatusCreated, rule)
+}
+
+// UpdateRule replaces a rule. Position and enabled are kept when omitted.
+func (h *NormalizationRuleHandler) UpdateRule(c echo.Context) error {
+	userID := c.Get("userID").(string)
+
+	rule, err := h.findRule(c, userID)
+	if err != nil {
+		return err
+	}
+
+	var req models.NormalizationRuleRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+	if err := h.applyRequest(rule, req); err != nil {
+		return err
+	}
+
+	if err := h.ruleRepo.Update(rule); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to update rule")
+	}
+
+	return c.JSON(http.StatusOK, rule)
+}
+
+func (h *NormalizationRuleHandler) DeleteRule(c echo.Context) error {
+	userID := c.Get("userID").(string)
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid rule id")
+	}
+
+	if err := h.ruleRepo.Delete(uint(id), userID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "rule not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to delete rule")
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "rule deleted"})
+}
+
+// DryRunRule shows which saved items a rule would change, taking the user's
+// other rules into account: items an earlier rule matches are counted as
+// shadowed and left out. Nothing is saved.
+func (h *NormalizationRuleHandler) DryRunRule(c echo.Context) error {
+	userID := c.Get("userID").(string)
+
+	var req models.RuleDryRunRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+
+	saved, err := h.ruleRepo.GetByUserID(userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch rules")
+	}
+
+	// A new rule gets the largest ID so it sorts after saved rules at the
+	// same position, as it would once created.
+	candidate := models.NormalizationRule{ID: math.MaxUint32, UserID: userID}
+	rules := make([]models.NormalizationRule, 0, len(saved)+1)
+	for _, rule := range saved {
+		if req.RuleID != nil && rule.ID == *req.RuleID {
+			candidate = rule
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	if req.RuleID != nil && candidate.ID != *req.RuleID {
+		return echo.NewHTTPError(http.StatusNotFound, "rule not found")
+	}
+
+	if err := h.applyRequest(&candidate, req.NormalizationRuleRequest); err != nil {
+		return err
+	}
+	if req.RuleID == nil && req.Position == nil {
+		position, err := h.ruleRepo.NextPosition(userID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch rules")
+		}
+		candidate.Position = position
+	}
+	candidate.Enabled = true
+	rules = append(rules, candidate)
+
+	pattern, err := utils.CompileRulePattern(candidate.Pattern)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid pattern")
+	}
+	ruleSet := utils.NewRuleSet(rules)
+
+	items, err := h.ruleRepo.GetItems(userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch items")
+	}
+
+	response := models.RuleDryRunResponse{Items: []models.RuleDryRunItem{}}
+	for _, item := range items {
+		rawName := item.RawName
+		if rawName == "" {
+			rawName = item.Name
+		}
+		if !pattern.MatchString(rawName) {
+			continue
+		}
+		response.Matched++
+
+		if match := ruleSet.Match(rawName); match == nil || match.ID != candidate.ID {
+			response.Shadowed++
+			continue
+		}
+
+		current := models.RuleItemFields{Name: item.Name, Category: item.Category, Subcategory: item.Subcategory, Brand: item.Brand}
+		proposed := current
+		if candidate.Name != "" {
+			proposed.Name = candidate.Name
+		}
+		if candidate.Brand != "" {
+			proposed.Brand = candidate.Brand
+		}
+		if candidate.Category != "" {
+			proposed.Category = candidate.Category
+			proposed.Subcategory = candidate.Subcategory
+		}
+		if proposed == current {
+			continue
+		}
+
+		response.Changed++
+		if len(response.Items) < maxDryRunItems {
+			response.Items = append(response.Items, models.RuleDryRunItem{
+				ItemID:    item.ID,
+				ReceiptID: item.ReceiptID,
+				RawName:   item.RawName,
+				Current:   current,
+				Proposed:  proposed,
+			})
+		}
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// applyRequest validates the request and copies it onto the rule.
+func (h *NormalizationRuleHandler) applyRequest(rule *models.NormalizationRule, req models.NormalizationRuleRequest) error {
+	pattern := strings.TrimSpace(req.Pattern)
+	if pattern == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "pattern is required")
+	}
+	if _, err := utils.CompileRulePattern(pattern); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid pattern: %v", err))
+	}
+
+	name := strings.TrimSpace(req.Name)
+	brand := strings.TrimSpace(req.Brand)
+	categoryName := strings.TrimSpace(req.Category)
+	subcategoryName := strings.TrimSpace(req.Subcategory)
+	if name == "" && brand == "" && categoryName == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "a rule must set a name, category or brand")
+	}
+
+	if subcategoryName != "" && categoryName == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "subcategory requires a category")
+	}
+	if categoryName != "" {
+		category, err := h.categoryRepo.GetByName(categoryName)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown category %s", categoryName))
+		}
+		if subcategoryName != "" {
+			if _, err := h.categoryRepo.GetSubcategoryByName(category.ID, subcategoryName); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown subcategory %s", subcategoryName))
+			}
+		}
+	}
+
+	rule.Pattern = pattern
+	rule.Name = name
+	rule.Brand = brand
+	rule.Category = categoryName
+	rule.Subcategory = subcategoryName
+	if req.Position != nil {
+		rule.Position = *req.Position
+	}
+	if req.Enabled != nil {
+		rule.Enabled = *req.Enabled
+	}
+	return nil
+}
+
+func (h *NormalizationRuleHandler) findRule(c echo.Context, userID string) (*models.NormalizationRule, error) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid rule id")
+	}
+
+	rule, err := h.ruleRepo.GetByID(uint(id), userID)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "rule not found")
+	}
+	return rule, nil
+}
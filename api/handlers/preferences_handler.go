@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"buybuddy-api/llm"
 	"buybuddy-api/models"
 	"buybuddy-api/repository"
 	"net/http"
@@ -10,10 +11,11 @@ import (
 
 type PreferencesHandler struct {
 	prefsRepo *repository.PreferencesRepository
+	llms      *llm.Registry
 }
 
-func NewPreferencesHandler(prefsRepo *repository.PreferencesRepository) *PreferencesHandler {
-	return &PreferencesHandler{prefsRepo: prefsRepo}
+func NewPreferencesHandler(prefsRepo *repository.PreferencesRepository, llms *llm.Registry) *PreferencesHandler {
+	return &PreferencesHandler{prefsRepo: prefsRepo, llms: llms}
 }
 
 func (h *PreferencesHandler) GetPreferences(c echo.Context) error {
@@ -40,12 +42,22 @@ func (h *PreferencesHandler) UpdatePreferences(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to get preferences"})
 	}
 
+	if req.ReceiptModel != "" && !h.llms.IsReceiptModel(req.ReceiptModel) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Unknown receipt model"})
+	}
+	if req.AssistantModel != "" && !h.llms.IsChatModel(req.AssistantModel) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Unknown assistant model"})
+	}
+
 	if req.ReceiptModel != "" {
 		prefs.ReceiptModel = req.ReceiptModel
 	}
 	if req.AssistantModel != "" {
 		prefs.AssistantModel = req.AssistantModel
 	}
+	if req.ExportAccounts != nil {
+		prefs.ExportAccounts = req.ExportAccounts
+	}
 
 	if err := h.prefsRepo.Update(prefs); err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update preferences"})
@@ -54,20 +66,12 @@ func (h *PreferencesHandler) UpdatePreferences(c echo.Context) error {
 	return c.JSON(http.StatusOK, prefs)
 }
 
+// GetAvailableModels lists the models of every configured provider, the
+// defaults first.
 func (h *PreferencesHandler) GetAvailableModels(c echo.Context) error {
 	models := map[string]interface{}{
-		"receipt_models": []map[string]string{
-			{"id": "gemini-2.5-flash", "name": "Gemini 2.5 Flash", "description": "Latest and fastest (default)"},
-			{"id": "gemini-2.5-pro", "name": "Gemini 2.5 Pro", "description": "Most capable"},
-			{"id": "gemini-2.5-flash-lite", "name": "Gemini 2.5 Flash Lite", "description": "Lightweight and fast"},
-			{"id": "gemini-2.0-flash", "name": "Gemini 2.0 Flash", "description": "Reliable multimodal"},
-		},
-		"assistant_models": []map[string]string{
-			{"id": "gemini-2.5-flash-lite", "name": "Gemini 2.5 Flash Lite", "description": "Quick responses (default)"},
-			{"id": "gemini-2.5-flash", "name": "Gemini 2.5 Flash", "description": "Latest and fastest"},
-			{"id": "gemini-2.5-pro", "name": "Gemini 2.5 Pro", "description": "Most intelligent"},
-			{"id": "gemini-2.0-flash", "name": "Gemini 2.0 Flash", "description": "Balanced performance"},
-		},
+		"receipt_models":   h.llms.ReceiptModels(),
+		"assistant_models": h.llms.ChatModels(),
 	}
 
 	return c.JSON(http.StatusOK, models)
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"buybuddy-api/models"
+	"buybuddy-api/repository"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+const maxProductsPerPage = 200
+
+type ProductHandler struct {
+	productRepo *repository.ProductRepository
+}
+
+func NewProductHandler(productRepo *repository.ProductRepository) *ProductHandler {
+	return &ProductHandler{productRepo: productRepo}
+}
+
+// GetProducts lists the user's products, most bought first. ?q= filters by
+// name and ?limit= caps the result.
+func (h *ProductHandler) GetProducts(c echo.Context) error {
+	userID := c.Get("userID").(string)
+
+	limit := maxProductsPerPage
+	if value, err := strconv.Atoi(c.QueryParam("limit")); err == nil && value > 0 && value < limit {
+		limit = value
+	}
+
+	products, err := h.productRepo.GetByUserID(userID, strings.TrimSpace(c.QueryParam("q")), limit)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch products")
+	}
+
+	return c.JSON(http.StatusOK, products)
+}
+
+// GetProduct returns a product with its purchase history.
+func (h *ProductHandler) GetProduct(c echo.Context) error {
+	userID := c.Get("userID").(string)
+
+	product, err := h.findProduct(c, userID)
+	if err != nil {
+		return err
+	}
+
+	purchases, err := h.productRepo.GetPurchases(product.ID, userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch purchases")
+	}
+
+	return c.JSON(http.StatusOK, models.ProductDetail{Product: *product, Purchases: purchases})
+}
+
+// MergeProducts folds the listed products into the one in the URL.
+func (h *ProductHandler) MergeProducts(c echo.Context) error {
+	userID := c.Get("userID").(string)
+
+	product, err := h.findProduct(c, userID)
+	if err != nil {
+		return err
+	}
+
+	var req models.MergeProductsRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+
+	sourceIDs := make([]uint, 0, len(req.ProductIDs))
+	seen := map[uint]bool{product.ID: true}
+	for _, id := range req.ProductIDs {
+		if !seen[id] {
+			seen[id] = true
+			sourceIDs = append(sourceIDs, id)
+		}
+	}
+	if len(sourceIDs) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "productIds must list at least one other product")
+	}
+
+	if err := h.productRepo.Merge(userID, product.ID, sourceIDs); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "product not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to merge products")
+	}
+
+	return c.JSON(http.StatusOK, product)
+}
+
+// SplitProduct moves some of a product's items to a new product, for items
+// that were linked together by mistake.
+func (h *ProductHandler) SplitProduct(c echo.Context) error {
+	userID := c.Get("userID").(string)
+
+	product, err := h.findProduct(c, userID)
+	if err != nil {
+		return err
+	}
+
+	var req models.SplitProductRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+	if len(req.ItemIDs) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "itemIds is required")
+	}
+
+	purchases, err := h.productRepo.GetPurchases(product.ID, userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch purchases")
+	}
+	if len(req.ItemIDs) >= len(purchases) {
+		return echo.NewHTTPError(http.StatusBadRequest, "leave at least one item on the original product")
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		for _, purchase := range purchases {
+			if purchase.ItemID == req.ItemIDs[0] {
+				name = purchase.Name
+			}
+		}
+	}
+	if name == "" {
+		name = product.Name
+	}
+
+	split, err := h.productRepo.Split(userID, product.ID, req.ItemIDs, name, strings.TrimSpace(req.Brand))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusBadRequest, "every item must belong to this product")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to split product")
+	}
+
+	return c.JSON(http.StatusCreated, split)
+}
+
+func (h *ProductHandler) findProduct(c echo.Context, userID string) (*models.Product, error) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid product id")
+	}
+
+	product, err := h.productRepo.GetByID(uint(id), userID)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "product not found")
+	}
+	return product, nil
+}
@@ -0,0 +1,358 @@
+package handlers
+
+import (
+	"buybuddy-api/models"
+	"buybuddy-api/normalize"
+	"buybuddy-api/utils"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func (h *ReceiptHandler) UpdateReceipt(c echo.Context) error {
+	userID := c.Get("userID").(string)
+	receiptID := c.Param("id")
+
+	var req models.UpdateReceiptRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+
+	receipt, err := h.receiptRepo.GetByID(receiptID, userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "receipt not found")
+	}
+
+	if req.Company != nil {
+		company := strings.TrimSpace(*req.Company)
+		if company == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "company cannot be empty")
+		}
+		receipt.Company = company
+		h.assignStore(receipt, models.StoreDetails{})
+	}
+
+	dateChanged := false
+	if req.Date != nil {
+		date, err := parseEditedDate(*req.Date)
+		if err != nil {
+			return err
+		}
+		dateChanged = !sameDate(receipt.Date, date)
+		receipt.Date = date
+	}
+
+	items := receipt.Items
+	var saved, renamed, added []models.ReceiptItem
+	var deleted []uint
+
+	if req.Items != nil {
+		existing := make(map[uint]models.ReceiptItem, len(receipt.Items))
+		for _, item := range receipt.Items {
+			existing[item.ID] = item
+		}
+
+		items = make([]models.ReceiptItem, 0, len(*req.Items))
+		kept := make(map[uint]bool)
+		for i, input := range *req.Items {
+			var item models.ReceiptItem
+			if input.ID != nil {
+				current, ok := existing[*input.ID]
+				if !ok || kept[*input.ID] {
+					return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("item %d does not belong to this receipt", *input.ID))
+				}
+				kept[*input.ID] = true
+				item = current
+			} else {
+				item = models.ReceiptItem{Quantity: 1, Unit: "un"}
+			}
+
+			if err := h.applyItemInput(&item, input); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("item %d: %s", i+1, err.Error()))
+			}
+			if input.ID == nil {
+				added = append(added, item)
+			} else if item.Name != existing[*input.ID].Name {
+				renamed = append(renamed, item)
+			}
+			items = append(items, item)
+		}
+
+		for _, item := range receipt.Items {
+			if !kept[item.ID] {
+				deleted = append(deleted, item.ID)
+			}
+		}
+		saved = items
+	}
+
+	if req.Discount != nil {
+		if *req.Discount < 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "discount cannot be negative")
+		}
+		receipt.Discount = *req.Discount
+	}
+
+	expectedTotal := utils.ReconcileItems(0, receipt.Discount, items).ExpectedTotal
+	if req.Total != nil {
+		if *req.Total <= 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "total must be greater than zero")
+		}
+		if len(items) > 0 && math.Abs(*req.Total-expectedTotal) > utils.TotalTolerance {
+			return echo.NewHTTPError(http.StatusUnprocessableEntity,
+				fmt.Sprintf("total %.2f does not match the items less discounts, %.2f", *req.Total, expectedTotal))
+		}
+		receipt.Total = *req.Total
+	} else if req.Items != nil || req.Discount != nil {
+		receipt.Total = expectedTotal
+	}
+
+	h.assignProducts(userID, saved)
+	utils.MeasureItems(saved)
+	utils.ApplyReconciliation(receipt, items)
+
+	if err := h.receiptRepo.SaveChanges(receipt, saved, deleted); err != nil {
+		fmt.Println("Error updating receipt:", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to update receipt")
+	}
+
+	h.learnItemNames(receipt, renamed, true)
+	h.learnItemNames(receipt, added, false)
+
+	if dateChanged {
+		utils.GetFirstReceiptCache().Invalidate(userID)
+	}
+
+	updated, err := h.receiptRepo.GetByID(receiptID, userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch receipt")
+	}
+
+	return c.JSON(http.StatusOK, updated)
+}
+
+// UpdateReceiptItem edits one item. The receipt total moves by the change in
+// the item's total, so any existing difference between the receipt total and
+// its items is kept.
+func (h *ReceiptHandler) UpdateReceiptItem(c echo.Context) error {
+	userID := c.Get("userID").(string)
+	receiptID := c.Param("id")
+
+	itemID, err := strconv.ParseUint(c.Param("itemId"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid item id")
+	}
+
+	var input models.ReceiptItemInput
+	if err := c.Bind(&input); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+
+	receipt, err := h.receiptRepo.GetByID(receiptID, userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "receipt not found")
+	}
+
+	index := -1
+	for i := range receipt.Items {
+		if receipt.Items[i].ID == uint(itemID) {
+			index = i
+			break
+		}
+	}
+	if index == -1 {
+		return echo.NewHTTPError(http.StatusNotFound, "item not found")
+	}
+	// edited shares its backing array with receipt.Items, so the
+	// reconciliation below sees the changes.
+	edited := receipt.Items[index : index+1]
+	item := &edited[0]
+
+	previousTotal := item.TotalPrice
+	previousName := item.Name
+	if err := h.applyItemInput(item, input); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	// Correcting the name or category by hand confirms the item.
+	if input.Name != nil || input.Category != nil || input.Subcategory != nil {
+		now := time.Now()
+		item.ReviewedAt = &now
+	}
+
+	receipt.Total = utils.RoundCents(receipt.Total + item.TotalPrice - previousTotal)
+	if receipt.Total <= 0 {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, "the change would leave the receipt total at zero or below")
+	}
+
+	// Only the edited item is saved, so only it is linked and measured.
+	h.assignProducts(userID, edited)
+	utils.MeasureItems(edited)
+	utils.ApplyReconciliation(receipt, receipt.Items)
+
+	if err := h.receiptRepo.SaveChanges(receipt, edited, nil); err != nil {
+		fmt.Println("Error updating receipt item:", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to update item")
+	}
+
+	if item.Name != previousName {
+		h.learnItemNames(receipt, []models.ReceiptItem{*item}, true)
+	}
+
+	updated, err := h.receiptRepo.GetByID(receiptID, userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch receipt")
+	}
+
+	return c.JSON(http.StatusOK, updated)
+}
+
+// applyItemInput copies the given fields onto the item and validates the
+// result. New items must have a name and a price.
+func (h *ReceiptHandler) applyItemInput(item *models.ReceiptItem, input models.ReceiptItemInput) error {
+	if (input.Name != nil && *input.Name != item.Name) || (input.Brand != nil && *input.Brand != item.Brand) {
+		unlinkProduct(item)
+	}
+
+	if input.Name != nil {
+		item.Name = strings.TrimSpace(*input.Name)
+	}
+	if input.RawName != nil {
+		item.RawName = strings.TrimSpace(*input.RawName)
+	}
+	if item.RawName == "" {
+		item.RawName = item.Name
+	}
+	if item.Name == "" {
+		item.Name = item.RawName
+	}
+	if item.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+
+	if input.Brand != nil {
+		item.Brand = strings.TrimSpace(*input.Brand)
+	}
+	if input.Unit != nil {
+		item.Unit = strings.TrimSpace(*input.Unit)
+		if item.Unit == "" {
+			item.Unit = "un"
+		}
+	}
+
+	if input.Quantity != nil {
+		if *input.Quantity <= 0 {
+			return fmt.Errorf("quantity must be greater than zero")
+		}
+		item.Quantity = *input.Quantity
+	}
+	if input.UnitPrice != nil {
+		if *input.UnitPrice < 0 {
+			return fmt.Errorf("unit price cannot be negative")
+		}
+		item.UnitPrice = *input.UnitPrice
+	}
+
+	switch {
+	case input.TotalPrice != nil:
+		if *input.TotalPrice < 0 {
+			return fmt.Errorf("total price cannot be negative")
+		}
+		item.TotalPrice = *input.TotalPrice
+		if input.UnitPrice == nil && item.Quantity > 0 {
+			item.UnitPrice = utils.RoundCents(item.TotalPrice / item.Quantity)
+		}
+	case input.Quantity != nil || input.UnitPrice != nil:
+		item.TotalPrice = utils.RoundCents(item.Quantity * item.UnitPrice)
+	}
+
+	if item.ID == 0 && item.TotalPrice == 0 {
+		return fmt.Errorf("total price is required")
+	}
+
+	if input.Category != nil || input.Subcategory != nil {
+		categoryName := ""
+		if input.Category != nil {
+			categoryName = strings.TrimSpace(*input.Category)
+		} else if item.Category != nil {
+			categoryName = item.Category.Name
+		}
+		subcategoryName := ""
+		if input.Subcategory != nil {
+			subcategoryName = strings.TrimSpace(*input.Subcategory)
+		} else if item.Subcategory != nil && item.Category != nil && item.Category.Name == categoryName {
+			subcategoryName = item.Subcategory.Name
+		}
+
+		if err := h.resolveItemCategory(item, categoryName, subcategoryName); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resolveItemCategory sets the category references from names, rejecting
+// names that do not exist.
+func (h *ReceiptHandler) resolveItemCategory(item *models.ReceiptItem, categoryName, subcategoryName string) error {
+	item.CategoryID = nil
+	item.SubcategoryID = nil
+	item.Category = nil
+	item.Subcategory = nil
+
+	if categoryName == "" {
+		if subcategoryName != "" {
+			return fmt.Errorf("subcategory requires a category")
+		}
+		return nil
+	}
+
+	category, err := h.categoryRepo.GetByName(categoryName)
+	if err != nil {
+		return fmt.Errorf("unknown category %q", categoryName)
+	}
+	item.CategoryID = &category.ID
+
+	if subcategoryName == "" {
+		return nil
+	}
+	subcategory, err := h.categoryRepo.GetSubcategoryByName(category.ID, subcategoryName)
+	if err != nil {
+		return fmt.Errorf("unknown subcategory %q in %s", subcategoryName, categoryName)
+	}
+	item.SubcategoryID = &subcategory.ID
+
+	return nil
+}
+
+// unlinkProduct drops the product of a renamed item so it is resolved again.
+// Items with a barcode keep theirs.
+func unlinkProduct(item *models.ReceiptItem) {
+	if !normalize.IsGTIN(item.Barcode) {
+		item.ProductID = nil
+	}
+}
+
+// parseEditedDate accepts an empty string to clear the date.
+func parseEditedDate(value string) (*time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	date := utils.ParseReceiptDate(value)
+	if date == nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid date, expected YYYY-MM-DD or RFC 3339")
+	}
+	return date, nil
+}
+
+func sameDate(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
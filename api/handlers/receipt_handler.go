@@ -3,14 +3,24 @@ package handlers
 import (
 	"buybuddy-api/config"
 	"buybuddy-api/database"
+	"buybuddy-api/fiscal"
+	"buybuddy-api/jobs"
+	"buybuddy-api/llm"
 	"buybuddy-api/models"
+	"buybuddy-api/nfce"
+	"buybuddy-api/normalize"
 	"buybuddy-api/repository"
+	"buybuddy-api/storage"
 	"buybuddy-api/utils"
+	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 )
 
@@ -18,13 +28,33 @@ type ReceiptHandler struct {
 	cfg          *config.Config
 	receiptRepo  *repository.ReceiptRepository
 	categoryRepo *repository.CategoryRepository
+	imageRepo    *repository.ReceiptImageRepository
+	storeRepo    *repository.StoreRepository
+	productRepo  *repository.ProductRepository
+	mappingRepo  *repository.ItemMappingRepository
+	ruleRepo     *repository.NormalizationRuleRepository
+	jobRepo      *repository.ReceiptJobRepository
+	jobs         *jobs.Runner
+	store        storage.Store
+	llms         *llm.Registry
+	nfceClient   *nfce.Client
 }
 
-func NewReceiptHandler(cfg *config.Config, receiptRepo *repository.ReceiptRepository, categoryRepo *repository.CategoryRepository) *ReceiptHandler {
+func NewReceiptHandler(cfg *config.Config, receiptRepo *repository.ReceiptRepository, categoryRepo *repository.CategoryRepository, imageRepo *repository.ReceiptImageRepository, storeRepo *repository.StoreRepository, productRepo *repository.ProductRepository, mappingRepo *repository.ItemMappingRepository, ruleRepo *repository.NormalizationRuleRepository, jobRepo *repository.ReceiptJobRepository, jobRunner *jobs.Runner, store storage.Store, llms *llm.Registry) *ReceiptHandler {
 	return &ReceiptHandler{
 		cfg:          cfg,
 		receiptRepo:  receiptRepo,
 		categoryRepo: categoryRepo,
+		imageRepo:    imageRepo,
+		storeRepo:    storeRepo,
+		productRepo:  productRepo,
+		mappingRepo:  mappingRepo,
+		ruleRepo:     ruleRepo,
+		jobRepo:      jobRepo,
+		jobs:         jobRunner,
+		store:        store,
+		llms:         llms,
+		nfceClient:   nfce.NewClient(cfg.NFCePortalURL),
 	}
 }
 
@@ -36,66 +66,64 @@ func (h *ReceiptHandler) ProcessReceipt(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
 	}
 
-	imageData, err := base64.StdEncoding.DecodeString(req.Image)
+	parts, err := decodeReceiptPages(req)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, "invalid image data")
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
-	geminiKey := h.cfg.GeminiAPIKey
-	if geminiKey == "" {
-		return echo.NewHTTPError(http.StatusInternalServerError, "Gemini API key not configured")
-	}
+	// Keep the originals even if extraction fails so errors can be audited.
+	uploadID := h.storeOriginals(c.Request().Context(), userID, parts)
 
-	categories, err := h.categoryRepo.GetAll()
+	receiptData, err := h.extractReceipt(c.Request().Context(), userID, req.StoreID, parts, h.resolveReceiptModel(userID))
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch categories")
+		return err
 	}
 
-	categoryInfos := make([]utils.CategoryInfo, len(categories))
-	for i, cat := range categories {
-		subcats := make([]string, len(cat.Subcategories))
-		for j, subcat := range cat.Subcategories {
-			subcats[j] = subcat.Name
-		}
-		categoryInfos[i] = utils.CategoryInfo{
-			Name:          cat.Name,
-			Subcategories: subcats,
-		}
-	}
+	receiptData.UploadID = uploadID
 
-	// Get user's previous receipt items for learning
-	receipts, err := h.receiptRepo.GetByUserID(userID)
-	if err != nil {
-		receipts = []models.Receipt{} // Continue even if we can't get history
-	}
+	fmt.Printf("User %s processed receipt: %+v\n", userID, receiptData)
 
-	itemMappings := make([]utils.ItemMapping, 0)
-	for _, receipt := range receipts {
-		for _, item := range receipt.Items {
-			itemMappings = append(itemMappings, utils.ItemMapping{
-				RawName: item.RawName,
-				Name:    item.Name,
-			})
-		}
+	return c.JSON(http.StatusOK, receiptData)
+}
+
+// ImportQRCode reads the receipt from the state consultation page the NFC-e
+// QR code points to. The result has the same shape as ProcessReceipt so the
+// app can reuse its confirm-and-save flow.
+func (h *ReceiptHandler) ImportQRCode(c echo.Context) error {
+	userID := c.Get("userID").(string)
+
+	var req models.ImportQRCodeRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
 	}
 
-	var prefs models.UserPreferences
-	database.DB.Where("user_id = ?", userID).First(&prefs)
-	receiptModel := prefs.ReceiptModel
-	if receiptModel == "" {
-		receiptModel = "gemini-2.5-flash"
+	qr, err := nfce.ParseQRCode(req.QRCode)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
-	receiptData, err := utils.ProcessReceiptWithGemini(c.Request().Context(), imageData, geminiKey, categoryInfos, itemMappings, receiptModel)
+	nfceReceipt, err := h.nfceClient.Fetch(c.Request().Context(), qr)
 	if err != nil {
-		fmt.Println("Gemini processing error:", err)
-		return echo.NewHTTPError(http.StatusBadRequest, map[string]string{
-			"message": "Could not extract information from the receipt. Please make sure the image is clear and contains a valid receipt.",
+		fmt.Println("NFC-e import error:", err)
+		return echo.NewHTTPError(http.StatusBadGateway, map[string]string{
+			"message": "Could not read the receipt from the state portal. Please try again later or scan the receipt photo instead.",
 			"error":   err.Error(),
 		})
 	}
 
-	fmt.Printf("User %s processed receipt: %+v\n", userID, receiptData)
+	rawNames := make([]string, len(nfceReceipt.Items))
+	for i, item := range nfceReceipt.Items {
+		rawNames[i] = item.Name
+	}
+
+	receiptData := receiptDataFromNFCe(nfceReceipt, h.learnedNames(userID, rawNames))
+	h.loadRules(userID).ApplyToData(receiptData)
+	checkAccessKey(receiptData)
+
+	reconciliation := utils.ReconcileReceiptData(receiptData)
+	receiptData.Reconciliation = &reconciliation
+
+	fmt.Printf("User %s imported NFC-e %s\n", userID, receiptData.AccessKey)
 
 	return c.JSON(http.StatusOK, receiptData)
 }
@@ -108,14 +136,24 @@ func (h *ReceiptHandler) SaveReceipt(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
 	}
 
+	var accessKey *fiscal.AccessKey
 	if req.AccessKey != "" {
-		exists, err := h.receiptRepo.ExistsByAccessKey(req.AccessKey, userID)
+		var err error
+		accessKey, err = fiscal.Parse(req.AccessKey)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, map[string]string{
+				"message": "Invalid access key",
+				"error":   err.Error(),
+			})
+		}
+		req.AccessKey = accessKey.Key
+
+		exists, existing, err := h.findByAccessKey(req.AccessKey, userID)
 		if err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, "failed to check for duplicate receipt")
 		}
 		if exists {
-			existing, err := h.receiptRepo.GetByAccessKey(req.AccessKey, userID)
-			if err == nil {
+			if existing != nil {
 				return echo.NewHTTPError(http.StatusConflict, map[string]interface{}{
 					"message": "This receipt has already been saved",
 					"receipt": existing,
@@ -129,8 +167,14 @@ func (h *ReceiptHandler) SaveReceipt(c echo.Context) error {
 		UserID:    userID,
 		Company:   req.Company,
 		Total:     req.Total,
+		Discount:  req.Discount,
 		AccessKey: req.AccessKey,
 		Items:     []models.ReceiptItem{},
+
+		TaxAmount:     req.TaxAmount,
+		PaymentMethod: utils.NormalizePaymentMethod(req.PaymentMethod),
+		AmountPaid:    req.AmountPaid,
+		Change:        req.Change,
 	}
 
 	if req.Date != "" {
@@ -139,107 +183,164 @@ func (h *ReceiptHandler) SaveReceipt(c echo.Context) error {
 		}
 	}
 
-	for _, item := range req.Items {
-		rawName := getStringFromMap(item, "rawName")
-
-		var name string
-		if customName := getStringFromMap(item, "customName"); customName != "" {
-			name = customName
-		} else if itemName := getStringFromMap(item, "name"); itemName != "" {
-			name = itemName
-		} else if nameOptions, ok := item["nameOptions"].([]interface{}); ok && len(nameOptions) > 0 {
-			if firstOption, ok := nameOptions[0].(string); ok {
-				name = firstOption
-			}
-		}
+	if accessKey != nil {
+		applyAccessKey(receipt, accessKey)
+	}
 
-		if rawName == "" {
-			rawName = name
-		}
-		if name == "" {
-			name = rawName
+	if req.UploadID != "" {
+		hasUpload, err := h.imageRepo.UploadExists(req.UploadID, userID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to check receipt images")
 		}
-
-		receiptItem := models.ReceiptItem{
-			RawName:    rawName,
-			Name:       name,
-			Brand:      getStringFromMap(item, "brand"),
-			Quantity:   getFloatFromMap(item, "quantity", 1.0),
-			Unit:       getStringFromMap(item, "unit"),
-			UnitPrice:  getFloatFromMap(item, "unitPrice", 0.0),
-			TotalPrice: getFloatFromMap(item, "totalPrice", 0.0),
-			Barcode:    getStringFromMap(item, "barcode"),
+		if hasUpload {
+			receipt.ID = uuid.New().String()
+			receipt.ImageURL = fmt.Sprintf("/api/receipts/%s/image", receipt.ID)
 		}
+	}
 
-		if receiptItem.Unit == "" {
-			receiptItem.Unit = "un"
-		}
+	for _, item := range req.Items {
+		receipt.Items = append(receipt.Items, h.buildReceiptItem(item))
+	}
 
-		// Try to get category from categoryOptions array (first option)
-		categoryName := ""
-		subcategoryName := ""
+	h.assignStore(receipt, models.StoreDetails{})
 
-		if categoryOptions, ok := item["categoryOptions"].([]interface{}); ok && len(categoryOptions) > 0 {
-			if firstCatOption, ok := categoryOptions[0].(map[string]interface{}); ok {
-				categoryName = getStringFromMap(firstCatOption, "category")
-				subcategoryName = getStringFromMap(firstCatOption, "subcategory")
-			}
+	// Without an access key, rescans are caught by comparing the store,
+	// date, total and items with recent receipts.
+	if receipt.AccessKey == "" && !req.Force {
+		candidates, err := h.receiptRepo.FindDuplicateCandidates(userID, receipt.Date, receipt.Total, utils.DuplicateWindow)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to check for duplicate receipt")
 		}
-
-		// Fallback to old format if categoryOptions not found
-		if categoryName == "" {
-			categoryName = getStringFromMap(item, "category")
-			subcategoryName = getStringFromMap(item, "subcategory")
+		if duplicates := utils.FindDuplicates(receipt, candidates); len(duplicates) > 0 {
+			return echo.NewHTTPError(http.StatusConflict, map[string]interface{}{
+				"message":    "This receipt looks like one already saved. Save again with force to keep both.",
+				"candidates": duplicates,
+			})
 		}
+	}
 
-		if categoryName != "" {
-			category, err := h.categoryRepo.GetByName(categoryName)
-			if err == nil {
-				receiptItem.CategoryID = &category.ID
+	h.assignProducts(userID, receipt.Items)
+	utils.MeasureItems(receipt.Items)
 
-				if subcategoryName != "" {
-					subcategory, err := h.categoryRepo.GetSubcategoryByName(category.ID, subcategoryName)
-					if err == nil {
-						receiptItem.SubcategoryID = &subcategory.ID
-					}
-				}
-			}
-		}
-
-		receipt.Items = append(receipt.Items, receiptItem)
-	}
+	utils.ApplyReconciliation(receipt, receipt.Items)
 
 	if err := h.receiptRepo.Create(receipt); err != nil {
 		fmt.Println("Error saving receipt:", err)
 		return echo.NewHTTPError(http.StatusInternalServerError, "failed to save receipt")
 	}
 
+	if receipt.ImageURL != "" {
+		if _, err := h.imageRepo.AttachToReceipt(req.UploadID, userID, receipt.ID); err != nil {
+			fmt.Println("Error linking receipt images:", err)
+		}
+	}
+
+	// Names typed on the confirm screen are corrections; see buildReceiptItem.
+	var accepted, corrected []models.ReceiptItem
+	for _, item := range receipt.Items {
+		if item.ReviewedAt != nil {
+			corrected = append(corrected, item)
+		} else {
+			accepted = append(accepted, item)
+		}
+	}
+	h.learnItemNames(receipt, accepted, false)
+	h.learnItemNames(receipt, corrected, true)
 	utils.GetFirstReceiptCache().Invalidate(userID)
 
 	return c.JSON(http.StatusCreated, receipt)
 }
 
-func (h *ReceiptHandler) GetReceipts(c echo.Context) error {
+func (h *ReceiptHandler) GetReceipt(c echo.Context) error {
+	userID := c.Get("userID").(string)
+	receiptID := c.Param("id")
+
+	receipt, err := h.receiptRepo.GetByID(receiptID, userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "receipt not found")
+	}
+
+	return c.JSON(http.StatusOK, receipt)
+}
+
+// GetReceiptImages lists the stored pages of a receipt.
+func (h *ReceiptHandler) GetReceiptImages(c echo.Context) error {
 	userID := c.Get("userID").(string)
+	receiptID := c.Param("id")
 
-	receipts, err := h.receiptRepo.GetByUserID(userID)
+	images, err := h.imageRepo.GetByReceiptID(receiptID, userID)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch receipts")
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch receipt images")
 	}
 
-	return c.JSON(http.StatusOK, receipts)
+	return c.JSON(http.StatusOK, images)
 }
 
-func (h *ReceiptHandler) GetReceipt(c echo.Context) error {
+// GetReceiptImage serves a stored original (?page=N, default 1). With
+// ?size=thumb it serves a JPEG thumbnail, generated on first request and kept
+// next to the original; formats that can't be decoded fall back to the original.
+func (h *ReceiptHandler) GetReceiptImage(c echo.Context) error {
 	userID := c.Get("userID").(string)
 	receiptID := c.Param("id")
+	ctx := c.Request().Context()
 
-	receipt, err := h.receiptRepo.GetByID(receiptID, userID)
+	page := 1
+	if pageParam := c.QueryParam("page"); pageParam != "" {
+		parsed, err := strconv.Atoi(pageParam)
+		if err != nil || parsed < 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid page")
+		}
+		page = parsed
+	}
+
+	image, err := h.imageRepo.GetPage(receiptID, userID, page)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusNotFound, "receipt not found")
+		return echo.NewHTTPError(http.StatusNotFound, "image not found")
 	}
 
-	return c.JSON(http.StatusOK, receipt)
+	c.Response().Header().Set("Cache-Control", "private, max-age=86400")
+
+	if c.QueryParam("size") == "thumb" {
+		if image.ThumbnailKey != "" {
+			if thumb, err := h.store.Get(ctx, image.ThumbnailKey); err == nil {
+				return c.Blob(http.StatusOK, utils.MIMETypeJPEG, thumb)
+			}
+		}
+
+		original, err := h.loadImage(ctx, image)
+		if err != nil {
+			return err
+		}
+
+		thumb, err := utils.GenerateThumbnail(original, utils.ThumbnailSize)
+		if err != nil {
+			return c.Blob(http.StatusOK, image.MIMEType, original)
+		}
+
+		image.ThumbnailKey = image.StorageKey + ".thumb.jpg"
+		if err := h.store.Put(ctx, image.ThumbnailKey, thumb, utils.MIMETypeJPEG); err == nil {
+			h.imageRepo.Update(image)
+		}
+		return c.Blob(http.StatusOK, utils.MIMETypeJPEG, thumb)
+	}
+
+	original, err := h.loadImage(ctx, image)
+	if err != nil {
+		return err
+	}
+	return c.Blob(http.StatusOK, image.MIMEType, original)
+}
+
+func (h *ReceiptHandler) loadImage(ctx context.Context, image *models.ReceiptImage) ([]byte, error) {
+	data, err := h.store.Get(ctx, image.StorageKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "image not found")
+	}
+	if err != nil {
+		fmt.Println("Error loading receipt image:", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "failed to load image")
+	}
+	return data, nil
 }
 
 func (h *ReceiptHandler) DeleteReceipt(c echo.Context) error {
@@ -255,6 +356,454 @@ func (h *ReceiptHandler) DeleteReceipt(c echo.Context) error {
 	return c.JSON(http.StatusOK, map[string]string{"message": "receipt deleted"})
 }
 
+const maxReceiptPages = 6
+
+// decodeReceiptPages decodes the uploaded photos/PDFs and detects their types.
+func decodeReceiptPages(req models.ProcessReceiptRequest) ([]utils.ReceiptPart, error) {
+	pages := req.Pages
+	if len(pages) == 0 && req.Image != "" {
+		pages = []models.ReceiptPage{{Data: req.Image}}
+	}
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("at least one image is required")
+	}
+	if len(pages) > maxReceiptPages {
+		return nil, fmt.Errorf("at most %d pages can be processed at once", maxReceiptPages)
+	}
+
+	parts := make([]utils.ReceiptPart, 0, len(pages))
+	for i, page := range pages {
+		data, err := base64.StdEncoding.DecodeString(page.Data)
+		if err != nil || len(data) == 0 {
+			return nil, fmt.Errorf("invalid image data in page %d", i+1)
+		}
+
+		mimeType, err := utils.DetectMIMEType(data, page.MimeType)
+		if err != nil {
+			return nil, fmt.Errorf("page %d: %w", i+1, err)
+		}
+
+		parts = append(parts, utils.ReceiptPart{MIMEType: mimeType, Data: data})
+	}
+
+	return parts, nil
+}
+
+// buildReceiptItem turns an item map from the extraction response (or the
+// app's edited copy of it) into a ReceiptItem, resolving category names.
+func (h *ReceiptHandler) buildReceiptItem(item map[string]interface{}) models.ReceiptItem {
+	rawName := getStringFromMap(item, "rawName")
+	name := utils.ItemName(item)
+
+	if rawName == "" {
+		rawName = name
+	}
+	if name == "" {
+		name = rawName
+	}
+
+	receiptItem := models.ReceiptItem{
+		RawName:    rawName,
+		Name:       name,
+		Brand:      getStringFromMap(item, "brand"),
+		Quantity:   getFloatFromMap(item, "quantity", 1.0),
+		Unit:       getStringFromMap(item, "unit"),
+		UnitPrice:  getFloatFromMap(item, "unitPrice", 0.0),
+		TotalPrice: getFloatFromMap(item, "totalPrice", 0.0),
+		Discount:   getFloatFromMap(item, "discount", 0.0),
+		TaxAmount:  getFloatFromMap(item, "taxAmount", 0.0),
+		Barcode:    getStringFromMap(item, "barcode"),
+
+		NameOptions:     utils.ItemNameOptions(item),
+		CategoryOptions: utils.ItemCategoryOptions(item),
+		Confidence:      utils.ItemConfidence(item),
+	}
+
+	if receiptItem.Unit == "" {
+		receiptItem.Unit = "un"
+	}
+
+	// A name the user typed while confirming the receipt needs no review.
+	if getStringFromMap(item, "customName") != "" {
+		now := time.Now()
+		receiptItem.ReviewedAt = &now
+	}
+
+	categoryName, subcategoryName := utils.ItemCategory(item)
+
+	if categoryName != "" {
+		category, err := h.categoryRepo.GetByName(categoryName)
+		if err == nil {
+			receiptItem.CategoryID = &category.ID
+
+			if subcategoryName != "" {
+				subcategory, err := h.categoryRepo.GetSubcategoryByName(category.ID, subcategoryName)
+				if err == nil {
+					receiptItem.SubcategoryID = &subcategory.ID
+				}
+			}
+		}
+	}
+
+	return receiptItem
+}
+
+// assignStore links the receipt to the user's store for its issuer CNPJ or,
+// without one, its company name. details adds what the receipt itself doesn't
+// carry, such as the address. Failures leave the receipt unlinked.
+func (h *ReceiptHandler) assignStore(receipt *models.Receipt, details models.StoreDetails) {
+	details.CNPJ = receipt.IssuerCNPJ
+	details.Company = receipt.Company
+	if details.State == "" {
+		details.State = receipt.State
+	}
+
+	store, err := h.storeRepo.Resolve(receipt.UserID, details)
+	if err != nil {
+		fmt.Println("Error resolving store:", err)
+		return
+	}
+
+	receipt.Store = store
+	receipt.StoreID = nil
+	if store != nil {
+		receipt.StoreID = &store.ID
+	}
+}
+
+// assignProducts links items without a product to the user's product for
+// their barcode or normalized name. Failures leave the item unlinked.
+func (h *ReceiptHandler) assignProducts(userID string, items []models.ReceiptItem) {
+	for i := range items {
+		if items[i].ProductID != nil {
+			continue
+		}
+
+		gtin := ""
+		if normalize.IsGTIN(items[i].Barcode) {
+			gtin = items[i].Barcode
+		}
+
+		product, err := h.productRepo.Resolve(userID, gtin, items[i].Name, items[i].Brand)
+		if err != nil {
+			fmt.Println("Error resolving product:", err)
+			continue
+		}
+		if product != nil {
+			items[i].ProductID = &product.ID
+		}
+	}
+}
+
+// resolveReceiptModel returns the user's preferred receipt model, or the
+// default when the preference is unset or no longer offered.
+func (h *ReceiptHandler) resolveReceiptModel(userID string) string {
+	var prefs models.UserPreferences
+	database.DB.Where("user_id = ?", userID).First(&prefs)
+	if !h.llms.IsReceiptModel(prefs.ReceiptModel) {
+		return h.llms.DefaultReceiptModel()
+	}
+	return prefs.ReceiptModel
+}
+
+// extractReceipt runs the receipt model over the pages, with the category list
+// and the user's learned item names in the prompt. Errors are returned as HTTP
+// errors.
+func (h *ReceiptHandler) extractReceipt(ctx context.Context, userID string, storeID *uint, parts []utils.ReceiptPart, modelName string) (*utils.ReceiptData, error) {
+	receiptData, err := h.runExtraction(ctx, userID, storeID, parts, modelName)
+	if err != nil {
+		var httpErr *echo.HTTPError
+		if errors.As(err, &httpErr) {
+			return nil, err
+		}
+		fmt.Println("Receipt extraction error:", err)
+		body := map[string]string{
+			"message": "Could not extract information from the receipt. Please make sure the image is clear and contains a valid receipt.",
+			"error":   err.Error(),
+		}
+		if raw, ok := llm.RawOutput(err); ok {
+			body["rawOutput"] = raw
+		}
+		return nil, echo.NewHTTPError(http.StatusBadRequest, body)
+	}
+	return receiptData, nil
+}
+
+// runExtraction is extractReceipt without the HTTP error mapping: setup
+// failures come back as HTTP errors and model failures as they are, so
+// background jobs can tell transient ones apart.
+func (h *ReceiptHandler) runExtraction(ctx context.Context, userID string, storeID *uint, parts []utils.ReceiptPart, modelName string) (*utils.ReceiptData, error) {
+	extractor, model, err := h.llms.Receipt(modelName)
+	if err != nil {
+		if errors.Is(err, llm.ErrNoModel) {
+			return nil, echo.NewHTTPError(http.StatusInternalServerError, "no receipt model is configured")
+		}
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "unknown receipt model")
+	}
+
+	categoryInfos, err := h.categoryInfos()
+	if err != nil {
+		return nil, err
+	}
+
+	itemMappings := h.loadItemMappings(userID, storeID)
+
+	receiptData, err := utils.ExtractReceipt(ctx, extractor, model, parts, categoryInfos, itemMappings)
+	if err != nil {
+		return nil, err
+	}
+
+	h.loadRules(userID).ApplyToData(receiptData)
+
+	checkAccessKey(receiptData)
+
+	reconciliation := utils.ReconcileReceiptData(receiptData)
+	receiptData.Reconciliation = &reconciliation
+
+	return receiptData, nil
+}
+
+// categoryInfos lists the categories for the model prompts.
+func (h *ReceiptHandler) categoryInfos() ([]utils.CategoryInfo, error) {
+	categories, err := h.categoryRepo.GetAll()
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch categories")
+	}
+
+	categoryInfos := make([]utils.CategoryInfo, len(categories))
+	for i, cat := range categories {
+		subcats := make([]string, len(cat.Subcategories))
+		for j, subcat := range cat.Subcategories {
+			subcats[j] = subcat.Name
+		}
+		categoryInfos[i] = utils.CategoryInfo{
+			Name:          cat.Name,
+			Subcategories: subcats,
+		}
+	}
+	return categoryInfos, nil
+}
+
+// storeOriginals saves the uploaded pages to blob storage and returns the
+// upload ID to link them to the receipt on save. Storage failures are logged
+// and don't block processing.
+func (h *ReceiptHandler) storeOriginals(ctx context.Context, userID string, parts []utils.ReceiptPart) string {
+	uploadID := uuid.New().String()
+
+	images := make([]models.ReceiptImage, 0, len(parts))
+	for i, part := range parts {
+		key := fmt.Sprintf("receipts/%s/%s/page-%d%s", userID, uploadID, i+1, utils.ExtensionForMIMEType(part.MIMEType))
+		if err := h.store.Put(ctx, key, part.Data, part.MIMEType); err != nil {
+			fmt.Println("Error storing receipt image:", err)
+			h.discardOriginals(ctx, images)
+			return ""
+		}
+		images = append(images, models.ReceiptImage{
+			UserID:     userID,
+			UploadID:   uploadID,
+			Page:       i + 1,
+			MIMEType:   part.MIMEType,
+			Size:       len(part.Data),
+			StorageKey: key,
+		})
+	}
+
+	if err := h.imageRepo.Create(images); err != nil {
+		fmt.Println("Error saving receipt image records:", err)
+		h.discardOriginals(ctx, images)
+		return ""
+	}
+
+	return uploadID
+}
+
+// discardOriginals deletes pages stored for an upload whose records could not
+// be saved; without records, the purge of unsaved uploads can't find them.
+func (h *ReceiptHandler) discardOriginals(ctx context.Context, images []models.ReceiptImage) {
+	keys := make([]string, len(images))
+	for i, image := range images {
+		keys[i] = image.StorageKey
+	}
+	if err := storage.DeleteAll(ctx, h.store, keys); err != nil {
+		fmt.Println("Error deleting stored receipt images:", err)
+	}
+}
+
+// findByAccessKey reports whether the user already saved a receipt with this
+// access key and returns it when it can be loaded.
+func (h *ReceiptHandler) findByAccessKey(accessKey, userID string) (bool, *models.Receipt, error) {
+	exists, err := h.receiptRepo.ExistsByAccessKey(accessKey, userID)
+	if err != nil || !exists {
+		return exists, nil, err
+	}
+
+	existing, err := h.receiptRepo.GetByAccessKey(accessKey, userID)
+	if err != nil {
+		return true, nil, nil
+	}
+	return true, existing, nil
+}
+
+// maxPromptMappings caps the learned names put in the receipt prompt.
+const maxPromptMappings = 150
+
+// loadItemMappings returns the user's learned names most relevant to a
+// receipt from storeID, which may be unknown.
+func (h *ReceiptHandler) loadItemMappings(userID string, storeID *uint) []utils.ItemMapping {
+	mappings, err := h.mappingRepo.Top(userID, storeID, maxPromptMappings)
+	if err != nil {
+		fmt.Println("Error loading item mappings:", err)
+		return []utils.ItemMapping{} // Continue even if we can't get history
+	}
+
+	itemMappings := make([]utils.ItemMapping, len(mappings))
+	for i, mapping := range mappings {
+		itemMappings[i] = utils.ItemMapping{
+			RawName: mapping.RawName,
+			Name:    mapping.Name,
+		}
+	}
+	return itemMappings
+}
+
+// learnedNames looks up the learned names of the raw names, keyed by
+// normalize.Key.
+func (h *ReceiptHandler) learnedNames(userID string, rawNames []string) map[string]string {
+	learned, err := h.mappingRepo.Lookup(userID, rawNames)
+	if err != nil {
+		fmt.Println("Error looking up item mappings:", err)
+		return map[string]string{}
+	}
+	return learned
+}
+
+// learnItemNames records the names of saved items as mappings. Failures are
+// logged; the receipt is already saved.
+func (h *ReceiptHandler) learnItemNames(receipt *models.Receipt, items []models.ReceiptItem, corrected bool) {
+	if err := h.mappingRepo.Record(receipt.UserID, receipt.StoreID, items, corrected); err != nil {
+		fmt.Println("Error learning item names:", err)
+	}
+}
+
+// loadRules returns the user's normalization rules. Extraction goes on
+// without them if they can't be loaded.
+func (h *ReceiptHandler) loadRules(userID string) *utils.RuleSet {
+	rules, err := h.ruleRepo.GetByUserID(userID)
+	if err != nil {
+		fmt.Println("Error loading normalization rules:", err)
+	}
+	return utils.NewRuleSet(rules)
+}
+
+// applyRules rewrites items the user's rules match, for receipts that are
+// saved without the confirm step.
+func (h *ReceiptHandler) applyRules(userID string, items []models.ReceiptItem) {
+	ruleSet := h.loadRules(userID)
+	for i := range items {
+		rule := ruleSet.Match(items[i].RawName)
+		if rule == nil {
+			continue
+		}
+		if rule.Name != "" {
+			items[i].Name = rule.Name
+		}
+		if rule.Brand != "" {
+			items[i].Brand = rule.Brand
+		}
+		if rule.Category != "" {
+			h.setItemCategory(&items[i], rule.Category, rule.Subcategory)
+		}
+	}
+}
+
+// receiptDataFromNFCe converts a parsed consultation page into the item maps
+// ProcessReceipt returns. Names the user has corrected before are offered as
+// the first name option.
+func receiptDataFromNFCe(receipt *nfce.Receipt, learned map[string]string) *utils.ReceiptData {
+	data := &utils.ReceiptData{
+		Company:   receipt.Company,
+		Total:     receipt.Total,
+		Discount:  receipt.Discount,
+		AccessKey: receipt.AccessKey,
+		Items:     make([]map[string]interface{}, 0, len(receipt.Items)),
+
+		TaxAmount:     receipt.TaxAmount,
+		PaymentMethod: utils.NormalizePaymentMethod(receipt.PaymentMethod),
+		AmountPaid:    receipt.AmountPaid,
+		Change:        receipt.Change,
+	}
+	if data.Company == "" {
+		data.Company = "Unknown Company"
+	}
+	if receipt.Date != nil {
+		data.Date = receipt.Date.Format(time.RFC3339)
+	}
+
+	for _, item := range receipt.Items {
+		nameOptions := []string{item.Name}
+		if name, ok := learned[normalize.Key(item.Name)]; ok {
+			nameOptions = []string{name, item.Name}
+		}
+
+		entry := map[string]interface{}{
+			"rawName":     item.Name,
+			"nameOptions": nameOptions,
+			"quantity":    item.Quantity,
+			"unit":        item.Unit,
+			"unitPrice":   item.UnitPrice,
+			"totalPrice":  item.TotalPrice,
+		}
+		if item.Discount > 0 {
+			entry["discount"] = item.Discount
+		}
+		if item.Code != "" {
+			entry["code"] = item.Code
+		}
+		if normalize.IsGTIN(item.Code) {
+			entry["barcode"] = item.Code
+		}
+		data.Items = append(data.Items, entry)
+	}
+
+	return data
+}
+
+// checkAccessKey validates the extracted access key and repairs common OCR
+// mistakes in place. Keys that cannot be repaired are kept as read, flagged
+// "invalid", so the user can fix them before saving.
+func checkAccessKey(data *utils.ReceiptData) {
+	if data.AccessKey == "" {
+		return
+	}
+
+	result, err := fiscal.Repair(data.AccessKey, utils.ParseReceiptDate(data.Date))
+	if err != nil {
+		data.AccessKeyStatus = "invalid"
+		data.AccessKeyCandidates = result.Candidates
+		return
+	}
+
+	if result.Repaired {
+		data.AccessKeyStatus = "repaired"
+		data.AccessKeyOriginal = data.AccessKey
+	} else {
+		data.AccessKeyStatus = "valid"
+	}
+	data.AccessKey = result.Key.Key
+}
+
+// applyAccessKey copies the fields decoded from the access key onto the receipt.
+func applyAccessKey(receipt *models.Receipt, key *fiscal.AccessKey) {
+	receipt.AccessKey = key.Key
+	receipt.IssuerCNPJ = key.CNPJ
+	receipt.State = key.State
+	receipt.EmissionMonth = key.EmissionMonth()
+	receipt.FiscalModel = key.Model
+	receipt.Series = key.Series
+	receipt.Number = key.Number
+	receipt.EmissionType = key.EmissionType
+}
+
 func getStringFromMap(m map[string]interface{}, key string) string {
 	if val, ok := m[key]; ok {
 		if str, ok := val.(string); ok {
@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"archive/zip"
+	"buybuddy-api/fiscal"
+	"buybuddy-api/models"
+	"buybuddy-api/normalize"
+	"buybuddy-api/utils"
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	maxImportUploadSize = 50 << 20
+	maxImportXMLSize    = 5 << 20
+	// maxImportXMLTotal caps the XML read from one import once zip
+	// archives are expanded.
+	maxImportXMLTotal = 200 << 20
+	maxImportFiles    = 1000
+)
+
+const (
+	importStatusImported  = "imported"
+	importStatusDuplicate = "duplicate"
+	importStatusFailed    = "failed"
+)
+
+// ImportXML saves receipts from authorized NF-e/NFC-e XML files. It accepts
+// multipart uploads ("file"/"files") or a raw XML or zip body, and zip
+// archives are expanded so a whole mailbox export can be sent at once.
+func (h *ReceiptHandler) ImportXML(c echo.Context) error {
+	userID := c.Get("userID").(string)
+
+	uploads, err := readImportUploads(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if len(uploads) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "no XML or zip file provided")
+	}
+
+	response := models.ImportResponse{Results: []models.ImportResult{}}
+	total := 0
+	for _, upload := range uploads {
+		// Zip entries are read one at a time, as they are imported.
+		var result models.ImportResult
+		data, err := upload.read()
+		if err == nil {
+			total += len(data)
+			if total > maxImportXMLTotal {
+				err = fmt.Errorf("import too large, at most %d MB of XML per import", maxImportXMLTotal>>20)
+			}
+		}
+		if err != nil {
+			result = models.ImportResult{File: upload.name, Status: importStatusFailed, Error: err.Error()}
+		} else {
+			result = h.importXMLDocument(userID, upload.name, data)
+		}
+		switch result.Status {
+		case importStatusImported:
+			response.Imported++
+		case importStatusDuplicate:
+			response.Duplicates++
+		default:
+			response.Failed++
+		}
+		response.Results = append(response.Results, result)
+	}
+
+	if response.Imported > 0 {
+		utils.GetFirstReceiptCache().Invalidate(userID)
+	}
+
+	fmt.Printf("User %s imported XML: %d imported, %d duplicates, %d failed\n", userID, response.Imported, response.Duplicates, response.Failed)
+
+	return c.JSON(http.StatusOK, response)
+}
+
+func (h *ReceiptHandler) importXMLDocument(userID, name string, data []byte) models.ImportResult {
+	result := models.ImportResult{File: name, Status: importStatusFailed}
+
+	doc, err := fiscal.ParseXML(bytes.NewReader(data))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.AccessKey = doc.AccessKey
+
+	key, err := fiscal.Parse(doc.AccessKey)
+	if err != nil {
+		result.Error = "invalid access key: " + err.Error()
+		return result
+	}
+
+	exists, existing, err := h.findByAccessKey(key.Key, userID)
+	if err != nil {
+		result.Error = "failed to check for duplicate receipt"
+		return result
+	}
+	if exists {
+		result.Status = importStatusDuplicate
+		if existing != nil {
+			result.ReceiptID = existing.ID
+		}
+		return result
+	}
+
+	rawNames := make([]string, len(doc.Items))
+	for i, item := range doc.Items {
+		rawNames[i] = item.Name
+	}
+
+	receipt := receiptFromDocument(userID, doc, h.learnedNames(userID, rawNames))
+	applyAccessKey(receipt, key)
+	h.applyRules(userID, receipt.Items)
+	h.assignStore(receipt, models.StoreDetails{Address: doc.Address, City: doc.City, State: doc.State})
+	h.assignProducts(userID, receipt.Items)
+	utils.MeasureItems(receipt.Items)
+
+	if err := h.receiptRepo.Create(receipt); err != nil {
+		fmt.Println("Error saving imported receipt:", err)
+		result.Error = "failed to save receipt"
+		return result
+	}
+
+	h.learnItemNames(receipt, receipt.Items, false)
+
+	result.Status = importStatusImported
+	result.ReceiptID = receipt.ID
+	return result
+}
+
+func receiptFromDocument(userID string, doc *fiscal.Document, learned map[string]string) *models.Receipt {
+	company := doc.TradeName
+	if company == "" {
+		company = doc.IssuerName
+	}
+
+	receipt := &models.Receipt{
+		UserID:   userID,
+		Company:  company,
+		Date:     doc.IssuedAt,
+		Total:    doc.Total,
+		Discount: doc.Discount,
+		Items:    make([]models.ReceiptItem, 0, len(doc.Items)),
+
+		TaxAmount: doc.TaxAmount,
+		Change:    doc.Change,
+	}
+
+	var largestPayment float64
+	for _, payment := range doc.Payments {
+		receipt.AmountPaid += payment.Amount
+		if payment.Amount > largestPayment {
+			largestPayment = payment.Amount
+			receipt.PaymentMethod = utils.PaymentMethodFromCode(payment.Code)
+		}
+	}
+
+	for _, item := range doc.Items {
+		name := item.Name
+		if learnedName, ok := learned[normalize.Key(item.Name)]; ok {
+			name = learnedName
+		}
+
+		unit := item.Unit
+		if unit == "" {
+			unit = "un"
+		}
+
+		receipt.Items = append(receipt.Items, models.ReceiptItem{
+			RawName:    item.Name,
+			Name:       name,
+			Quantity:   item.Quantity,
+			Unit:       unit,
+			UnitPrice:  item.UnitPrice,
+			TotalPrice: item.Net(),
+			Discount:   item.Discount,
+			TaxAmount:  item.TaxAmount,
+			Barcode:    item.EAN,
+		})
+	}
+
+	utils.ApplyReconciliation(receipt, receipt.Items)
+
+	return receipt
+}
+
+type importUpload struct {
+	name string
+	data []byte
+	// entry is set instead of data for files in a zip archive.
+	entry *zip.File
+}
+
+// read returns the upload's XML, decompressing it from the archive.
+func (u importUpload) read() ([]byte, error) {
+	if u.entry == nil {
+		return u.data, nil
+	}
+
+	tooLarge := fmt.Errorf("file too large, at most %d MB", maxImportXMLSize>>20)
+	if u.entry.UncompressedSize64 > maxImportXMLSize {
+		return nil, tooLarge
+	}
+
+	reader, err := u.entry.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the file from the archive")
+	}
+	defer reader.Close()
+
+	// The size in the archive's header may lie.
+	data, err := io.ReadAll(io.LimitReader(reader, maxImportXMLSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the file from the archive")
+	}
+	if len(data) > maxImportXMLSize {
+		return nil, tooLarge
+	}
+	return data, nil
+}
+
+func readImportUploads(c echo.Context) ([]importUpload, error) {
+	req := c.Request()
+	req.Body = http.MaxBytesReader(c.Response(), req.Body, maxImportUploadSize)
+
+	var uploads []importUpload
+
+	if strings.HasPrefix(req.Header.Get(echo.HeaderContentType), echo.MIMEMultipartForm) {
+		form, err := c.MultipartForm()
+		if err != nil {
+			return nil, fmt.Errorf("invalid multipart upload")
+		}
+		files := append(form.File["file"], form.File["files"]...)
+		for _, fh := range files {
+			data, err := readMultipartFile(fh)
+			if err != nil {
+				return nil, err
+			}
+			expanded, err := expandImportFile(fh.Filename, data)
+			if err != nil {
+				return nil, err
+			}
+			uploads = append(uploads, expanded...)
+		}
+	} else {
+		data, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, fmt.Errorf("upload too large or unreadable")
+		}
+		if len(data) > 0 {
+			expanded, err := expandImportFile("upload", data)
+			if err != nil {
+				return nil, err
+			}
+			uploads = append(uploads, expanded...)
+		}
+	}
+
+	if len(uploads) > maxImportFiles {
+		return nil, fmt.Errorf("too many files, at most %d per import", maxImportFiles)
+	}
+
+	return uploads, nil
+}
+
+func readMultipartFile(fh *multipart.FileHeader) ([]byte, error) {
+	file, err := fh.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s", fh.Filename)
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+// expandImportFile returns the XML files inside a zip archive, or the file
+// itself when it is not one. Archived files are not decompressed here; see
+// importUpload.read.
+func expandImportFile(name string, data []byte) ([]importUpload, error) {
+	if !bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		return []importUpload{{name: name, data: data}}, nil
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid zip archive %s", name)
+	}
+
+	var uploads []importUpload
+	for _, entry := range archive.File {
+		if entry.FileInfo().IsDir() || !strings.EqualFold(path.Ext(entry.Name), ".xml") {
+			continue
+		}
+		if len(uploads) >= maxImportFiles {
+			break
+		}
+		uploads = append(uploads, importUpload{name: path.Join(name, entry.Name), entry: entry})
+	}
+
+	return uploads, nil
+}
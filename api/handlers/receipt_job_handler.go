@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"buybuddy-api/jobs"
+	"buybuddy-api/llm"
+	"buybuddy-api/models"
+	"buybuddy-api/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// CreateReceiptJob queues a receipt for extraction in the background and
+// returns the job at once. It takes the same body as ProcessReceipt; poll
+// GetReceiptJob for the result.
+func (h *ReceiptHandler) CreateReceiptJob(c echo.Context) error {
+	userID := c.Get("userID").(string)
+
+	var req models.ProcessReceiptRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+
+	modelName := c.QueryParam("model")
+	if modelName == "" {
+		modelName = h.resolveReceiptModel(userID)
+	} else if !h.llms.IsReceiptModel(modelName) {
+		return echo.NewHTTPError(http.StatusBadRequest, "unknown receipt model")
+	}
+
+	parts, err := decodeReceiptPages(req)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	// The worker reads the pages back from storage, so they must be stored.
+	uploadID := h.storeOriginals(c.Request().Context(), userID, parts)
+	if uploadID == "" {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "could not store the receipt images for processing")
+	}
+
+	job := &models.ReceiptJob{
+		UserID:        userID,
+		UploadID:      uploadID,
+		StoreID:       req.StoreID,
+		Model:         modelName,
+		Status:        models.JobQueued,
+		MaxAttempts:   h.jobs.MaxAttempts(),
+		NextAttemptAt: time.Now(),
+	}
+	if err := h.jobRepo.Create(job); err != nil {
+		fmt.Println("Error creating receipt job:", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to queue receipt")
+	}
+
+	h.jobs.Notify()
+
+	return c.JSON(http.StatusAccepted, models.ReceiptJobResponse{ReceiptJob: *job})
+}
+
+func (h *ReceiptHandler) GetReceiptJob(c echo.Context) error {
+	userID := c.Get("userID").(string)
+
+	job, err := h.jobRepo.GetByID(c.Param("id"), userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "job not found")
+	}
+
+	response := models.ReceiptJobResponse{ReceiptJob: *job}
+	if job.Result != nil {
+		response.Result = json.RawMessage(*job.Result)
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// RunReceiptJob is the jobs.ProcessFunc for receipt jobs.
+func (h *ReceiptHandler) RunReceiptJob(ctx context.Context, job *models.ReceiptJob, stage func(string)) (interface{}, error) {
+	stage(models.JobStageLoading)
+
+	images, err := h.imageRepo.GetByUploadID(job.UploadID, job.UserID)
+	if err != nil {
+		return nil, jobs.Transient(err)
+	}
+	if len(images) == 0 {
+		return nil, fmt.Errorf("the receipt images are no longer available")
+	}
+
+	parts := make([]utils.ReceiptPart, 0, len(images))
+	for _, image := range images {
+		data, err := h.store.Get(ctx, image.StorageKey)
+		if err != nil {
+			return nil, jobs.Transient(fmt.Errorf("failed to read page %d: %w", image.Page, err))
+		}
+		parts = append(parts, utils.ReceiptPart{MIMEType: image.MIMEType, Data: data})
+	}
+
+	stage(models.JobStageExtracting)
+
+	receiptData, err := h.runExtraction(ctx, job.UserID, job.StoreID, parts, job.Model)
+	if err != nil {
+		var httpErr *echo.HTTPError
+		if errors.As(err, &httpErr) {
+			return nil, fmt.Errorf("%v", httpErr.Message)
+		}
+		if raw, ok := llm.RawOutput(err); ok {
+			fmt.Printf("Receipt job %s got invalid model output: %v\n%s\n", job.ID, err, raw)
+		}
+		if llm.IsTransient(err) {
+			return nil, jobs.Transient(err)
+		}
+		return nil, err
+	}
+
+	stage(models.JobStageChecking)
+	receiptData.UploadID = job.UploadID
+
+	return receiptData, nil
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"buybuddy-api/models"
+	"buybuddy-api/repository"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultReceiptsPerPage = 50
+	maxReceiptsPerPage     = 200
+)
+
+// receiptListParams are the query parameters of the paged listing. Without
+// any of them, and with LegacyReceiptList on, every receipt is returned as a
+// plain array as before.
+var receiptListParams = []string{"cursor", "limit", "sort", "view", "from", "to", "storeId", "categoryId", "minTotal", "maxTotal", "q"}
+
+// GetReceipts lists the user's receipts a page at a time, newest first.
+//
+//	?limit=      receipts per page (50, up to 200)
+//	?cursor=     nextCursor of the previous page
+//	?sort=       date_desc, date_asc, total_desc, total_asc or created_desc
+//	?view=       summary (no items, the default) or full
+//	?from=&to=   dates as YYYY-MM-DD (to is inclusive) or RFC 3339
+//	?storeId=    one or more store IDs, comma separated
+//	?categoryId= receipts with an item in one of these categories
+//	?minTotal=&maxTotal=
+//	?q=          text in the company, store or item names and brands
+func (h *ReceiptHandler) GetReceipts(c echo.Context) error {
+	userID := c.Get("userID").(string)
+
+	if h.cfg.LegacyReceiptList && !hasAnyParam(c, receiptListParams) {
+		receipts, err := h.receiptRepo.GetByUserID(userID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch receipts")
+		}
+		return c.JSON(http.StatusOK, receipts)
+	}
+
+	query, err := parseReceiptListQuery(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	view := c.QueryParam("view")
+	if view != "" && view != "summary" && view != "full" {
+		return echo.NewHTTPError(http.StatusBadRequest, "view must be summary or full")
+	}
+
+	total, err := h.receiptRepo.CountReceipts(userID, query)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch receipts")
+	}
+
+	response := models.ReceiptListResponse{TotalCount: total}
+	if view == "full" {
+		response.Receipts, response.NextCursor, err = h.receiptRepo.ListReceipts(userID, query)
+	} else {
+		response.Receipts, response.NextCursor, err = h.receiptRepo.ListReceiptSummaries(userID, query)
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidCursor) {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid cursor")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch receipts")
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+func parseReceiptListQuery(c echo.Context) (models.ReceiptListQuery, error) {
+	query := models.ReceiptListQuery{
+		Cursor: c.QueryParam("cursor"),
+		Limit:  defaultReceiptsPerPage,
+		Sort:   models.ReceiptSortDateDesc,
+		Text:   strings.TrimSpace(c.QueryParam("q")),
+	}
+
+	if value := c.QueryParam("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return query, fmt.Errorf("invalid limit")
+		}
+		query.Limit = min(limit, maxReceiptsPerPage)
+	}
+
+	if value := c.QueryParam("sort"); value != "" {
+		if !repository.IsReceiptSort(value) {
+			return query, fmt.Errorf("unknown sort %s", value)
+		}
+		query.Sort = value
+	}
+
+	var err error
+	if query.From, err = parseListDate(c.QueryParam("from"), false); err != nil {
+		return query, fmt.Errorf("invalid from date")
+	}
+	if query.To, err = parseListDate(c.QueryParam("to"), true); err != nil {
+		return query, fmt.Errorf("invalid to date")
+	}
+	if query.StoreIDs, err = parseIDList(c.QueryParam("storeId")); err != nil {
+		return query, fmt.Errorf("invalid store id")
+	}
+	if query.CategoryIDs, err = parseIDList(c.QueryParam("categoryId")); err != nil {
+		return query, fmt.Errorf("invalid category id")
+	}
+	if query.MinTotal, err = parseOptionalFloat(c.QueryParam("minTotal")); err != nil {
+		return query, fmt.Errorf("invalid minTotal")
+	}
+	if query.MaxTotal, err = parseOptionalFloat(c.QueryParam("maxTotal")); err != nil {
+		return query, fmt.Errorf("invalid maxTotal")
+	}
+
+	return query, nil
+}
+
+// parseListDate reads a YYYY-MM-DD or RFC 3339 date. A day given as the end
+// of a range is made inclusive by returning the start of the next day.
+func parseListDate(value string, end bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if date, err := time.Parse(time.RFC3339, value); err == nil {
+		return &date, nil
+	}
+	date, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return nil, err
+	}
+	if end {
+		date = date.AddDate(0, 0, 1)
+	}
+	return &date, nil
+}
+
+func parseIDList(value string) ([]uint, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var ids []uint
+	for _, part := range strings.Split(value, ",") {
+		id, err := strconv.ParseUint(strings.TrimSpace(part), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
+
+func parseOptionalFloat(value string) (*float64, error) {
+	if value == "" {
+		return nil, nil
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &number, nil
+}
+
+func hasAnyParam(c echo.Context, names []string) bool {
+	params := c.QueryParams()
+	for _, name := range names {
+		if _, ok := params[name]; ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,321 @@
+package handlers
+
+import (
+	"buybuddy-api/fiscal"
+	"buybuddy-api/models"
+	"buybuddy-api/utils"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ReprocessReceipt runs the stored images of a saved receipt through another
+// extraction model (?model=, default: the user's preference) and returns a
+// diff against the saved data. Nothing changes until the diff is accepted.
+func (h *ReceiptHandler) ReprocessReceipt(c echo.Context) error {
+	userID := c.Get("userID").(string)
+	receiptID := c.Param("id")
+	ctx := c.Request().Context()
+
+	modelName := c.QueryParam("model")
+	if modelName == "" {
+		modelName = h.resolveReceiptModel(userID)
+	} else if !h.llms.IsReceiptModel(modelName) {
+		return echo.NewHTTPError(http.StatusBadRequest, "unknown receipt model")
+	}
+
+	receipt, err := h.receiptRepo.GetByID(receiptID, userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "receipt not found")
+	}
+
+	images, err := h.imageRepo.GetByReceiptID(receiptID, userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch receipt images")
+	}
+	if len(images) == 0 {
+		return echo.NewHTTPError(http.StatusConflict, "this receipt has no stored images to reprocess")
+	}
+
+	parts := make([]utils.ReceiptPart, 0, len(images))
+	for i := range images {
+		data, err := h.loadImage(ctx, &images[i])
+		if err != nil {
+			return err
+		}
+		parts = append(parts, utils.ReceiptPart{MIMEType: images[i].MIMEType, Data: data})
+	}
+
+	receiptData, err := h.extractReceipt(ctx, userID, receipt.StoreID, parts, modelName)
+	if err != nil {
+		return err
+	}
+
+	result, err := json.Marshal(receiptData)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to store reprocess result")
+	}
+
+	reprocess := &models.ReceiptReprocess{
+		ReceiptID: receipt.ID,
+		UserID:    userID,
+		Model:     modelName,
+		Result:    string(result),
+	}
+	if err := h.receiptRepo.CreateReprocess(reprocess); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to store reprocess result")
+	}
+
+	return c.JSON(http.StatusOK, models.ReprocessResponse{
+		ID:          reprocess.ID,
+		ReceiptID:   receipt.ID,
+		Model:       modelName,
+		ReceiptDiff: utils.DiffReceipt(receipt, receiptData),
+	})
+}
+
+// AcceptReprocess applies the selected fields and items of a reprocess diff.
+// The diff is recomputed against the receipt's current state, so edits made
+// since reprocessing are respected.
+func (h *ReceiptHandler) AcceptReprocess(c echo.Context) error {
+	userID := c.Get("userID").(string)
+	receiptID := c.Param("id")
+
+	reprocess, err := h.receiptRepo.GetReprocess(c.Param("reprocessId"), receiptID, userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "reprocess result not found")
+	}
+	if reprocess.AppliedAt != nil {
+		return echo.NewHTTPError(http.StatusConflict, "this reprocess result has already been applied")
+	}
+
+	var req models.AcceptReprocessRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+
+	receipt, err := h.receiptRepo.GetByID(receiptID, userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "receipt not found")
+	}
+
+	var proposed utils.ReceiptData
+	if err := json.Unmarshal([]byte(reprocess.Result), &proposed); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to read reprocess result")
+	}
+
+	diff := utils.DiffReceipt(receipt, &proposed)
+	dateChanged := false
+	storeChanged := false
+
+	for _, field := range req.Fields {
+		if !reprocessFields[field] {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown field %s", field))
+		}
+		if !hasFieldChange(diff.Fields, field) {
+			continue
+		}
+
+		switch field {
+		case "company":
+			receipt.Company = proposed.Company
+			storeChanged = true
+		case "date":
+			receipt.Date = utils.ParseReceiptDate(proposed.Date)
+			dateChanged = true
+		case "total":
+			receipt.Total = proposed.Total
+		case "accessKey":
+			key, err := fiscal.Parse(proposed.AccessKey)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "the proposed access key is invalid")
+			}
+			exists, _, err := h.findByAccessKey(key.Key, userID)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError, "failed to check for duplicate receipt")
+			}
+			if exists {
+				return echo.NewHTTPError(http.StatusConflict, "another receipt already has this access key")
+			}
+			applyAccessKey(receipt, key)
+			storeChanged = true
+		}
+	}
+
+	itemDiffs := make(map[string]models.ItemDiff, len(diff.Items))
+	for _, itemDiff := range diff.Items {
+		itemDiffs[itemDiff.Key] = itemDiff
+	}
+
+	var saved []models.ReceiptItem
+	var deleted []uint
+	for _, key := range req.Items {
+		itemDiff, ok := itemDiffs[key]
+		if !ok {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown item %s", key))
+		}
+
+		switch itemDiff.Status {
+		case models.ItemDiffChanged:
+			item := *itemDiff.Current
+			h.applyItemChanges(&item, itemDiff.Changes)
+			saved = append(saved, item)
+		case models.ItemDiffAdded:
+			saved = append(saved, h.buildReceiptItem(itemDiff.Proposed))
+		case models.ItemDiffRemoved:
+			deleted = append(deleted, *itemDiff.ItemID)
+		}
+	}
+
+	if storeChanged {
+		h.assignStore(receipt, models.StoreDetails{})
+	}
+	h.assignProducts(userID, saved)
+	utils.MeasureItems(saved)
+
+	utils.ApplyReconciliation(receipt, mergeItems(receipt.Items, saved, deleted))
+
+	if err := h.receiptRepo.SaveChanges(receipt, saved, deleted); err != nil {
+		fmt.Println("Error applying reprocess:", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to update receipt")
+	}
+
+	if err := h.receiptRepo.MarkReprocessApplied(reprocess); err != nil {
+		fmt.Println("Error marking reprocess applied:", err)
+	}
+
+	h.learnItemNames(receipt, saved, false)
+
+	if dateChanged {
+		utils.GetFirstReceiptCache().Invalidate(userID)
+	}
+
+	updated, err := h.receiptRepo.GetByID(receiptID, userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch receipt")
+	}
+
+	return c.JSON(http.StatusOK, updated)
+}
+
+// applyItemChanges copies the proposed values of a changed item onto it.
+func (h *ReceiptHandler) applyItemChanges(item *models.ReceiptItem, changes []models.FieldChange) {
+	categoryName := ""
+	if item.Category != nil {
+		categoryName = item.Category.Name
+	}
+	subcategoryName := ""
+	if item.Subcategory != nil {
+		subcategoryName = item.Subcategory.Name
+	}
+	categoryChanged := false
+
+	for _, change := range changes {
+		text, _ := change.Proposed.(string)
+		number, _ := change.Proposed.(float64)
+
+		switch change.Field {
+		case "rawName":
+			item.RawName = text
+		case "name":
+			item.Name = text
+			unlinkProduct(item)
+		case "brand":
+			item.Brand = text
+			unlinkProduct(item)
+		case "quantity":
+			item.Quantity = number
+		case "unit":
+			item.Unit = text
+		case "unitPrice":
+			item.UnitPrice = number
+		case "totalPrice":
+			item.TotalPrice = number
+		case "category":
+			categoryName = text
+			categoryChanged = true
+		case "subcategory":
+			subcategoryName = text
+			categoryChanged = true
+		}
+	}
+
+	if categoryChanged {
+		h.setItemCategory(item, categoryName, subcategoryName)
+	}
+}
+
+// setItemCategory resolves category and subcategory names to IDs. Unknown
+// names clear the reference rather than keeping a stale one.
+func (h *ReceiptHandler) setItemCategory(item *models.ReceiptItem, categoryName, subcategoryName string) {
+	item.CategoryID = nil
+	item.SubcategoryID = nil
+	item.Category = nil
+	item.Subcategory = nil
+
+	if strings.TrimSpace(categoryName) == "" {
+		return
+	}
+
+	category, err := h.categoryRepo.GetByName(categoryName)
+	if err != nil {
+		return
+	}
+	item.CategoryID = &category.ID
+
+	if subcategoryName == "" {
+		return
+	}
+	if subcategory, err := h.categoryRepo.GetSubcategoryByName(category.ID, subcategoryName); err == nil {
+		item.SubcategoryID = &subcategory.ID
+	}
+}
+
+// mergeItems returns the item list as it will be once saved items are
+// written and deleted ones removed.
+func mergeItems(current, saved []models.ReceiptItem, deleted []uint) []models.ReceiptItem {
+	replaced := make(map[uint]models.ReceiptItem, len(saved))
+	var added []models.ReceiptItem
+	for _, item := range saved {
+		if item.ID == 0 {
+			added = append(added, item)
+		} else {
+			replaced[item.ID] = item
+		}
+	}
+	removed := make(map[uint]bool, len(deleted))
+	for _, id := range deleted {
+		removed[id] = true
+	}
+
+	merged := make([]models.ReceiptItem, 0, len(current)+len(added))
+	for _, item := range current {
+		if removed[item.ID] {
+			continue
+		}
+		if updated, ok := replaced[item.ID]; ok {
+			item = updated
+		}
+		merged = append(merged, item)
+	}
+	return append(merged, added...)
+}
+
+var reprocessFields = map[string]bool{
+	"company":   true,
+	"date":      true,
+	"total":     true,
+	"accessKey": true,
+}
+
+func hasFieldChange(changes []models.FieldChange, field string) bool {
+	for _, change := range changes {
+		if change.Field == field {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"buybuddy-api/models"
+	"buybuddy-api/utils"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+const (
+	// reviewThreshold is the confidence below which a field sends its item
+	// to the review queue.
+	reviewThreshold = 0.7
+
+	defaultReviewItems = 50
+	maxReviewItems     = 200
+)
+
+// GetReviewQueue lists the items across the user's receipts that extraction
+// was unsure of, least sure first, with the alternatives to pick from.
+// ?limit= caps the result (50, up to 200).
+func (h *ReceiptHandler) GetReviewQueue(c echo.Context) error {
+	userID := c.Get("userID").(string)
+
+	limit := defaultReviewItems
+	if value := c.QueryParam("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "limit must be a positive number")
+		}
+		limit = min(parsed, maxReviewItems)
+	}
+
+	items, err := h.receiptRepo.GetReviewQueue(userID, reviewThreshold, limit)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch review queue")
+	}
+	total, err := h.receiptRepo.CountReviewQueue(userID, reviewThreshold)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch review queue")
+	}
+
+	response := models.ReviewQueueResponse{Items: make([]models.ReviewItem, 0, len(items)), TotalCount: total}
+	for _, item := range items {
+		review := models.ReviewItem{Item: item, ReceiptID: item.ReceiptID, LowFields: lowConfidenceFields(item.Confidence)}
+		if receipt := item.Receipt; receipt != nil {
+			review.Store = receipt.Company
+			if receipt.Store != nil {
+				review.Store = receipt.Store.Name
+			}
+			review.Date = receipt.Date
+		}
+		response.Items = append(response.Items, review)
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// ReviewItem confirms an item from the review queue, applying the picked
+// alternatives. The confirmed name is learned as a correction, so the same
+// raw name comes out right on the next receipt.
+func (h *ReceiptHandler) ReviewItem(c echo.Context) error {
+	userID := c.Get("userID").(string)
+
+	itemID, err := strconv.ParseUint(c.Param("itemId"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid item id")
+	}
+
+	var req models.ReviewItemRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+
+	receiptID, err := h.receiptRepo.GetItemReceiptID(uint(itemID), userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "item not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch item")
+	}
+	receipt, err := h.receiptRepo.GetByID(receiptID, userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "item not found")
+	}
+
+	var item *models.ReceiptItem
+	for i := range receipt.Items {
+		if receipt.Items[i].ID == uint(itemID) {
+			item = &receipt.Items[i]
+			break
+		}
+	}
+	if item == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "item not found")
+	}
+
+	input, err := reviewInput(item, req)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := h.applyItemInput(item, input); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	now := time.Now()
+	item.ReviewedAt = &now
+
+	h.assignProducts(userID, receipt.Items)
+	utils.MeasureItems(receipt.Items)
+
+	if err := h.receiptRepo.SaveChanges(receipt, []models.ReceiptItem{*item}, nil); err != nil {
+		fmt.Println("Error confirming receipt item:", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to update item")
+	}
+
+	h.learnItemNames(receipt, []models.ReceiptItem{*item}, true)
+
+	return c.JSON(http.StatusOK, item)
+}
+
+// reviewInput turns the picked alternatives into an item edit.
+func reviewInput(item *models.ReceiptItem, req models.ReviewItemRequest) (models.ReceiptItemInput, error) {
+	var input models.ReceiptItemInput
+
+	switch {
+	case req.NameOption != nil:
+		if err := checkOption("nameOption", *req.NameOption, len(item.NameOptions)); err != nil {
+			return input, err
+		}
+		input.Name = &item.NameOptions[*req.NameOption]
+	case req.Name != nil:
+		input.Name = req.Name
+	}
+
+	if req.CategoryOption != nil {
+		if err := checkOption("categoryOption", *req.CategoryOption, len(item.CategoryOptions)); err != nil {
+			return input, err
+		}
+		option := item.CategoryOptions[*req.CategoryOption]
+		input.Category = &option.Category
+		input.Subcategory = &option.Subcategory
+	}
+
+	return input, nil
+}
+
+func checkOption(name string, index, count int) error {
+	if count == 0 {
+		return fmt.Errorf("the item has no alternatives for %s", name)
+	}
+	if index < 0 || index >= count {
+		return fmt.Errorf("%s must be between 0 and %d", name, count-1)
+	}
+	return nil
+}
+
+// lowConfidenceFields lists the fields below reviewThreshold, least sure
+// first.
+func lowConfidenceFields(confidence map[string]float64) []string {
+	fields := []string{}
+	for field, value := range confidence {
+		if value < reviewThreshold {
+			fields = append(fields, field)
+		}
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		if confidence[fields[i]] != confidence[fields[j]] {
+			return confidence[fields[i]] < confidence[fields[j]]
+		}
+		return fields[i] < fields[j]
+	})
+	return fields
+}
@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"buybuddy-api/models"
+	"buybuddy-api/repository"
+	"buybuddy-api/utils"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+type SplitHandler struct {
+	receiptRepo *repository.ReceiptRepository
+	userRepo    *repository.UserRepository
+}
+
+func NewSplitHandler(receiptRepo *repository.ReceiptRepository, userRepo *repository.UserRepository) *SplitHandler {
+	return &SplitHandler{receiptRepo: receiptRepo, userRepo: userRepo}
+}
+
+// GetReceiptSplits shows how a receipt is split to its owner and to the
+// users it is split with.
+func (h *SplitHandler) GetReceiptSplits(c echo.Context) error {
+	userID := c.Get("userID").(string)
+
+	receipt, err := h.receiptRepo.GetSplitReceipt(c.Param("id"), userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "receipt not found")
+	}
+
+	return h.respondSplits(c, receipt)
+}
+
+// UpdateReceiptSplits replaces the splits of one of the user's receipts.
+// Users are given by email; each item's shares may add up to at most the
+// whole item, and the owner keeps the rest. New splits wait for the user to
+// accept them.
+func (h *SplitHandler) UpdateReceiptSplits(c echo.Context) error {
+	userID := c.Get("userID").(string)
+
+	receipt, err := h.receiptRepo.GetByID(c.Param("id"), userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "receipt not found")
+	}
+
+	var req models.ReceiptSplitRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+
+	existing, err := h.receiptRepo.GetSplits(receipt.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch splits")
+	}
+	previous := make(map[string]models.ReceiptItemSplit, len(existing))
+	for _, split := range existing {
+		previous[fmt.Sprintf("%d:%s", split.ItemID, split.UserID)] = split
+	}
+
+	items := make(map[uint]models.ReceiptItem, len(receipt.Items))
+	for _, item := range receipt.Items {
+		items[item.ID] = item
+	}
+
+	users := make(map[string]*models.User)
+	shares := make(map[uint]float64)
+	seen := make(map[string]bool)
+	splits := make([]models.ReceiptItemSplit, 0, len(req.Splits))
+	for _, s := range req.Splits {
+		item, ok := items[s.ItemID]
+		if !ok {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("item %d is not on this receipt", s.ItemID))
+		}
+
+		email := strings.TrimSpace(s.Email)
+		user, ok := users[email]
+		if !ok {
+			if user, err = h.userRepo.GetByEmail(email); err != nil {
+				return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("user not found: %s", s.Email))
+			}
+			users[email] = user
+		}
+		if user.ID == userID {
+			return echo.NewHTTPError(http.StatusBadRequest, "cannot split with yourself")
+		}
+
+		share := s.Share
+		if share == 0 {
+			share = 1
+		}
+		if share < 0 || share > 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, "share must be above 0 and at most 1")
+		}
+
+		key := fmt.Sprintf("%d:%s", item.ID, user.ID)
+		if seen[key] {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("%s is split with %s more than once", item.Name, s.Email))
+		}
+		seen[key] = true
+
+		shares[item.ID] += share
+		if shares[item.ID] > 1+utils.ShareTolerance {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("the shares of %s add up to more than the whole item", item.Name))
+		}
+
+		// A split the user already answered keeps its status while its
+		// share is unchanged; new and changed splits are pending.
+		status := models.ShareStatusPending
+		if old, ok := previous[key]; ok && math.Abs(old.Share-share) < utils.ShareTolerance {
+			status = old.Status
+		}
+
+		splits = append(splits, models.ReceiptItemSplit{
+			ReceiptID: receipt.ID,
+			ItemID:    item.ID,
+			UserID:    user.ID,
+			Share:     share,
+			Status:    status,
+		})
+	}
+
+	if err := h.receiptRepo.ReplaceSplits(receipt.ID, splits); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to split receipt")
+	}
+
+	return h.respondSplits(c, receipt)
+}
+
+// GetSharedReceipts lists the receipts other users split with the user.
+func (h *SplitHandler) GetSharedReceipts(c echo.Context) error {
+	userID := c.Get("userID").(string)
+
+	shared, err := h.receiptRepo.GetSharedWithUser(userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch shared receipts")
+	}
+
+	return c.JSON(http.StatusOK, shared)
+}
+
+// GetSplitInvites lists the receipts other users want to split with the
+// user, for the user to accept or reject.
+func (h *SplitHandler) GetSplitInvites(c echo.Context) error {
+	userID := c.Get("userID").(string)
+
+	invites, err := h.receiptRepo.GetPendingSplits(userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get split invites")
+	}
+
+	return c.JSON(http.StatusOK, invites)
+}
+
+// AcceptSplits accepts the pending splits of a receipt given to the user.
+func (h *SplitHandler) AcceptSplits(c echo.Context) error {
+	return h.respondToSplits(c, models.ShareStatusAccepted)
+}
+
+// RejectSplits rejects the pending splits of a receipt given to the user;
+// the owner keeps those shares.
+func (h *SplitHandler) RejectSplits(c echo.Context) error {
+	return h.respondToSplits(c, models.ShareStatusRejected)
+}
+
+func (h *SplitHandler) respondToSplits(c echo.Context, status models.ShareStatus) error {
+	userID := c.Get("userID").(string)
+
+	receipt, err := h.receiptRepo.GetSplitReceipt(c.Param("id"), userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "receipt not found")
+	}
+
+	updated, err := h.receiptRepo.RespondToSplits(receipt.ID, userID, status)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to update splits")
+	}
+	if updated == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "no pending splits on this receipt")
+	}
+
+	return h.respondSplits(c, receipt)
+}
+
+// GetSplitBalances shows, for everyone the user split receipts with, who
+// owes whom.
+func (h *SplitHandler) GetSplitBalances(c echo.Context) error {
+	userID := c.Get("userID").(string)
+
+	balances, err := h.receiptRepo.GetSplitBalances(userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch balances")
+	}
+
+	return c.JSON(http.StatusOK, balances)
+}
+
+// respondSplits sends the splits of a receipt with each person's share, the
+// owner's being whatever is not split off. Rejected splits stay with the
+// owner; pending ones are shown as proposed.
+func (h *SplitHandler) respondSplits(c echo.Context, receipt *models.Receipt) error {
+	splits, err := h.receiptRepo.GetSplits(receipt.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch splits")
+	}
+	owner, err := h.userRepo.GetUserByID(receipt.UserID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch receipt owner")
+	}
+
+	prices := make(map[uint]float64, len(receipt.Items))
+	ownerAmount := 0.0
+	for _, item := range receipt.Items {
+		prices[item.ID] = item.TotalPrice
+		ownerAmount += item.TotalPrice
+	}
+
+	shares := []models.SplitShare{{UserID: owner.ID, Email: owner.Email, Name: owner.Name, Owner: true}}
+	index := make(map[string]int)
+	for i := range splits {
+		split := &splits[i]
+		split.Amount = utils.RoundCents(prices[split.ItemID] * split.Share)
+		if split.Status == models.ShareStatusRejected {
+			continue
+		}
+		ownerAmount -= split.Amount
+
+		j, ok := index[split.UserID]
+		if !ok {
+			j = len(shares)
+			index[split.UserID] = j
+			shares = append(shares, models.SplitShare{UserID: split.UserID})
+			if split.User != nil {
+				shares[j].Email, shares[j].Name = split.User.Email, split.User.Name
+			}
+		}
+		shares[j].Amount = utils.RoundCents(shares[j].Amount + split.Amount)
+	}
+	shares[0].Amount = utils.RoundCents(ownerAmount)
+
+	return c.JSON(http.StatusOK, models.ReceiptSplits{
+		ReceiptID: receipt.ID,
+		Splits:    splits,
+		Shares:    shares,
+	})
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"buybuddy-api/models"
+	"buybuddy-api/nfce"
+	"buybuddy-api/utils"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const maxReceiptTextSize = 64 << 10
+
+// ProcessText reads the OCR text of a printed NFC-e, recognized on the phone,
+// with the NFC-e grammar. Only the lines the grammar can't read are sent to
+// the default assistant model, as text; without a model they are returned in
+// unparsedLines. The result has the same shape as ProcessReceipt.
+func (h *ReceiptHandler) ProcessText(c echo.Context) error {
+	userID := c.Get("userID").(string)
+
+	var req models.ProcessTextRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+	if strings.TrimSpace(req.Text) == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "text is required")
+	}
+	if len(req.Text) > maxReceiptTextSize {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "text is too long")
+	}
+
+	parsed := nfce.ParseText(req.Text)
+
+	rawNames := make([]string, len(parsed.Items))
+	for i, item := range parsed.Items {
+		rawNames[i] = item.Name
+	}
+	receiptData := receiptDataFromNFCe(&parsed.Receipt, h.learnedNames(userID, rawNames))
+
+	read := h.readUnparsedLines(c.Request().Context(), userID, req.StoreID, parsed.Unparsed)
+
+	// Put the items the model read back between the parsed ones, in the
+	// order they were printed.
+	items := make([]map[string]interface{}, 0, len(receiptData.Items)+len(read))
+	next := 0
+	for i, line := range parsed.Unparsed {
+		for ; next < line.Position; next++ {
+			items = append(items, receiptData.Items[next])
+		}
+		item, ok := read[i]
+		if !ok {
+			receiptData.UnparsedLines = append(receiptData.UnparsedLines, line.Text)
+		} else if item != nil {
+			items = append(items, item)
+		}
+	}
+	receiptData.Items = append(items, receiptData.Items[next:]...)
+
+	if len(receiptData.Items) == 0 {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, map[string]interface{}{
+			"message":       "No items could be read from the text. Please scan the receipt photo instead.",
+			"unparsedLines": receiptData.UnparsedLines,
+		})
+	}
+
+	h.loadRules(userID).ApplyToData(receiptData)
+	checkAccessKey(receiptData)
+
+	reconciliation := utils.ReconcileReceiptData(receiptData)
+	receiptData.Reconciliation = &reconciliation
+
+	fmt.Printf("User %s processed receipt text: %d items parsed, %d read by model, %d unparsed\n",
+		userID, len(parsed.Items), len(receiptData.Items)-len(parsed.Items), len(receiptData.UnparsedLines))
+
+	return c.JSON(http.StatusOK, receiptData)
+}
+
+// readUnparsedLines has the default assistant model read the lines the
+// grammar could not. It returns nothing when no model is configured or the
+// model fails, leaving the lines unparsed.
+func (h *ReceiptHandler) readUnparsedLines(ctx context.Context, userID string, storeID *uint, unparsed []nfce.UnparsedLine) map[int]map[string]interface{} {
+	if len(unparsed) == 0 {
+		return nil
+	}
+	chat, model, err := h.llms.Chat("")
+	if err != nil {
+		return nil
+	}
+
+	categoryInfos, err := h.categoryInfos()
+	if err != nil {
+		return nil
+	}
+
+	lines := make([]string, len(unparsed))
+	for i, line := range unparsed {
+		lines[i] = line.Text
+	}
+
+	read, err := utils.ReadReceiptLines(ctx, chat, model, lines, categoryInfos, h.loadItemMappings(userID, storeID))
+	if err != nil {
+		fmt.Println("Error reading receipt lines with model:", err)
+		return nil
+	}
+	return read
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"buybuddy-api/storage"
+	"buybuddy-api/utils"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// GetTrash lists the user's deleted receipts with when each will be purged.
+func (h *ReceiptHandler) GetTrash(c echo.Context) error {
+	userID := c.Get("userID").(string)
+
+	receipts, err := h.receiptRepo.GetTrash(userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch trash")
+	}
+
+	retention := h.cfg.TrashRetention()
+	for i := range receipts {
+		receipts[i].PurgeAt = receipts[i].DeletedAt.Add(retention)
+	}
+
+	return c.JSON(http.StatusOK, receipts)
+}
+
+// RestoreReceipt takes a receipt out of the trash. It fails with 409 when a
+// receipt with the same access key was saved since.
+func (h *ReceiptHandler) RestoreReceipt(c echo.Context) error {
+	userID := c.Get("userID").(string)
+	receiptID := c.Param("id")
+
+	trashed, err := h.receiptRepo.GetTrashed(receiptID, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "receipt not found in trash")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to restore receipt")
+	}
+
+	if trashed.AccessKey != "" {
+		exists, existing, err := h.findByAccessKey(trashed.AccessKey, userID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to check for duplicate receipt")
+		}
+		if exists {
+			return echo.NewHTTPError(http.StatusConflict, map[string]interface{}{
+				"message": "This receipt has been saved again since it was deleted",
+				"receipt": existing,
+			})
+		}
+	}
+
+	if err := h.receiptRepo.Restore(receiptID, userID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "receipt not found in trash")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to restore receipt")
+	}
+
+	utils.GetFirstReceiptCache().Invalidate(userID)
+
+	receipt, err := h.receiptRepo.GetByID(receiptID, userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch restored receipt")
+	}
+
+	return c.JSON(http.StatusOK, receipt)
+}
+
+// PurgeReceipt permanently deletes a receipt in the trash.
+func (h *ReceiptHandler) PurgeReceipt(c echo.Context) error {
+	userID := c.Get("userID").(string)
+
+	keys, err := h.receiptRepo.Purge(c.Param("id"), userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "receipt not found in trash")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to purge receipt")
+	}
+
+	h.deleteStoredImages(c, keys)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// EmptyTrash permanently deletes every receipt in the user's trash.
+func (h *ReceiptHandler) EmptyTrash(c echo.Context) error {
+	userID := c.Get("userID").(string)
+
+	purged, keys, err := h.receiptRepo.EmptyTrash(userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to empty trash")
+	}
+
+	h.deleteStoredImages(c, keys)
+
+	return c.JSON(http.StatusOK, map[string]int{"purged": purged})
+}
+
+// deleteStoredImages removes the images of purged receipts from storage. The
+// receipts are already gone, so a failure only leaves orphaned files.
+func (h *ReceiptHandler) deleteStoredImages(c echo.Context, keys []string) {
+	if err := storage.DeleteAll(c.Request().Context(), h.store, keys); err != nil {
+		log.Println("Failed to delete images of purged receipts:", err)
+	}
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"buybuddy-api/models"
+	"buybuddy-api/repository"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type StoreHandler struct {
+	storeRepo *repository.StoreRepository
+}
+
+func NewStoreHandler(storeRepo *repository.StoreRepository) *StoreHandler {
+	return &StoreHandler{storeRepo: storeRepo}
+}
+
+func (h *StoreHandler) GetStores(c echo.Context) error {
+	userID := c.Get("userID").(string)
+
+	stores, err := h.storeRepo.GetByUserID(userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to fetch stores")
+	}
+
+	return c.JSON(http.StatusOK, stores)
+}
+
+// UpdateStore renames a store or sets its chain, address or city.
+func (h *StoreHandler) UpdateStore(c echo.Context) error {
+	userID := c.Get("userID").(string)
+
+	store, err := h.findStore(c, userID)
+	if err != nil {
+		return err
+	}
+
+	var req models.UpdateStoreRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "name cannot be empty")
+		}
+		store.Name = name
+	}
+	if req.Chain != nil {
+		store.Chain = strings.TrimSpace(*req.Chain)
+	}
+	if req.Address != nil {
+		store.Address = strings.TrimSpace(*req.Address)
+	}
+	if req.City != nil {
+		store.City = strings.TrimSpace(*req.City)
+	}
+
+	if err := h.storeRepo.Update(store); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to update store")
+	}
+
+	return c.JSON(http.StatusOK, store)
+}
+
+// MergeStores folds the listed stores into the one in the URL; their
+// receipts move over and future receipts from them land there too.
+func (h *StoreHandler) MergeStores(c echo.Context) error {
+	userID := c.Get("userID").(string)
+
+	store, err := h.findStore(c, userID)
+	if err != nil {
+		return err
+	}
+
+	var req models.MergeStoresRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+
+	sourceIDs := make([]uint, 0, len(req.StoreIDs))
+	seen := map[uint]bool{store.ID: true}
+	for _, id := range req.StoreIDs {
+		if !seen[id] {
+			seen[id] = true
+			sourceIDs = append(sourceIDs, id)
+		}
+	}
+	if len(sourceIDs) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "storeIds must list at least one other store")
+	}
+
+	if err := h.storeRepo.Merge(userID, store.ID, sourceIDs); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "store not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to merge stores")
+	}
+
+	return c.JSON(http.StatusOK, store)
+}
+
+func (h *StoreHandler) findStore(c echo.Context, userID string) (*models.Store, error) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid store id")
+	}
+
+	store, err := h.storeRepo.GetByID(uint(id), userID)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "store not found")
+	}
+	return store, nil
+}
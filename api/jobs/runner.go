@@ -0,0 +1,168 @@
+// Package jobs runs receipt extraction in the background with a bounded pool
+// of workers that claim queued jobs from the receipt_jobs table, and purges
+// the receipt trash.
+package jobs
+
+import (
+	"buybuddy-api/config"
+	"buybuddy-api/models"
+	"buybuddy-api/repository"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	// pollInterval bounds how long a queued job waits when no worker was
+	// woken for it, e.g. a retry coming due.
+	pollInterval = 2 * time.Second
+	// attemptTimeout caps a single extraction attempt.
+	attemptTimeout = 3 * time.Minute
+	// retryBackoff is doubled after each failed attempt.
+	retryBackoff = 10 * time.Second
+)
+
+// ProcessFunc runs one attempt of a job. It reports progress through stage
+// and returns the result to store as the job's JSON result.
+type ProcessFunc func(ctx context.Context, job *models.ReceiptJob, stage func(string)) (interface{}, error)
+
+type transientError struct {
+	err error
+}
+
+func (e *transientError) Error() string { return e.err.Error() }
+func (e *transientError) Unwrap() error { return e.err }
+
+// Transient marks err as worth retrying, such as a model timeout or rate
+// limit. Other errors fail the job at once.
+func Transient(err error) error {
+	return &transientError{err: err}
+}
+
+type Runner struct {
+	repo        *repository.ReceiptJobRepository
+	workers     int
+	maxAttempts int
+	wake        chan struct{}
+}
+
+func NewRunner(repo *repository.ReceiptJobRepository, cfg config.JobsConfig) *Runner {
+	return &Runner{
+		repo:        repo,
+		workers:     cfg.Workers,
+		maxAttempts: cfg.MaxAttempts,
+		wake:        make(chan struct{}, cfg.Workers),
+	}
+}
+
+// MaxAttempts is the number of attempts new jobs get.
+func (r *Runner) MaxAttempts() int {
+	return r.maxAttempts
+}
+
+// Start requeues jobs interrupted by a restart and starts the workers. It
+// assumes a single API process owns the queue.
+func (r *Runner) Start(ctx context.Context, process ProcessFunc) {
+	if requeued, err := r.repo.RequeueInterrupted(); err != nil {
+		log.Println("Failed to requeue interrupted receipt jobs:", err)
+	} else if requeued > 0 {
+		log.Printf("Requeued %d interrupted receipt jobs", requeued)
+	}
+
+	for i := 0; i < r.workers; i++ {
+		go r.work(ctx, process)
+	}
+}
+
+// Notify wakes an idle worker to pick up a newly queued job.
+func (r *Runner) Notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (r *Runner) work(ctx context.Context, process ProcessFunc) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		for r.runNext(ctx, process) {
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// runNext claims and runs one job, reporting whether there was one.
+func (r *Runner) runNext(ctx context.Context, process ProcessFunc) bool {
+	job, err := r.repo.ClaimNext()
+	if err != nil {
+		log.Println("Failed to claim receipt job:", err)
+		return false
+	}
+	if job == nil {
+		return false
+	}
+
+	attemptCtx, cancel := context.WithTimeout(ctx, attemptTimeout)
+	defer cancel()
+
+	stage := func(stage string) {
+		if err := r.repo.SetStage(job.ID, stage); err != nil {
+			log.Printf("Failed to update receipt job %s: %v", job.ID, err)
+		}
+	}
+
+	result, err := r.safeProcess(attemptCtx, process, job, stage)
+	if err == nil {
+		r.complete(job, result)
+		return true
+	}
+
+	var transient *transientError
+	if errors.As(err, &transient) && job.Attempts < job.MaxAttempts && ctx.Err() == nil {
+		delay := retryBackoff << (job.Attempts - 1)
+		log.Printf("Receipt job %s attempt %d failed, retrying in %s: %v", job.ID, job.Attempts, delay, err)
+		if err := r.repo.Retry(job.ID, err.Error(), time.Now().Add(delay)); err != nil {
+			log.Printf("Failed to requeue receipt job %s: %v", job.ID, err)
+		}
+		return true
+	}
+
+	log.Printf("Receipt job %s failed: %v", job.ID, err)
+	if err := r.repo.Fail(job.ID, err.Error()); err != nil {
+		log.Printf("Failed to mark receipt job %s failed: %v", job.ID, err)
+	}
+	return true
+}
+
+func (r *Runner) complete(job *models.ReceiptJob, result interface{}) {
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		r.repo.Fail(job.ID, "failed to encode result")
+		return
+	}
+	if err := r.repo.Complete(job.ID, string(encoded)); err != nil {
+		log.Printf("Failed to store receipt job %s result: %v", job.ID, err)
+	}
+}
+
+// safeProcess turns a panic in process into a job failure instead of taking
+// the worker down.
+func (r *Runner) safeProcess(ctx context.Context, process ProcessFunc, job *models.ReceiptJob, stage func(string)) (result interface{}, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("processing panicked: %v", recovered)
+		}
+	}()
+	return process(ctx, job, stage)
+}
@@ -0,0 +1,67 @@
+package jobs
+
+import (
+	"buybuddy-api/repository"
+	"buybuddy-api/storage"
+	"context"
+	"log"
+	"time"
+)
+
+// trashPurgeInterval is how often receipts past the trash retention are
+// looked for.
+const trashPurgeInterval = time.Hour
+
+// StartTrashPurge permanently deletes receipts that have been in the trash
+// longer than retention, with their stored images, and the originals of
+// uploads that were never saved as a receipt within retention, now and then
+// every trashPurgeInterval until ctx is done.
+func StartTrashPurge(ctx context.Context, repo *repository.ReceiptRepository, imageRepo *repository.ReceiptImageRepository, store storage.Store, retention time.Duration) {
+	go func() {
+		ticker := time.NewTicker(trashPurgeInterval)
+		defer ticker.Stop()
+
+		for {
+			purgeTrash(ctx, repo, store, retention)
+			purgeUnlinkedImages(ctx, imageRepo, store, retention)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func purgeTrash(ctx context.Context, repo *repository.ReceiptRepository, store storage.Store, retention time.Duration) {
+	purged, keys, err := repo.PurgeExpired(time.Now().Add(-retention))
+	if err != nil {
+		log.Println("Failed to purge the receipt trash:", err)
+		return
+	}
+	if purged == 0 {
+		return
+	}
+
+	log.Printf("Purged %d receipts from the trash", purged)
+	if err := storage.DeleteAll(ctx, store, keys); err != nil {
+		log.Println("Failed to delete images of purged receipts:", err)
+	}
+}
+
+func purgeUnlinkedImages(ctx context.Context, repo *repository.ReceiptImageRepository, store storage.Store, retention time.Duration) {
+	purged, keys, err := repo.PurgeUnlinked(time.Now().Add(-retention))
+	if err != nil {
+		log.Println("Failed to purge unsaved receipt uploads:", err)
+		return
+	}
+	if purged == 0 {
+		return
+	}
+
+	log.Printf("Purged %d images of unsaved receipt uploads", purged)
+	if err := storage.DeleteAll(ctx, store, keys); err != nil {
+		log.Println("Failed to delete images of unsaved receipt uploads:", err)
+	}
+}
@@ -0,0 +1,81 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"hash/crc32"
+	"math"
+)
+
+const fakeModel = "fake"
+
+var fakeModels = []ModelOption{
+	{ID: fakeModel, Name: "Fake", Description: "Deterministic answers, for tests and offline development"},
+}
+
+// Fake answers without a network, the same way every time for the same
+// input. A receipt gets one item per page, priced from a checksum of the
+// page; questions always run an unfiltered query, and answers repeat the
+// size of the prompt they were given.
+type Fake struct{}
+
+func (Fake) ExtractReceipt(ctx context.Context, req ReceiptRequest) (*ReceiptExtraction, error) {
+	company := "Fake Store"
+	date := "2024-01-01T12:00:00"
+	method := "other"
+	result := &ReceiptExtraction{
+		Company:       &company,
+		Date:          &date,
+		PaymentMethod: &method,
+		Items:         []ExtractedItem{},
+	}
+
+	total := 0.0
+	for i, page := range req.Pages {
+		sum := crc32.ChecksumIEEE(page.Data)
+		price := float64(sum%10000) / 100
+		quantity := 1.0
+		unit := "un"
+		number := i + 1
+		confidence := 1.0
+		total += price
+		result.Items = append(result.Items, ExtractedItem{
+			RawName:     fmt.Sprintf("ITEM %08X", sum),
+			NameOptions: []string{fmt.Sprintf("Item %08X", sum)},
+			Quantity:    &quantity,
+			Unit:        &unit,
+			UnitPrice:   &price,
+			TotalPrice:  &price,
+			Page:        &number,
+			Confidence:  &ItemConfidence{Name: &confidence, Quantity: &confidence, TotalPrice: &confidence},
+		})
+	}
+	total = math.Round(total*100) / 100
+	result.Total = &total
+
+	return result, result.validate()
+}
+
+func (Fake) Generate(ctx context.Context, req ChatRequest) (string, error) {
+	return fmt.Sprintf("Fake answer to a %d-character prompt.", len(req.Prompt)), nil
+}
+
+func (Fake) GenerateJSON(ctx context.Context, req ChatRequest, out Output) error {
+	switch out := out.(type) {
+	case *Intent:
+		limit := 10
+		*out = Intent{Type: "query", Specific: &IntentFilter{Limit: &limit, OrderBy: "date_desc"}}
+	case *ReceiptExtraction:
+		result, err := Fake{}.ExtractReceipt(ctx, ReceiptRequest{Model: req.Model})
+		if err != nil {
+			return err
+		}
+		*out = *result
+	case *ReceiptLines:
+		// Leaves every line unread, as if the text made no sense.
+		*out = ReceiptLines{Lines: []ReceiptLine{}}
+	default:
+		return fmt.Errorf("fake model has no answer for %T", out)
+	}
+	return out.validate()
+}
@@ -0,0 +1,89 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/genai"
+)
+
+var geminiReceiptModels = []ModelOption{
+	{ID: "gemini-2.5-flash", Name: "Gemini 2.5 Flash", Description: "Latest and fastest (default)"},
+	{ID: "gemini-2.5-pro", Name: "Gemini 2.5 Pro", Description: "Most capable"},
+	{ID: "gemini-2.5-flash-lite", Name: "Gemini 2.5 Flash Lite", Description: "Lightweight and fast"},
+	{ID: "gemini-2.0-flash", Name: "Gemini 2.0 Flash", Description: "Reliable multimodal"},
+}
+
+var geminiChatModels = []ModelOption{
+	{ID: "gemini-2.5-flash-lite", Name: "Gemini 2.5 Flash Lite", Description: "Quick responses (default)"},
+	{ID: "gemini-2.5-flash", Name: "Gemini 2.5 Flash", Description: "Latest and fastest"},
+	{ID: "gemini-2.5-pro", Name: "Gemini 2.5 Pro", Description: "Most intelligent"},
+	{ID: "gemini-2.0-flash", Name: "Gemini 2.0 Flash", Description: "Balanced performance"},
+}
+
+// Gemini runs models through the Gemini API, with pages sent inline and
+// structured answers constrained by a response schema.
+type Gemini struct {
+	client *genai.Client
+}
+
+func NewGemini(ctx context.Context, apiKey string) (*Gemini, error) {
+	client, err := genai.NewClient(ctx, &genai.ClientConfig{APIKey: apiKey})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Gemini client: %w", err)
+	}
+	return &Gemini{client: client}, nil
+}
+
+func (g *Gemini) ExtractReceipt(ctx context.Context, req ReceiptRequest) (*ReceiptExtraction, error) {
+	parts := []*genai.Part{{Text: req.Prompt}}
+	for _, page := range req.Pages {
+		parts = append(parts, &genai.Part{InlineData: &genai.Blob{
+			MIMEType: page.MIMEType,
+			Data:     page.Data,
+		}})
+	}
+
+	var result ReceiptExtraction
+	if err := g.generateJSON(ctx, req.Model, parts, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (g *Gemini) Generate(ctx context.Context, req ChatRequest) (string, error) {
+	return g.generate(ctx, req.Model, []*genai.Part{{Text: req.Prompt}}, nil)
+}
+
+func (g *Gemini) GenerateJSON(ctx context.Context, req ChatRequest, out Output) error {
+	return g.generateJSON(ctx, req.Model, []*genai.Part{{Text: req.Prompt}}, out)
+}
+
+func (g *Gemini) generateJSON(ctx context.Context, model string, parts []*genai.Part, out Output) error {
+	text, err := g.generate(ctx, model, parts, &genai.GenerateContentConfig{
+		ResponseMIMEType: "application/json",
+		ResponseSchema:   outputSchema(out).genai(),
+	})
+	if err != nil {
+		return err
+	}
+	return decodeOutput(text, out)
+}
+
+func (g *Gemini) generate(ctx context.Context, model string, parts []*genai.Part, config *genai.GenerateContentConfig) (string, error) {
+	resp, err := g.client.Models.GenerateContent(ctx, model, []*genai.Content{
+		{
+			Role:  "user",
+			Parts: parts,
+		},
+	}, config)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate content: %w", err)
+	}
+
+	text := resp.Text()
+	if text == "" {
+		return "", ErrEmptyResponse
+	}
+	return text, nil
+}
@@ -0,0 +1,139 @@
+package llm
+
+import (
+	"buybuddy-api/models"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Intent is the intent model's answer: a direct answer, or the
+// filters of the receipt queries to run.
+type Intent struct {
+	Type     string        `json:"type" enum:"direct,query"`
+	Answer   string        `json:"answer,omitempty"`
+	Specific *IntentFilter `json:"specific,omitempty"`
+	General  *IntentFilter `json:"general,omitempty"`
+}
+
+// IntentFilter is the part of models.AssistantQueryFilter the model fills.
+type IntentFilter struct {
+	ProductName       []string `json:"productName,omitempty"`
+	Company           []string `json:"company,omitempty"`
+	Brand             []string `json:"brand,omitempty"`
+	Category          []string `json:"category,omitempty"`
+	Subcategory       []string `json:"subcategory,omitempty"`
+	DateFrom          string   `json:"dateFrom,omitempty"`
+	DateTo            string   `json:"dateTo,omitempty"`
+	MinPrice          *float64 `json:"minPrice,omitempty"`
+	MaxPrice          *float64 `json:"maxPrice,omitempty"`
+	PaymentMethod     []string `json:"paymentMethod,omitempty" enum:"credit,debit,pix,cash,voucher,other"`
+	HasDiscount       bool     `json:"hasDiscount,omitempty"`
+	Limit             *int     `json:"limit,omitempty"`
+	OrderBy           string   `json:"orderBy,omitempty" enum:"date_desc,date_asc,total_desc,total_asc"`
+	ReturnFullReceipt bool     `json:"returnFullReceipt,omitempty"`
+}
+
+var intentOrders = map[string]bool{"date_desc": true, "date_asc": true, "total_desc": true, "total_asc": true}
+
+var paymentMethods = map[string]bool{
+	models.PaymentCredit:  true,
+	models.PaymentDebit:   true,
+	models.PaymentPIX:     true,
+	models.PaymentCash:    true,
+	models.PaymentVoucher: true,
+	models.PaymentOther:   true,
+}
+
+func (r *Intent) validate() error {
+	switch r.Type {
+	case "direct":
+		if strings.TrimSpace(r.Answer) == "" {
+			return errors.New("direct answer is empty")
+		}
+		return nil
+	case "query":
+		if r.Specific == nil && r.General == nil {
+			return errors.New("query has no filters")
+		}
+	default:
+		return fmt.Errorf("unknown type %q", r.Type)
+	}
+
+	var errs []error
+	if r.Specific != nil {
+		if err := r.Specific.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("specific: %w", err))
+		}
+	}
+	if r.General != nil {
+		if err := r.General.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("general: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (f *IntentFilter) validate() error {
+	var errs []error
+	errs = checkDate(errs, "dateFrom", f.DateFrom)
+	errs = checkDate(errs, "dateTo", f.DateTo)
+	if f.MinPrice != nil && f.MaxPrice != nil && *f.MinPrice > *f.MaxPrice {
+		errs = append(errs, errors.New("minPrice is above maxPrice"))
+	}
+	for _, method := range f.PaymentMethod {
+		if !paymentMethods[method] {
+			errs = append(errs, fmt.Errorf("unknown paymentMethod %q", method))
+		}
+	}
+	if f.Limit != nil && *f.Limit < 1 {
+		errs = append(errs, errors.New("limit must be 1 or more"))
+	}
+	if f.OrderBy != "" && !intentOrders[f.OrderBy] {
+		errs = append(errs, fmt.Errorf("unknown orderBy %q", f.OrderBy))
+	}
+	return errors.Join(errs...)
+}
+
+func checkDate(errs []error, name, date string) []error {
+	if date == "" {
+		return errs
+	}
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		errs = append(errs, fmt.Errorf("%s %q is not a YYYY-MM-DD date", name, date))
+	}
+	return errs
+}
+
+// Response is the intent as the assistant handler runs it.
+func (r *Intent) Response() *models.AssistantIntentResponse {
+	return &models.AssistantIntentResponse{
+		Type:     r.Type,
+		Answer:   r.Answer,
+		Specific: r.Specific.queryFilter(),
+		General:  r.General.queryFilter(),
+	}
+}
+
+func (f *IntentFilter) queryFilter() *models.AssistantQueryFilter {
+	if f == nil {
+		return nil
+	}
+	return &models.AssistantQueryFilter{
+		ProductName:       f.ProductName,
+		Company:           f.Company,
+		Brand:             f.Brand,
+		Category:          f.Category,
+		Subcategory:       f.Subcategory,
+		DateFrom:          f.DateFrom,
+		DateTo:            f.DateTo,
+		MinPrice:          f.MinPrice,
+		MaxPrice:          f.MaxPrice,
+		PaymentMethod:     f.PaymentMethod,
+		HasDiscount:       f.HasDiscount,
+		Limit:             f.Limit,
+		OrderBy:           f.OrderBy,
+		ReturnFullReceipt: f.ReturnFullReceipt,
+	}
+}
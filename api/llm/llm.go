@@ -0,0 +1,89 @@
+// Package llm talks to the language models behind receipt extraction and
+// the assistant. Each provider (Gemini, any OpenAI-compatible server such as
+// OpenAI, Ollama or vLLM, and a deterministic fake) implements
+// ReceiptExtractor and ChatModel; a Registry routes model IDs to them.
+package llm
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"google.golang.org/genai"
+)
+
+// ErrEmptyResponse is returned when the model answers without any content.
+var ErrEmptyResponse = errors.New("no response from the model")
+
+// Page is one photo or document of a receipt.
+type Page struct {
+	MIMEType string
+	Data     []byte
+}
+
+// ReceiptRequest asks Model to read the receipt in Pages as Prompt says.
+type ReceiptRequest struct {
+	Model  string
+	Prompt string
+	Pages  []Page
+}
+
+// ChatRequest is a single-turn prompt; earlier turns go in the prompt.
+type ChatRequest struct {
+	Model  string
+	Prompt string
+}
+
+// ReceiptExtractor reads receipts into a validated ReceiptExtraction.
+type ReceiptExtractor interface {
+	ExtractReceipt(ctx context.Context, req ReceiptRequest) (*ReceiptExtraction, error)
+}
+
+// ChatModel answers prompts, in free text or as JSON decoded into out.
+// Structured answers are constrained to out's schema and validated; a
+// malformed or invalid answer is an *OutputError.
+type ChatModel interface {
+	Generate(ctx context.Context, req ChatRequest) (string, error)
+	GenerateJSON(ctx context.Context, req ChatRequest, out Output) error
+}
+
+// ModelOption is a model users can pick. ID is unique across providers and
+// is what preferences store.
+type ModelOption struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Provider    string `json:"provider"`
+}
+
+// IsTransient reports whether a failed model call is worth retrying: rate
+// limits, server errors, timeouts and empty, truncated or invalid answers.
+func IsTransient(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrEmptyResponse) {
+		return true
+	}
+
+	var outputErr *OutputError
+	if errors.As(err, &outputErr) {
+		return true
+	}
+
+	var code int
+	var apiErr genai.APIError
+	var statusErr *StatusError
+	switch {
+	case errors.As(err, &apiErr):
+		code = apiErr.Code
+	case errors.As(err, &statusErr):
+		code = statusErr.Code
+	}
+	if code != 0 {
+		return code == http.StatusRequestTimeout ||
+			code == http.StatusTooManyRequests ||
+			code >= http.StatusInternalServerError
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,165 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// StatusError is a non-2xx answer from an OpenAI-compatible server.
+type StatusError struct {
+	Code int
+	Body string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("model server returned %d: %s", e.Code, e.Body)
+}
+
+// OpenAI runs models through the chat completions API of OpenAI or any
+// server that speaks it, such as Ollama and vLLM. Pages are sent as data
+// URLs: images as image_url parts, PDFs as file parts, which not every
+// server accepts.
+type OpenAI struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+// NewOpenAI talks to the server at baseURL, e.g. "https://api.openai.com/v1"
+// or "http://localhost:11434/v1" for Ollama. apiKey may be empty.
+func NewOpenAI(baseURL, apiKey string) *OpenAI {
+	return &OpenAI{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiKey:  apiKey,
+		client:  &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+type openAIMessage struct {
+	Role    string      `json:"role"`
+	Content interface{} `json:"content"`
+}
+
+type openAIPart struct {
+	Type     string          `json:"type"`
+	Text     string          `json:"text,omitempty"`
+	ImageURL *openAIImageURL `json:"image_url,omitempty"`
+	File     *openAIFile     `json:"file,omitempty"`
+}
+
+type openAIImageURL struct {
+	URL string `json:"url"`
+}
+
+type openAIFile struct {
+	Filename string `json:"filename"`
+	FileData string `json:"file_data"`
+}
+
+type openAIRequest struct {
+	Model          string                 `json:"model"`
+	Messages       []openAIMessage        `json:"messages"`
+	ResponseFormat map[string]interface{} `json:"response_format,omitempty"`
+}
+
+type openAIResponse struct {
+	Choices []struct {
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+	} `json:"choices"`
+}
+
+func (o *OpenAI) ExtractReceipt(ctx context.Context, req ReceiptRequest) (*ReceiptExtraction, error) {
+	parts := []openAIPart{{Type: "text", Text: req.Prompt}}
+	for i, page := range req.Pages {
+		url := "data:" + page.MIMEType + ";base64," + base64.StdEncoding.EncodeToString(page.Data)
+		if strings.HasPrefix(page.MIMEType, "image/") {
+			parts = append(parts, openAIPart{Type: "image_url", ImageURL: &openAIImageURL{URL: url}})
+		} else {
+			parts = append(parts, openAIPart{Type: "file", File: &openAIFile{Filename: fmt.Sprintf("page-%d.pdf", i+1), FileData: url}})
+		}
+	}
+
+	var result ReceiptExtraction
+	if err := o.generateJSON(ctx, req.Model, parts, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (o *OpenAI) Generate(ctx context.Context, req ChatRequest) (string, error) {
+	return o.complete(ctx, openAIRequest{
+		Model:    req.Model,
+		Messages: []openAIMessage{{Role: "user", Content: req.Prompt}},
+	})
+}
+
+func (o *OpenAI) GenerateJSON(ctx context.Context, req ChatRequest, out Output) error {
+	return o.generateJSON(ctx, req.Model, []openAIPart{{Type: "text", Text: req.Prompt}}, out)
+}
+
+func (o *OpenAI) generateJSON(ctx context.Context, model string, parts []openAIPart, out Output) error {
+	text, err := o.complete(ctx, openAIRequest{
+		Model:    model,
+		Messages: []openAIMessage{{Role: "user", Content: parts}},
+		ResponseFormat: map[string]interface{}{
+			"type": "json_schema",
+			"json_schema": map[string]interface{}{
+				"name":   "output",
+				"strict": true,
+				"schema": outputSchema(out).jsonSchema(),
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return decodeOutput(text, out)
+}
+
+func (o *OpenAI) complete(ctx context.Context, req openAIRequest) (string, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, o.baseURL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if o.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+o.apiKey)
+	}
+
+	resp, err := o.client.Do(httpReq)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate content: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read model response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", &StatusError{Code: resp.StatusCode, Body: strings.TrimSpace(string(data))}
+	}
+
+	var result openAIResponse
+	if err := json.Unmarshal(data, &result); err != nil {
+		return "", fmt.Errorf("failed to parse model response: %w", err)
+	}
+	if len(result.Choices) == 0 || result.Choices[0].Message.Content == "" {
+		return "", ErrEmptyResponse
+	}
+	return result.Choices[0].Message.Content, nil
+}
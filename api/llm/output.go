@@ -0,0 +1,54 @@
+package llm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// OutputError is a model answer that doesn't decode into, or validate as,
+// the structure asked for. Raw is the answer as the model gave it.
+type OutputError struct {
+	Err error
+	Raw string
+}
+
+func (e *OutputError) Error() string {
+	return fmt.Sprintf("invalid model output: %v", e.Err)
+}
+
+func (e *OutputError) Unwrap() error { return e.Err }
+
+// RawOutput returns the model answer attached to err, if any.
+func RawOutput(err error) (string, bool) {
+	var outputErr *OutputError
+	if errors.As(err, &outputErr) {
+		return outputErr.Raw, true
+	}
+	return "", false
+}
+
+// Output is a structured answer: a *ReceiptExtraction or an *Intent.
+type Output interface {
+	validate() error
+}
+
+// decodeOutput decodes a model answer into out. The answer must be exactly
+// one JSON value with no fields out doesn't know, and must pass out's
+// validation.
+func decodeOutput(raw string, out Output) error {
+	decoder := json.NewDecoder(strings.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(out); err != nil {
+		return &OutputError{Err: err, Raw: raw}
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return &OutputError{Err: errors.New("unexpected data after the JSON value"), Raw: raw}
+	}
+	if err := out.validate(); err != nil {
+		return &OutputError{Err: err, Raw: raw}
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package llm
+
+import (
+	"buybuddy-api/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ReceiptExtraction is the receipt model's answer. Error is set instead of
+// the rest when the model can't read the receipt.
+type ReceiptExtraction struct {
+	Error         string          `json:"error,omitempty"`
+	Company       *string         `json:"company,omitempty"`
+	Date          *string         `json:"date,omitempty"`
+	Total         *float64        `json:"total,omitempty"`
+	Discount      *float64        `json:"discount,omitempty"`
+	TaxAmount     *float64        `json:"taxAmount,omitempty"`
+	PaymentMethod *string         `json:"paymentMethod,omitempty" enum:"credit,debit,pix,cash,voucher,other"`
+	AmountPaid    *float64        `json:"amountPaid,omitempty"`
+	Change        *float64        `json:"change,omitempty"`
+	AccessKey     *string         `json:"accessKey,omitempty"`
+	Items         []ExtractedItem `json:"items,omitempty"`
+}
+
+// ExtractedItem is one line of the receipt. RawName, NameOptions and
+// TotalPrice are required; TotalPrice is a pointer so a missing price is
+// told apart from a free item.
+type ExtractedItem struct {
+	RawName         string                  `json:"rawName"`
+	NameOptions     []string                `json:"nameOptions"`
+	Brand           *string                 `json:"brand,omitempty"`
+	Quantity        *float64                `json:"quantity,omitempty"`
+	Unit            *string                 `json:"unit,omitempty"`
+	UnitPrice       *float64                `json:"unitPrice,omitempty"`
+	TotalPrice      *float64                `json:"totalPrice"`
+	Discount        *float64                `json:"discount,omitempty"`
+	Page            *int                    `json:"page,omitempty"`
+	CategoryOptions []models.CategoryOption `json:"categoryOptions,omitempty"`
+	Confidence      *ItemConfidence         `json:"confidence,omitempty"`
+}
+
+// ItemConfidence is how sure, from 0 to 1, the model is of each field.
+type ItemConfidence struct {
+	Name       *float64 `json:"name,omitempty"`
+	Category   *float64 `json:"category,omitempty"`
+	Quantity   *float64 `json:"quantity,omitempty"`
+	TotalPrice *float64 `json:"totalPrice,omitempty"`
+}
+
+func (r *ReceiptExtraction) validate() error {
+	if r.Error != "" {
+		return nil
+	}
+
+	var errs []error
+	errs = checkNonNegative(errs, "total", r.Total)
+	errs = checkNonNegative(errs, "discount", r.Discount)
+	errs = checkNonNegative(errs, "taxAmount", r.TaxAmount)
+	errs = checkNonNegative(errs, "amountPaid", r.AmountPaid)
+	errs = checkNonNegative(errs, "change", r.Change)
+	for i, item := range r.Items {
+		if err := item.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("item %d: %w", i+1, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (item *ExtractedItem) validate() error {
+	var errs []error
+	if strings.TrimSpace(item.RawName) == "" {
+		errs = append(errs, errors.New("rawName is empty"))
+	}
+	named := false
+	for _, option := range item.NameOptions {
+		named = named || strings.TrimSpace(option) != ""
+	}
+	if !named {
+		errs = append(errs, errors.New("nameOptions has no name"))
+	}
+	if item.TotalPrice == nil {
+		errs = append(errs, errors.New("totalPrice is missing"))
+	}
+	errs = checkNonNegative(errs, "totalPrice", item.TotalPrice)
+	errs = checkNonNegative(errs, "quantity", item.Quantity)
+	errs = checkNonNegative(errs, "unitPrice", item.UnitPrice)
+	errs = checkNonNegative(errs, "discount", item.Discount)
+	if item.Page != nil && *item.Page < 1 {
+		errs = append(errs, errors.New("page must be 1 or more"))
+	}
+	for i, option := range item.CategoryOptions {
+		if strings.TrimSpace(option.Category) == "" {
+			errs = append(errs, fmt.Errorf("categoryOptions[%d] has no category", i))
+		}
+	}
+	if c := item.Confidence; c != nil {
+		errs = checkConfidence(errs, "name", c.Name)
+		errs = checkConfidence(errs, "category", c.Category)
+		errs = checkConfidence(errs, "quantity", c.Quantity)
+		errs = checkConfidence(errs, "totalPrice", c.TotalPrice)
+	}
+	return errors.Join(errs...)
+}
+
+func checkNonNegative(errs []error, name string, value *float64) []error {
+	if value != nil && *value < 0 {
+		errs = append(errs, fmt.Errorf("%s is negative", name))
+	}
+	return errs
+}
+
+func checkConfidence(errs []error, name string, value *float64) []error {
+	if value != nil && (*value < 0 || *value > 1) {
+		errs = append(errs, fmt.Errorf("confidence.%s is outside 0..1", name))
+	}
+	return errs
+}
+
+// Fields returns the item as the map the rest of the pipeline reads, with
+// the same keys and value types as decoded JSON.
+func (item *ExtractedItem) Fields() (map[string]interface{}, error) {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// ReceiptLines is the model's reading of receipt lines the text grammar
+// could not parse. Each line the model understood is listed by number;
+// Item is null for lines that are not items, such as headers or notices.
+type ReceiptLines struct {
+	Lines []ReceiptLine `json:"lines"`
+}
+
+type ReceiptLine struct {
+	Line int            `json:"line"`
+	Item *ExtractedItem `json:"item,omitempty"`
+}
+
+func (r *ReceiptLines) validate() error {
+	var errs []error
+	for _, line := range r.Lines {
+		if line.Line < 1 {
+			errs = append(errs, fmt.Errorf("line %d: line numbers start at 1", line.Line))
+			continue
+		}
+		if line.Item == nil {
+			continue
+		}
+		if err := line.Item.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %w", line.Line, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,223 @@
+package llm
+
+import (
+	"buybuddy-api/config"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+)
+
+var (
+	// ErrNoModel is returned when no provider offers a model of the kind
+	// asked for.
+	ErrNoModel = errors.New("no model is configured")
+	// ErrUnknownModel is returned for a model ID no provider offers.
+	ErrUnknownModel = errors.New("unknown model")
+)
+
+type receiptRoute struct {
+	extractor ReceiptExtractor
+	model     string
+}
+
+type chatRoute struct {
+	chat  ChatModel
+	model string
+}
+
+// Registry routes model IDs to the providers that serve them.
+type Registry struct {
+	receipt       map[string]receiptRoute
+	chat          map[string]chatRoute
+	receiptModels []ModelOption
+	chatModels    []ModelOption
+
+	defaultReceipt string
+	defaultChat    string
+	intent         string
+}
+
+// New sets up the providers listed in cfg, in order. A provider without the
+// settings it needs is skipped with a warning, so the server still starts
+// without model credentials.
+func New(ctx context.Context, cfg config.LLMConfig) (*Registry, error) {
+	r := &Registry{
+		receipt: make(map[string]receiptRoute),
+		chat:    make(map[string]chatRoute),
+	}
+
+	for _, provider := range cfg.Providers {
+		switch provider {
+		case "gemini":
+			if cfg.GeminiAPIKey == "" {
+				log.Println("Warning: LLM provider gemini is enabled but GEMINI_API_KEY is not set")
+				continue
+			}
+			gemini, err := NewGemini(ctx, cfg.GeminiAPIKey)
+			if err != nil {
+				return nil, err
+			}
+			for _, option := range geminiReceiptModels {
+				r.addReceiptModel(provider, option, gemini, option.ID)
+			}
+			for _, option := range geminiChatModels {
+				r.addChatModel(provider, option, gemini, option.ID)
+			}
+		case "openai":
+			if len(cfg.OpenAI.ReceiptModels) == 0 && len(cfg.OpenAI.AssistantModels) == 0 {
+				log.Println("Warning: LLM provider openai is enabled but lists no models")
+				continue
+			}
+			openAI := NewOpenAI(cfg.OpenAI.BaseURL, cfg.OpenAI.APIKey)
+			for _, model := range cfg.OpenAI.ReceiptModels {
+				r.addReceiptModel(provider, openAIOption(model), openAI, model)
+			}
+			for _, model := range cfg.OpenAI.AssistantModels {
+				r.addChatModel(provider, openAIOption(model), openAI, model)
+			}
+		case "fake":
+			for _, option := range fakeModels {
+				r.addReceiptModel(provider, option, Fake{}, option.ID)
+				r.addChatModel(provider, option, Fake{}, option.ID)
+			}
+		default:
+			return nil, fmt.Errorf("unknown LLM provider %q", provider)
+		}
+	}
+
+	var err error
+	if r.defaultReceipt, err = pickDefault(cfg.ReceiptModel, r.receiptModels, r.IsReceiptModel); err != nil {
+		return nil, fmt.Errorf("receipt model: %w", err)
+	}
+	if r.defaultChat, err = pickDefault(cfg.AssistantModel, r.chatModels, r.IsChatModel); err != nil {
+		return nil, fmt.Errorf("assistant model: %w", err)
+	}
+	if r.intent, err = pickDefault(cfg.IntentModel, nil, r.IsChatModel); err != nil {
+		return nil, fmt.Errorf("intent model: %w", err)
+	}
+	if r.intent == "" {
+		r.intent = r.defaultChat
+	}
+	return r, nil
+}
+
+func openAIOption(model string) ModelOption {
+	return ModelOption{ID: "openai:" + model, Name: model, Description: "OpenAI-compatible server"}
+}
+
+// addReceiptModel registers a receipt model; an ID already taken by an
+// earlier provider keeps that provider.
+func (r *Registry) addReceiptModel(provider string, option ModelOption, extractor ReceiptExtractor, model string) {
+	if _, ok := r.receipt[option.ID]; ok {
+		return
+	}
+	option.Provider = provider
+	r.receipt[option.ID] = receiptRoute{extractor: extractor, model: model}
+	r.receiptModels = append(r.receiptModels, option)
+}
+
+func (r *Registry) addChatModel(provider string, option ModelOption, chat ChatModel, model string) {
+	if _, ok := r.chat[option.ID]; ok {
+		return
+	}
+	option.Provider = provider
+	r.chat[option.ID] = chatRoute{chat: chat, model: model}
+	r.chatModels = append(r.chatModels, option)
+}
+
+func pickDefault(configured string, options []ModelOption, known func(string) bool) (string, error) {
+	if configured != "" {
+		if !known(configured) {
+			return "", fmt.Errorf("%w %q", ErrUnknownModel, configured)
+		}
+		return configured, nil
+	}
+	if len(options) == 0 {
+		return "", nil
+	}
+	return options[0].ID, nil
+}
+
+// ReceiptModels lists the receipt models of every provider, the default
+// first.
+func (r *Registry) ReceiptModels() []ModelOption {
+	return withDefaultFirst(r.receiptModels, r.defaultReceipt)
+}
+
+// ChatModels lists the assistant models of every provider, the default
+// first.
+func (r *Registry) ChatModels() []ModelOption {
+	return withDefaultFirst(r.chatModels, r.defaultChat)
+}
+
+func withDefaultFirst(options []ModelOption, id string) []ModelOption {
+	list := make([]ModelOption, 0, len(options))
+	for _, option := range options {
+		if option.ID == id {
+			list = append([]ModelOption{option}, list...)
+		} else {
+			list = append(list, option)
+		}
+	}
+	return list
+}
+
+func (r *Registry) IsReceiptModel(id string) bool {
+	_, ok := r.receipt[id]
+	return ok
+}
+
+func (r *Registry) IsChatModel(id string) bool {
+	_, ok := r.chat[id]
+	return ok
+}
+
+// DefaultReceiptModel is the receipt model ID used when the user has no
+// preference, or "" when none is configured.
+func (r *Registry) DefaultReceiptModel() string {
+	return r.defaultReceipt
+}
+
+// DefaultChatModel is the assistant model ID used when the user has no
+// preference, or "" when none is configured.
+func (r *Registry) DefaultChatModel() string {
+	return r.defaultChat
+}
+
+// Receipt returns the extractor serving a receipt model ID and the model's
+// name at its provider. An empty ID picks the default.
+func (r *Registry) Receipt(id string) (ReceiptExtractor, string, error) {
+	if id == "" {
+		id = r.defaultReceipt
+	}
+	if id == "" {
+		return nil, "", ErrNoModel
+	}
+	route, ok := r.receipt[id]
+	if !ok {
+		return nil, "", fmt.Errorf("%w %q", ErrUnknownModel, id)
+	}
+	return route.extractor, route.model, nil
+}
+
+// Chat returns the chat model serving an assistant model ID and the model's
+// name at its provider. An empty ID picks the default.
+func (r *Registry) Chat(id string) (ChatModel, string, error) {
+	if id == "" {
+		id = r.defaultChat
+	}
+	if id == "" {
+		return nil, "", ErrNoModel
+	}
+	route, ok := r.chat[id]
+	if !ok {
+		return nil, "", fmt.Errorf("%w %q", ErrUnknownModel, id)
+	}
+	return route.chat, route.model, nil
+}
+
+// Intent returns the chat model that turns questions into queries.
+func (r *Registry) Intent() (ChatModel, string, error) {
+	return r.Chat(r.intent)
+}
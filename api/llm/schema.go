@@ -0,0 +1,153 @@
+package llm
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"google.golang.org/genai"
+)
+
+// schema is the JSON shape of a Go type, from which each provider builds
+// its own response schema.
+type schema struct {
+	kind       string // string, number, integer, boolean, array or object
+	enum       []string
+	items      *schema
+	properties []property
+}
+
+type property struct {
+	name     string
+	schema   *schema
+	optional bool
+	// nullable is set on optional pointers, which may be null.
+	nullable bool
+}
+
+// schemaOf describes the JSON encoding of t. Fields follow their json
+// tags: those without omitempty are required, and an `enum:"a,b"` tag
+// limits a string, or the strings of a slice, to those values.
+func schemaOf(t reflect.Type) *schema {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return schemaOf(t.Elem())
+	case reflect.String:
+		return &schema{kind: "string"}
+	case reflect.Bool:
+		return &schema{kind: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &schema{kind: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &schema{kind: "number"}
+	case reflect.Slice, reflect.Array:
+		return &schema{kind: "array", items: schemaOf(t.Elem())}
+	case reflect.Struct:
+		s := &schema{kind: "object"}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if !field.IsExported() || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+
+			p := property{name: name, schema: schemaOf(field.Type)}
+			if enum := field.Tag.Get("enum"); enum != "" {
+				target := p.schema
+				if target.kind == "array" {
+					target = target.items
+				}
+				target.enum = strings.Split(enum, ",")
+			}
+			p.optional = strings.Contains(options, "omitempty")
+			p.nullable = p.optional && field.Type.Kind() == reflect.Pointer
+			s.properties = append(s.properties, p)
+		}
+		return s
+	default:
+		panic(fmt.Sprintf("no response schema for %s", t))
+	}
+}
+
+func outputSchema(out Output) *schema {
+	return schemaOf(reflect.TypeOf(out))
+}
+
+var genaiTypes = map[string]genai.Type{
+	"string":  genai.TypeString,
+	"number":  genai.TypeNumber,
+	"integer": genai.TypeInteger,
+	"boolean": genai.TypeBoolean,
+	"array":   genai.TypeArray,
+	"object":  genai.TypeObject,
+}
+
+// genai converts the schema to Gemini's OpenAPI subset.
+func (s *schema) genai() *genai.Schema {
+	g := &genai.Schema{Type: genaiTypes[s.kind]}
+	if len(s.enum) > 0 {
+		g.Format = "enum"
+		g.Enum = s.enum
+	}
+	if s.items != nil {
+		g.Items = s.items.genai()
+	}
+	if s.kind == "object" {
+		g.Properties = make(map[string]*genai.Schema, len(s.properties))
+		for _, p := range s.properties {
+			property := p.schema.genai()
+			if p.nullable {
+				property.Nullable = genai.Ptr(true)
+			}
+			g.Properties[p.name] = property
+			g.PropertyOrdering = append(g.PropertyOrdering, p.name)
+			if !p.optional {
+				g.Required = append(g.Required, p.name)
+			}
+		}
+	}
+	return g
+}
+
+// jsonSchema converts the schema to JSON Schema in the form OpenAI's strict
+// structured outputs accept: every property is listed as required, and the
+// optional ones may be null instead.
+func (s *schema) jsonSchema() map[string]interface{} {
+	return s.jsonSchemaNullable(false)
+}
+
+func (s *schema) jsonSchemaNullable(nullable bool) map[string]interface{} {
+	j := map[string]interface{}{"type": s.kind}
+	if nullable {
+		j["type"] = []string{s.kind, "null"}
+	}
+	if len(s.enum) > 0 {
+		enum := make([]interface{}, 0, len(s.enum)+1)
+		for _, value := range s.enum {
+			enum = append(enum, value)
+		}
+		if nullable {
+			enum = append(enum, nil)
+		}
+		j["enum"] = enum
+	}
+	if s.items != nil {
+		j["items"] = s.items.jsonSchema()
+	}
+	if s.kind == "object" {
+		properties := make(map[string]interface{}, len(s.properties))
+		required := make([]string, 0, len(s.properties))
+		for _, p := range s.properties {
+			properties[p.name] = p.schema.jsonSchemaNullable(p.optional)
+			required = append(required, p.name)
+		}
+		j["properties"] = properties
+		j["required"] = required
+		j["additionalProperties"] = false
+	}
+	return j
+}
@@ -3,10 +3,14 @@ package main
 import (
 	"buybuddy-api/config"
 	"buybuddy-api/database"
+	"buybuddy-api/llm"
 	"buybuddy-api/middleware"
 	"buybuddy-api/models"
 	"buybuddy-api/repository"
 	"buybuddy-api/routes"
+	"buybuddy-api/storage"
+	"buybuddy-api/utils"
+	"context"
 	"log"
 
 	"github.com/joho/godotenv"
@@ -25,22 +29,66 @@ func main() {
 		log.Fatal("Failed to connect to database:", err)
 	}
 
-	if err := database.Migrate(&models.User{}, &models.Session{}, &models.Category{}, &models.Subcategory{}, &models.Receipt{}, &models.ReceiptItem{}, &models.ChatMessage{}, &models.UserPreferences{}, &models.ShoppingList{}, &models.ShoppingListItem{}, &models.ShoppingListShare{}); err != nil {
+	if err := database.Migrate(&models.User{}, &models.Session{}, &models.Category{}, &models.Subcategory{}, &models.Store{}, &models.Product{}, &models.Receipt{}, &models.ReceiptItem{}, &models.ReceiptItemSplit{}, &models.ReceiptImage{}, &models.ReceiptReprocess{}, &models.ReceiptJob{}, &models.ItemNameMapping{}, &models.NormalizationRule{}, &models.ChatMessage{}, &models.UserPreferences{}, &models.ShoppingList{}, &models.ShoppingListItem{}, &models.ShoppingListShare{}); err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
+	if err := database.SetupSearch(); err != nil {
+		log.Fatal("Failed to set up search:", err)
+	}
+	if err := database.SetupReceipts(); err != nil {
+		log.Fatal("Failed to set up receipt indexes:", err)
+	}
 
 	categoryRepo := repository.NewCategoryRepository(database.DB)
 	if err := categoryRepo.SeedDefaultCategories(); err != nil {
 		log.Println("Warning: Failed to seed default categories:", err)
 	}
 
+	storeRepo := repository.NewStoreRepository(database.DB)
+	if linked, err := storeRepo.Backfill(); err != nil {
+		log.Println("Warning: Failed to link receipts to stores:", err)
+	} else if linked > 0 {
+		log.Printf("Linked %d receipts to stores", linked)
+	}
+
+	productRepo := repository.NewProductRepository(database.DB)
+	if linked, err := productRepo.Backfill(); err != nil {
+		log.Println("Warning: Failed to link receipt items to products:", err)
+	} else if linked > 0 {
+		log.Printf("Linked %d receipt items to products", linked)
+	}
+
+	receiptRepo := repository.NewReceiptRepository(database.DB)
+	if measured, err := receiptRepo.BackfillMeasurements(utils.MeasureItems); err != nil {
+		log.Println("Warning: Failed to measure receipt items:", err)
+	} else if measured > 0 {
+		log.Printf("Measured %d receipt items", measured)
+	}
+
+	mappingRepo := repository.NewItemMappingRepository(database.DB)
+	if learned, err := mappingRepo.Backfill(); err != nil {
+		log.Println("Warning: Failed to learn item names from receipts:", err)
+	} else if learned > 0 {
+		log.Printf("Learned item names from %d receipt items", learned)
+	}
+
+	store, err := storage.New(cfg.Storage)
+	if err != nil {
+		log.Fatal("Failed to initialize storage:", err)
+	}
+
+	llms, err := llm.New(context.Background(), cfg.LLM)
+	if err != nil {
+		log.Fatal("Failed to initialize LLM providers:", err)
+	}
+
 	e := echo.New()
 
 	e.Use(echomiddleware.Logger())
 	e.Use(echomiddleware.Recover())
 	e.Use(middleware.CORS(cfg.CORSOrigins))
 
-	routes.Setup(e, cfg, database.DB)
+	routes.Setup(e, cfg, database.DB, store, llms)
 
 	log.Printf("Starting server on port %s", cfg.Port)
 	if err := e.Start(":" + cfg.Port); err != nil {
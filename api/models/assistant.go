@@ -2,6 +2,7 @@ package models
 
 type AssistantQueryFilter struct {
 	ProductName       []string `json:"productName,omitempty"`
+	ProductID         []uint   `json:"productId,omitempty"`
 	Company           []string `json:"company,omitempty"`
 	Brand             []string `json:"brand,omitempty"`
 	Category          []string `json:"category,omitempty"`
@@ -10,6 +11,8 @@ type AssistantQueryFilter struct {
 	DateTo            string   `json:"dateTo,omitempty"`
 	MinPrice          *float64 `json:"minPrice,omitempty"`
 	MaxPrice          *float64 `json:"maxPrice,omitempty"`
+	PaymentMethod     []string `json:"paymentMethod,omitempty"`
+	HasDiscount       bool     `json:"hasDiscount,omitempty"`
 	Limit             *int     `json:"limit,omitempty"`
 	OrderBy           string   `json:"orderBy,omitempty"`
 	ReturnFullReceipt bool     `json:"returnFullReceipt,omitempty"`
@@ -30,17 +33,25 @@ type CompactReceiptItem struct {
 	Unit    string  `json:"u"`
 	UP      float64 `json:"up"`
 	TP      float64 `json:"tp"`
+	Disc    float64 `json:"dc,omitempty"`
 	Cat     string  `json:"cat,omitempty"`
 	SubCat  string  `json:"sc,omitempty"`
 	Barcode string  `json:"bc,omitempty"`
+	Product uint    `json:"pid,omitempty"`
+	Size    float64 `json:"sz,omitempty"`
+	SizeU   string  `json:"su,omitempty"`
+	PPU     float64 `json:"ppu,omitempty"`
 }
 
 type CompactReceipt struct {
-	ID      string               `json:"id"`
-	Company string               `json:"co"`
-	Date    string               `json:"d,omitempty"`
-	Total   float64              `json:"t"`
-	Items   []CompactReceiptItem `json:"items,omitempty"`
+	ID       string               `json:"id"`
+	Company  string               `json:"co"`
+	Date     string               `json:"d,omitempty"`
+	Total    float64              `json:"t"`
+	Discount float64              `json:"ds,omitempty"`
+	Tax      float64              `json:"tx,omitempty"`
+	Payment  string               `json:"pm,omitempty"`
+	Items    []CompactReceiptItem `json:"items,omitempty"`
 }
 
 type CompactReceiptResponse struct {
@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// Receipt export formats.
+const (
+	ExportCSV       = "csv"
+	ExportJSON      = "json"
+	ExportLedger    = "ledger"
+	ExportBeancount = "beancount"
+)
+
+// ExportRow is one receipt item in an export, with the receipt it is on.
+type ExportRow struct {
+	ReceiptID       string    `json:"receiptId"`
+	Date            time.Time `json:"date"`
+	Store           string    `json:"store"`
+	StoreCNPJ       string    `json:"storeCnpj,omitempty"`
+	AccessKey       string    `json:"accessKey,omitempty"`
+	PaymentMethod   string    `json:"paymentMethod,omitempty"`
+	ReceiptTotal    float64   `json:"receiptTotal"`
+	ReceiptDiscount float64   `json:"receiptDiscount,omitempty"`
+	ItemID          uint      `json:"itemId"`
+	Name            string    `json:"name"`
+	RawName         string    `json:"rawName"`
+	Brand           string    `json:"brand,omitempty"`
+	Barcode         string    `json:"barcode,omitempty"`
+	Category        string    `json:"category,omitempty"`
+	Subcategory     string    `json:"subcategory,omitempty"`
+	Quantity        float64   `json:"quantity"`
+	Unit            string    `json:"unit"`
+	UnitPrice       float64   `json:"unitPrice"`
+	Discount        float64   `json:"discount,omitempty"`
+	TotalPrice      float64   `json:"totalPrice"`
+}
+
+// ExportAccounts maps receipts onto accounts in the ledger and beancount
+// exports. Categories are keyed by category name or "Category:Subcategory",
+// payments by PaymentMethod; unmapped ones get default accounts.
+type ExportAccounts struct {
+	Categories map[string]string `json:"categories,omitempty"`
+	Payments   map[string]string `json:"payments,omitempty"`
+	Discount   string            `json:"discount,omitempty"`
+}
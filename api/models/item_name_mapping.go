@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// ItemNameMapping is a name the user has given to an item as it is printed on
+// receipts. It is learned when receipts are saved and when items are renamed,
+// and the most relevant ones are given to the receipt model so it names items
+// the way the user does. RawKey is the normalized raw name.
+type ItemNameMapping struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	UserID     string    `gorm:"type:uuid;not null;uniqueIndex:idx_item_name_mappings_user_key" json:"-"`
+	User       *User     `gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
+	RawKey     string    `gorm:"not null;uniqueIndex:idx_item_name_mappings_user_key" json:"-"`
+	RawName    string    `gorm:"not null" json:"rawName"`
+	Name       string    `gorm:"not null" json:"name"`
+	StoreID    *uint     `gorm:"index" json:"storeId,omitempty"`
+	Corrected  bool      `gorm:"not null;default:false" json:"corrected"`
+	UsageCount int       `gorm:"not null;default:0" json:"usageCount"`
+	LastUsedAt time.Time `gorm:"not null" json:"lastUsedAt"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// UpdateItemMappingRequest corrects the name a mapping gives.
+type UpdateItemMappingRequest struct {
+	Name string `json:"name" validate:"required"`
+}
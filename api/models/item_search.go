@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// ItemSearchResult is a receipt item found by item search. Rank is higher
+// for better matches.
+type ItemSearchResult struct {
+	ItemID       uint       `json:"itemId"`
+	ReceiptID    string     `json:"receiptId"`
+	ProductID    *uint      `json:"productId,omitempty"`
+	Name         string     `json:"name"`
+	RawName      string     `json:"rawName"`
+	Brand        string     `json:"brand,omitempty"`
+	Store        string     `json:"store"`
+	Date         *time.Time `json:"date,omitempty"`
+	Quantity     float64    `json:"quantity"`
+	Unit         string     `json:"unit"`
+	UnitPrice    float64    `json:"unitPrice"`
+	TotalPrice   float64    `json:"totalPrice"`
+	SizeUnit     string     `json:"sizeUnit,omitempty"`
+	PricePerUnit float64    `json:"pricePerUnit,omitempty"`
+	Rank         float64    `json:"rank"`
+}
@@ -0,0 +1,68 @@
+package models
+
+import "time"
+
+// NormalizationRule rewrites items whose raw name matches Pattern, a regular
+// expression matched case-insensitively, after extraction. Rules are tried in
+// ascending Position, then ID, and the first rule that matches an item is the
+// only one applied to it. Empty fields are left as extracted. Enabled has no
+// column default, which would make GORM skip a false on create.
+type NormalizationRule struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	UserID      string    `gorm:"type:uuid;not null;index" json:"-"`
+	User        *User     `gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
+	Position    int       `gorm:"not null;default:0" json:"position"`
+	Pattern     string    `gorm:"not null" json:"pattern"`
+	Name        string    `json:"name,omitempty"`
+	Category    string    `json:"category,omitempty"`
+	Subcategory string    `json:"subcategory,omitempty"`
+	Brand       string    `json:"brand,omitempty"`
+	Enabled     bool      `gorm:"not null" json:"enabled"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// NormalizationRuleRequest creates or replaces a rule. A rule created
+// without a position goes after the user's other rules.
+type NormalizationRuleRequest struct {
+	Position    *int   `json:"position,omitempty"`
+	Pattern     string `json:"pattern" validate:"required"`
+	Name        string `json:"name,omitempty"`
+	Category    string `json:"category,omitempty"`
+	Subcategory string `json:"subcategory,omitempty"`
+	Brand       string `json:"brand,omitempty"`
+	Enabled     *bool  `json:"enabled,omitempty"`
+}
+
+// RuleDryRunRequest is a rule to try against the saved items. RuleID places
+// it instead of that saved rule, so edits can be checked before saving.
+type RuleDryRunRequest struct {
+	NormalizationRuleRequest
+	RuleID *uint `json:"ruleId,omitempty"`
+}
+
+// RuleItemFields are the item fields a rule can set.
+type RuleItemFields struct {
+	Name        string `json:"name"`
+	Category    string `json:"category,omitempty"`
+	Subcategory string `json:"subcategory,omitempty"`
+	Brand       string `json:"brand,omitempty"`
+}
+
+// RuleDryRunItem is a saved item the rule would change.
+type RuleDryRunItem struct {
+	ItemID    uint           `json:"itemId"`
+	ReceiptID string         `json:"receiptId"`
+	RawName   string         `json:"rawName"`
+	Current   RuleItemFields `json:"current"`
+	Proposed  RuleItemFields `json:"proposed"`
+}
+
+// RuleDryRunResponse reports the items the rule matches, how many of those
+// an earlier rule takes first, and the ones it would change.
+type RuleDryRunResponse struct {
+	Matched  int              `json:"matched"`
+	Shadowed int              `json:"shadowed"`
+	Changed  int              `json:"changed"`
+	Items    []RuleDryRunItem `json:"items"`
+}
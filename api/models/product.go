@@ -0,0 +1,73 @@
+package models
+
+import "time"
+
+// Product ties together receipt items that are the same thing bought on
+// different occasions. It is identified by GTIN when the items have one and
+// by a normalized name/brand/size key otherwise. Merged products point at the
+// product they were merged into.
+type Product struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	UserID       string    `gorm:"type:uuid;not null;index;uniqueIndex:idx_products_user_gtin,where:gtin <> ''" json:"-"`
+	User         *User     `gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
+	GTIN         string    `gorm:"size:14;uniqueIndex:idx_products_user_gtin,where:gtin <> ''" json:"gtin,omitempty"`
+	Key          string    `gorm:"index" json:"-"`
+	Name         string    `gorm:"not null" json:"name"`
+	Brand        string    `json:"brand,omitempty"`
+	MergedIntoID *uint     `gorm:"index" json:"-"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+type ProductSummary struct {
+	Product       `gorm:"embedded"`
+	PurchaseCount int64      `json:"purchaseCount"`
+	LastPurchased *time.Time `json:"lastPurchased,omitempty"`
+	LastUnitPrice float64    `json:"lastUnitPrice"`
+	MinUnitPrice  float64    `json:"minUnitPrice"`
+	MaxUnitPrice  float64    `json:"maxUnitPrice"`
+	AvgUnitPrice  float64    `json:"avgUnitPrice"`
+
+	// Prices per SizeUnit (kg, L or un), comparable across package sizes.
+	SizeUnit         string  `json:"sizeUnit,omitempty"`
+	LastPricePerUnit float64 `json:"lastPricePerUnit"`
+	MinPricePerUnit  float64 `json:"minPricePerUnit"`
+	MaxPricePerUnit  float64 `json:"maxPricePerUnit"`
+	AvgPricePerUnit  float64 `json:"avgPricePerUnit"`
+}
+
+// ProductPurchase is one receipt item of a product.
+type ProductPurchase struct {
+	ItemID     uint       `json:"itemId"`
+	ReceiptID  string     `json:"receiptId"`
+	Date       *time.Time `json:"date,omitempty"`
+	Company    string     `json:"company"`
+	StoreID    *uint      `json:"storeId,omitempty"`
+	Name       string     `json:"name"`
+	Quantity   float64    `json:"quantity"`
+	Unit       string     `json:"unit"`
+	UnitPrice  float64    `json:"unitPrice"`
+	TotalPrice float64    `json:"totalPrice"`
+
+	PackageSize  float64 `json:"packageSize,omitempty"`
+	SizeUnit     string  `json:"sizeUnit,omitempty"`
+	PricePerUnit float64 `json:"pricePerUnit,omitempty"`
+}
+
+type ProductDetail struct {
+	Product
+	Purchases []ProductPurchase `json:"purchases"`
+}
+
+// MergeProductsRequest lists the products to fold into the one in the URL.
+type MergeProductsRequest struct {
+	ProductIDs []uint `json:"productIds" validate:"required"`
+}
+
+// SplitProductRequest moves the given items to a new product, named Name or
+// after the first item.
+type SplitProductRequest struct {
+	ItemIDs []uint `json:"itemIds" validate:"required"`
+	Name    string `json:"name,omitempty"`
+	Brand   string `json:"brand,omitempty"`
+}
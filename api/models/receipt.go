@@ -11,20 +11,90 @@ type Receipt struct {
 	UserID    string         `gorm:"type:uuid;not null;index" json:"userId"`
 	User      *User          `gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"user,omitempty"`
 	Company   string         `gorm:"not null" json:"company"`
+	StoreID   *uint          `gorm:"index" json:"storeId,omitempty"`
+	Store     *Store         `gorm:"foreignKey:StoreID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL" json:"store,omitempty"`
 	Date      *time.Time     `json:"date,omitempty"`
 	Total     float64        `gorm:"not null" json:"total"`
-	AccessKey string         `gorm:"uniqueIndex;size:44" json:"accessKey,omitempty"`
+	Discount  float64        `gorm:"not null;default:0" json:"discount,omitempty"`
+	TaxAmount float64        `gorm:"not null;default:0" json:"taxAmount,omitempty"`
+	AccessKey string         `gorm:"size:44" json:"accessKey,omitempty"`
 	ImageURL  string         `json:"imageUrl,omitempty"`
 	CreatedAt time.Time      `json:"createdAt"`
 	UpdatedAt time.Time      `json:"updatedAt"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 	Items     []ReceiptItem  `gorm:"foreignKey:ReceiptID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"items,omitempty"`
+
+	// Fields decoded from AccessKey
+	IssuerCNPJ    string `gorm:"size:14;index" json:"issuerCnpj,omitempty"`
+	State         string `gorm:"size:2" json:"state,omitempty"`
+	EmissionMonth string `gorm:"size:7" json:"emissionMonth,omitempty"`
+	FiscalModel   string `gorm:"size:2" json:"fiscalModel,omitempty"`
+	Series        int    `json:"series,omitempty"`
+	Number        int    `json:"number,omitempty"`
+	EmissionType  int    `json:"emissionType,omitempty"`
+
+	// Payment as printed on the receipt; PaymentMethod is one of the
+	// Payment* constants.
+	PaymentMethod string  `gorm:"size:16;index" json:"paymentMethod,omitempty"`
+	AmountPaid    float64 `json:"amountPaid,omitempty"`
+	Change        float64 `json:"change,omitempty"`
+
+	// Result of the last reconciliation of the items with Total
+	ReconciliationStatus   string                  `gorm:"size:16;index" json:"reconciliationStatus,omitempty"`
+	ReconciliationWarnings []ReconciliationWarning `gorm:"type:jsonb;serializer:json" json:"reconciliationWarnings,omitempty"`
+}
+
+const (
+	PaymentCredit  = "credit"
+	PaymentDebit   = "debit"
+	PaymentPIX     = "pix"
+	PaymentCash    = "cash"
+	PaymentVoucher = "voucher"
+	PaymentOther   = "other"
+)
+
+const (
+	ReconciliationBalanced    = "balanced"
+	ReconciliationDiscrepancy = "discrepancy"
+)
+
+const (
+	WarningTotalMismatch     = "total_mismatch"
+	WarningLineTotalMismatch = "line_total_mismatch"
+	WarningMissingPrice      = "missing_price"
+	WarningMissingTotal      = "missing_total"
+	WarningNoItems           = "no_items"
+)
+
+// ReconciliationWarning is one discrepancy found when checking a receipt.
+// Item is the index of the item it refers to (ItemID once saved); receipt
+// level warnings have neither.
+type ReconciliationWarning struct {
+	Code     string  `json:"code"`
+	Message  string  `json:"message"`
+	Item     *int    `json:"item,omitempty"`
+	ItemID   *uint   `json:"itemId,omitempty"`
+	Expected float64 `json:"expected"`
+	Actual   float64 `json:"actual"`
+}
+
+type Reconciliation struct {
+	Status     string  `json:"status"`
+	ItemsTotal float64 `json:"itemsTotal"`
+	// Discount is the part of the receipt discount not already taken off
+	// the items.
+	Discount      float64                 `json:"discount"`
+	ExpectedTotal float64                 `json:"expectedTotal"`
+	Difference    float64                 `json:"difference"`
+	Warnings      []ReconciliationWarning `json:"warnings"`
 }
 
 type ReceiptItem struct {
 	ID            uint           `gorm:"primaryKey" json:"id"`
 	ReceiptID     string         `gorm:"type:uuid;not null;index" json:"receiptId"`
 	Receipt       *Receipt       `gorm:"foreignKey:ReceiptID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
+	ProductID     *uint          `gorm:"index" json:"productId,omitempty"`
+	Product       *Product       `gorm:"foreignKey:ProductID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL" json:"-"`
 	RawName       string         `gorm:"not null" json:"rawName"`
 	Name          string         `gorm:"not null" json:"name"`
 	Brand         string         `json:"brand,omitempty"`
@@ -32,6 +102,8 @@ type ReceiptItem struct {
 	Unit          string         `gorm:"default:un" json:"unit"`
 	UnitPrice     float64        `gorm:"not null" json:"unitPrice"`
 	TotalPrice    float64        `gorm:"not null" json:"totalPrice"`
+	Discount      float64        `gorm:"not null;default:0" json:"discount,omitempty"`
+	TaxAmount     float64        `gorm:"not null;default:0" json:"taxAmount,omitempty"`
 	CategoryID    *uint          `gorm:"index" json:"categoryId,omitempty"`
 	SubcategoryID *uint          `gorm:"index" json:"subcategoryId,omitempty"`
 	Barcode       string         `json:"barcode,omitempty"`
@@ -39,6 +111,58 @@ type ReceiptItem struct {
 	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
 	Category      *Category      `gorm:"foreignKey:CategoryID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL" json:"category,omitempty"`
 	Subcategory   *Subcategory   `gorm:"foreignKey:SubcategoryID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL" json:"subcategory,omitempty"`
+
+	// Size of one unit of Quantity in SizeUnit (kg, L or un) and the price
+	// paid per SizeUnit, for comparing package sizes. See units.Measure.
+	PackageSize  float64 `gorm:"not null;default:0" json:"packageSize,omitempty"`
+	SizeUnit     string  `gorm:"size:4" json:"sizeUnit,omitempty"`
+	PricePerUnit float64 `gorm:"not null;default:0" json:"pricePerUnit,omitempty"`
+
+	// The alternatives extraction offered for the name and category, the
+	// first being the one chosen, and how sure it was of each field, from 0
+	// to 1 by JSON field name. Items with a low confidence wait in the review
+	// queue until the user confirms them.
+	NameOptions     []string           `gorm:"type:jsonb;serializer:json" json:"nameOptions,omitempty"`
+	CategoryOptions []CategoryOption   `gorm:"type:jsonb;serializer:json" json:"categoryOptions,omitempty"`
+	Confidence      map[string]float64 `gorm:"type:jsonb;serializer:json" json:"confidence,omitempty"`
+	ReviewedAt      *time.Time         `json:"reviewedAt,omitempty"`
+}
+
+// CategoryOption is a category and subcategory pair offered by extraction.
+type CategoryOption struct {
+	Category    string `json:"category"`
+	Subcategory string `json:"subcategory,omitempty"`
+}
+
+// ReceiptImage is an original photo or PDF page kept in blob storage. Images
+// are stored when a receipt is processed, under an UploadID, and linked to the
+// receipt once it is saved.
+type ReceiptImage struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	UserID       string    `gorm:"type:uuid;not null;index" json:"-"`
+	User         *User     `gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
+	UploadID     string    `gorm:"type:uuid;not null;index" json:"uploadId"`
+	ReceiptID    *string   `gorm:"type:uuid;index" json:"receiptId,omitempty"`
+	Receipt      *Receipt  `gorm:"foreignKey:ReceiptID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
+	Page         int       `gorm:"not null;default:1" json:"page"`
+	MIMEType     string    `gorm:"not null" json:"mimeType"`
+	Size         int       `json:"size"`
+	StorageKey   string    `gorm:"not null" json:"-"`
+	ThumbnailKey string    `json:"-"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// ReceiptReprocess is a re-extraction of a saved receipt with another model,
+// kept until the user decides which of the proposed changes to accept.
+type ReceiptReprocess struct {
+	ID        string     `gorm:"primaryKey;type:uuid;default:gen_random_uuid()" json:"id"`
+	ReceiptID string     `gorm:"type:uuid;not null;index" json:"receiptId"`
+	Receipt   *Receipt   `gorm:"foreignKey:ReceiptID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
+	UserID    string     `gorm:"type:uuid;not null;index" json:"userId"`
+	Model     string     `gorm:"not null" json:"model"`
+	Result    string     `gorm:"type:jsonb;not null" json:"-"`
+	AppliedAt *time.Time `json:"appliedAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
 }
 
 type Category struct {
@@ -64,7 +188,43 @@ type Subcategory struct {
 }
 
 type ProcessReceiptRequest struct {
-	Image string `json:"image" validate:"required"`
+	// Image is the legacy single-photo field; Pages takes precedence when set.
+	Image string        `json:"image"`
+	Pages []ReceiptPage `json:"pages,omitempty"`
+	// StoreID is the store the user says the receipt is from, if known. It
+	// picks the learned item names to send to the model.
+	StoreID *uint `json:"storeId,omitempty"`
+}
+
+// ReceiptPage is one base64-encoded photo or PDF of a receipt, in reading order.
+type ReceiptPage struct {
+	Data     string `json:"data" validate:"required"`
+	MimeType string `json:"mimeType,omitempty"`
+}
+
+type ImportQRCodeRequest struct {
+	QRCode string `json:"qrCode" validate:"required"`
+}
+
+// ProcessTextRequest is the OCR text of a printed NFC-e, read on the phone.
+type ProcessTextRequest struct {
+	Text    string `json:"text" validate:"required"`
+	StoreID *uint  `json:"storeId,omitempty"`
+}
+
+type ImportResult struct {
+	File      string `json:"file"`
+	Status    string `json:"status"`
+	ReceiptID string `json:"receiptId,omitempty"`
+	AccessKey string `json:"accessKey,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+type ImportResponse struct {
+	Imported   int            `json:"imported"`
+	Duplicates int            `json:"duplicates"`
+	Failed     int            `json:"failed"`
+	Results    []ImportResult `json:"results"`
 }
 
 type ProcessReceiptResponse struct {
@@ -76,11 +236,106 @@ type ProcessReceiptResponse struct {
 }
 
 type SaveReceiptRequest struct {
+	UploadID  string                   `json:"uploadId,omitempty"`
 	Company   string                   `json:"company" validate:"required"`
 	Date      string                   `json:"date,omitempty"`
 	Total     float64                  `json:"total" validate:"required"`
+	Discount  float64                  `json:"discount,omitempty"`
 	AccessKey string                   `json:"accessKey,omitempty"`
 	Items     []map[string]interface{} `json:"items" validate:"required"`
+
+	TaxAmount     float64 `json:"taxAmount,omitempty"`
+	PaymentMethod string  `json:"paymentMethod,omitempty"`
+	AmountPaid    float64 `json:"amountPaid,omitempty"`
+	Change        float64 `json:"change,omitempty"`
+
+	// Force saves a receipt without an access key even when it looks like
+	// one already saved.
+	Force bool `json:"force,omitempty"`
+}
+
+// DuplicateCandidate is a saved receipt that a new one may duplicate, with
+// the signals compared. Score goes from 0 to 1.
+type DuplicateCandidate struct {
+	Receipt         *Receipt `json:"receipt"`
+	Score           float64  `json:"score"`
+	SameStore       bool     `json:"sameStore"`
+	MinutesApart    *float64 `json:"minutesApart,omitempty"`
+	TotalDifference float64  `json:"totalDifference"`
+	ItemSimilarity  float64  `json:"itemSimilarity"`
+}
+
+// UpdateReceiptRequest edits a saved receipt; omitted fields keep their value.
+// When Items is present it replaces the item list: entries with an id update
+// that item, entries without one are added and saved items that are missing
+// are removed. Total is recomputed from the items and Discount unless given,
+// in which case it must match them.
+type UpdateReceiptRequest struct {
+	Company  *string             `json:"company,omitempty"`
+	Date     *string             `json:"date,omitempty"`
+	Total    *float64            `json:"total,omitempty"`
+	Discount *float64            `json:"discount,omitempty"`
+	Items    *[]ReceiptItemInput `json:"items,omitempty"`
+}
+
+// ReceiptItemInput is an item edit. Category and Subcategory are names; an
+// empty string clears them. When only Quantity or UnitPrice changes,
+// TotalPrice is recomputed.
+type ReceiptItemInput struct {
+	ID          *uint    `json:"id,omitempty"`
+	RawName     *string  `json:"rawName,omitempty"`
+	Name        *string  `json:"name,omitempty"`
+	Brand       *string  `json:"brand,omitempty"`
+	Quantity    *float64 `json:"quantity,omitempty"`
+	Unit        *string  `json:"unit,omitempty"`
+	UnitPrice   *float64 `json:"unitPrice,omitempty"`
+	TotalPrice  *float64 `json:"totalPrice,omitempty"`
+	Category    *string  `json:"category,omitempty"`
+	Subcategory *string  `json:"subcategory,omitempty"`
+}
+
+type FieldChange struct {
+	Field    string      `json:"field"`
+	Current  interface{} `json:"current"`
+	Proposed interface{} `json:"proposed"`
+}
+
+const (
+	ItemDiffChanged   = "changed"
+	ItemDiffAdded     = "added"
+	ItemDiffRemoved   = "removed"
+	ItemDiffUnchanged = "unchanged"
+)
+
+// ItemDiff compares a saved item with the re-extracted one. Key identifies
+// the entry when accepting it: "item:<id>" for saved items and "new:<n>" for
+// items only found by the new extraction.
+type ItemDiff struct {
+	Key      string                 `json:"key"`
+	Status   string                 `json:"status"`
+	ItemID   *uint                  `json:"itemId,omitempty"`
+	Current  *ReceiptItem           `json:"current,omitempty"`
+	Proposed map[string]interface{} `json:"proposed,omitempty"`
+	Changes  []FieldChange          `json:"changes,omitempty"`
+}
+
+type ReceiptDiff struct {
+	Fields []FieldChange `json:"fields"`
+	Items  []ItemDiff    `json:"items"`
+}
+
+type ReprocessResponse struct {
+	ID        string `json:"id"`
+	ReceiptID string `json:"receiptId"`
+	Model     string `json:"model"`
+	ReceiptDiff
+}
+
+// AcceptReprocessRequest lists the receipt fields ("company", "date",
+// "total", "accessKey") and item keys to take from the new extraction.
+type AcceptReprocessRequest struct {
+	Fields []string `json:"fields"`
+	Items  []string `json:"items"`
 }
 
 type AssistantRequest struct {
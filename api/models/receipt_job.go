@@ -0,0 +1,50 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	JobQueued     = "queued"
+	JobProcessing = "processing"
+	JobCompleted  = "completed"
+	JobFailed     = "failed"
+)
+
+// Stages reported while a job is processing.
+const (
+	JobStageLoading    = "loading_images"
+	JobStageExtracting = "extracting"
+	JobStageChecking   = "checking"
+)
+
+// ReceiptJob is a receipt extraction run in the background. The pages are
+// read from the stored originals of UploadID, so a job survives restarts.
+// A failed attempt with a transient error is queued again for NextAttemptAt.
+type ReceiptJob struct {
+	ID            string     `gorm:"primaryKey;type:uuid;default:gen_random_uuid()" json:"id"`
+	UserID        string     `gorm:"type:uuid;not null;index" json:"-"`
+	User          *User      `gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
+	UploadID      string     `gorm:"type:uuid;not null" json:"uploadId"`
+	StoreID       *uint      `json:"storeId,omitempty"`
+	Model         string     `gorm:"not null" json:"model"`
+	Status        string     `gorm:"size:16;not null;index" json:"status"`
+	Stage         string     `gorm:"size:32" json:"stage,omitempty"`
+	Attempts      int        `gorm:"not null;default:0" json:"attempts"`
+	MaxAttempts   int        `gorm:"not null" json:"maxAttempts"`
+	NextAttemptAt time.Time  `gorm:"not null;index" json:"nextAttemptAt"`
+	Error         string     `json:"error,omitempty"`
+	Result        *string    `gorm:"type:jsonb" json:"-"`
+	StartedAt     *time.Time `json:"startedAt,omitempty"`
+	FinishedAt    *time.Time `json:"finishedAt,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	UpdatedAt     time.Time  `json:"updatedAt"`
+}
+
+// ReceiptJobResponse is a job with its result, the same data ProcessReceipt
+// returns, once completed.
+type ReceiptJobResponse struct {
+	ReceiptJob
+	Result json.RawMessage `json:"result,omitempty"`
+}
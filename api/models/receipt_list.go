@@ -0,0 +1,87 @@
+package models
+
+import "time"
+
+// Sort orders for the receipts listing. Receipts without a date sort by the
+// time they were saved.
+const (
+	ReceiptSortDateDesc    = "date_desc"
+	ReceiptSortDateAsc     = "date_asc"
+	ReceiptSortTotalDesc   = "total_desc"
+	ReceiptSortTotalAsc    = "total_asc"
+	ReceiptSortCreatedDesc = "created_desc"
+)
+
+// ReceiptListQuery filters and pages the receipts listing. Cursor is the
+// NextCursor of the previous page.
+type ReceiptListQuery struct {
+	Cursor      string
+	Limit       int
+	Sort        string
+	From        *time.Time
+	To          *time.Time
+	StoreIDs    []uint
+	CategoryIDs []uint
+	MinTotal    *float64
+	MaxTotal    *float64
+	Text        string
+}
+
+// ReceiptSummary is a receipt without its items, for listings.
+type ReceiptSummary struct {
+	ID                   string     `json:"id"`
+	Company              string     `json:"company"`
+	StoreID              *uint      `json:"storeId,omitempty"`
+	StoreName            string     `json:"storeName,omitempty"`
+	Date                 *time.Time `json:"date,omitempty"`
+	Total                float64    `json:"total"`
+	Discount             float64    `json:"discount,omitempty"`
+	PaymentMethod        string     `json:"paymentMethod,omitempty"`
+	AccessKey            string     `json:"accessKey,omitempty"`
+	ImageURL             string     `json:"imageUrl,omitempty"`
+	ReconciliationStatus string     `json:"reconciliationStatus,omitempty"`
+	ItemCount            int        `json:"itemCount"`
+	CreatedAt            time.Time  `json:"createdAt"`
+}
+
+// ReceiptListResponse is one page of receipts, full or summaries, with the
+// number of receipts matching the filters across all pages.
+type ReceiptListResponse struct {
+	Receipts   interface{} `json:"receipts"`
+	NextCursor string      `json:"nextCursor,omitempty"`
+	TotalCount int64       `json:"totalCount"`
+}
+
+// TrashedReceipt is a deleted receipt in the trash, purged for good at
+// PurgeAt.
+type TrashedReceipt struct {
+	ReceiptSummary
+	DeletedAt time.Time `json:"deletedAt"`
+	PurgeAt   time.Time `json:"purgeAt"`
+}
+
+// ReviewItem is an item waiting in the review queue, with the receipt it is
+// on and the fields extraction was unsure of.
+type ReviewItem struct {
+	Item      ReceiptItem `json:"item"`
+	ReceiptID string      `json:"receiptId"`
+	Store     string      `json:"store"`
+	Date      *time.Time  `json:"date,omitempty"`
+	LowFields []string    `json:"lowFields"`
+}
+
+// ReviewQueueResponse is the first items of the review queue and how many
+// are waiting in all.
+type ReviewQueueResponse struct {
+	Items      []ReviewItem `json:"items"`
+	TotalCount int64        `json:"totalCount"`
+}
+
+// ReviewItemRequest confirms an item in the review queue. NameOption and
+// CategoryOption pick one of the item's alternatives by index, Name types a
+// new name; an empty request confirms the item as it is.
+type ReviewItemRequest struct {
+	NameOption     *int    `json:"nameOption,omitempty"`
+	Name           *string `json:"name,omitempty"`
+	CategoryOption *int    `json:"categoryOption,omitempty"`
+}
@@ -0,0 +1,80 @@
+package models
+
+import "time"
+
+// ReceiptItemSplit assigns a share of a receipt item to another user. The
+// receipt's owner paid for it and keeps whatever share is not split off.
+// Like a shopping list share, a split is pending until the user accepts it,
+// and only accepted splits count in spending and balances.
+type ReceiptItemSplit struct {
+	ID        uint         `gorm:"primaryKey" json:"id"`
+	ReceiptID string       `gorm:"type:uuid;not null;index" json:"receiptId"`
+	Receipt   *Receipt     `gorm:"foreignKey:ReceiptID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
+	ItemID    uint         `gorm:"not null;uniqueIndex:idx_receipt_item_splits_item_user" json:"itemId"`
+	Item      *ReceiptItem `gorm:"foreignKey:ItemID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
+	UserID    string       `gorm:"type:uuid;not null;index;uniqueIndex:idx_receipt_item_splits_item_user" json:"userId"`
+	User      *User        `gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"user,omitempty"`
+	// Share is the fraction of the item, above 0 and up to 1.
+	Share     float64     `gorm:"not null" json:"share"`
+	Status    ShareStatus `gorm:"type:varchar(20);not null;default:'pending';index" json:"status"`
+	CreatedAt time.Time   `json:"createdAt"`
+
+	// Amount is Share of the item's total price.
+	Amount float64 `gorm:"-" json:"amount"`
+}
+
+// ReceiptSplitRequest replaces every split of a receipt; an empty list
+// removes them.
+type ReceiptSplitRequest struct {
+	Splits []ItemSplitRequest `json:"splits"`
+}
+
+// ItemSplitRequest gives Share of an item to the user with Email. A missing
+// share gives the whole item.
+type ItemSplitRequest struct {
+	ItemID uint    `json:"itemId"`
+	Email  string  `json:"email"`
+	Share  float64 `json:"share"`
+}
+
+// SplitShare is what one person's share of a receipt comes to.
+type SplitShare struct {
+	UserID string  `json:"userId"`
+	Email  string  `json:"email"`
+	Name   string  `json:"name"`
+	Owner  bool    `json:"owner,omitempty"`
+	Amount float64 `json:"amount"`
+}
+
+// ReceiptSplits is how a receipt is split: every split and each person's
+// total, the owner's included.
+type ReceiptSplits struct {
+	ReceiptID string             `json:"receiptId"`
+	Splits    []ReceiptItemSplit `json:"splits"`
+	Shares    []SplitShare       `json:"shares"`
+}
+
+// SharedReceipt is a receipt another user split with the caller, or
+// proposes to split while the splits are pending.
+type SharedReceipt struct {
+	ReceiptID  string     `json:"receiptId"`
+	OwnerID    string     `json:"ownerId"`
+	OwnerName  string     `json:"ownerName"`
+	OwnerEmail string     `json:"ownerEmail"`
+	Store      string     `json:"store"`
+	Date       *time.Time `json:"date,omitempty"`
+	ItemCount  int        `json:"itemCount"`
+	Amount     float64    `json:"amount"`
+}
+
+// SplitBalance is where the caller stands with another user across every
+// split receipt: OwedToYou for the caller's receipts, YouOwe for theirs, and
+// Net, positive when they owe the caller.
+type SplitBalance struct {
+	UserID    string  `json:"userId"`
+	Email     string  `json:"email"`
+	Name      string  `json:"name"`
+	OwedToYou float64 `json:"owedToYou"`
+	YouOwe    float64 `json:"youOwe"`
+	Net       float64 `json:"net"`
+}
@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// Store is a shop the user bought from, keyed by the issuer CNPJ when the
+// receipt has one and by the normalized company name otherwise. Merged stores
+// are kept, pointing at the store they were merged into, so receipts with
+// their CNPJ still find it.
+type Store struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	UserID       string    `gorm:"type:uuid;not null;index;uniqueIndex:idx_stores_user_cnpj,where:cnpj <> ''" json:"-"`
+	User         *User     `gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
+	CNPJ         string    `gorm:"size:14;uniqueIndex:idx_stores_user_cnpj,where:cnpj <> ''" json:"cnpj,omitempty"`
+	NameKey      string    `gorm:"index" json:"-"`
+	Name         string    `gorm:"not null" json:"name"`
+	LegalName    string    `json:"legalName,omitempty"`
+	Chain        string    `json:"chain,omitempty"`
+	Address      string    `json:"address,omitempty"`
+	City         string    `json:"city,omitempty"`
+	State        string    `gorm:"size:2" json:"state,omitempty"`
+	MergedIntoID *uint     `gorm:"index" json:"-"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// StoreDetails is what a receipt tells about its store.
+type StoreDetails struct {
+	CNPJ    string
+	Company string
+	Address string
+	City    string
+	State   string
+}
+
+type StoreSummary struct {
+	Store        `gorm:"embedded"`
+	ReceiptCount int64      `json:"receiptCount"`
+	TotalSpent   float64    `json:"totalSpent"`
+	LastVisit    *time.Time `json:"lastVisit,omitempty"`
+}
+
+type UpdateStoreRequest struct {
+	Name    *string `json:"name,omitempty"`
+	Chain   *string `json:"chain,omitempty"`
+	Address *string `json:"address,omitempty"`
+	City    *string `json:"city,omitempty"`
+}
+
+// MergeStoresRequest lists the stores to fold into the one in the URL.
+type MergeStoresRequest struct {
+	StoreIDs []uint `json:"storeIds" validate:"required"`
+}
@@ -8,4 +8,7 @@ type UserPreferences struct {
 	ReceiptModel   string `json:"receipt_model" gorm:"default:'gemini-2.5-flash'"`
 	AssistantModel string `json:"assistant_model" gorm:"default:'gemini-2.5-flash-lite'"`
 	User           User   `json:"-" gorm:"foreignKey:UserID;references:ID;constraint:OnDelete:CASCADE"`
+
+	// ExportAccounts overrides the accounts of the ledger exports.
+	ExportAccounts *ExportAccounts `json:"export_accounts,omitempty" gorm:"type:jsonb;serializer:json"`
 }
@@ -0,0 +1,94 @@
+package nfce
+
+import (
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// mgParser reads the Minas Gerais portal, which renders items as a Bootstrap
+// table with "Qtde total de ítens", "UN" and "Valor total R$" cells and
+// no unit price.
+type mgParser struct{}
+
+func (mgParser) Parse(r io.Reader) (*Receipt, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	receipt := &Receipt{}
+
+	if header := findFirst(doc, byTag("h4")); header != nil {
+		receipt.Company = textOf(header)
+	}
+
+	pageText := textOf(doc)
+	receipt.CNPJ = digitsOnly(cnpjRegex.FindString(labelValue(pageText, "CNPJ")))
+	receipt.Date = parseEmission(labelValue(pageText, "Data Emissão"))
+
+	if items := findFirst(doc, byID("myTable")); items != nil {
+		for _, row := range findAll(items, byTag("tr")) {
+			if item, ok := parseMGRow(row); ok {
+				receipt.Items = append(receipt.Items, item)
+			}
+		}
+	}
+
+	for _, cell := range findAll(doc, byTag("td")) {
+		text := textOf(cell)
+		if strings.HasPrefix(text, "Valor a pagar R$") {
+			receipt.Total = parseDecimal(strings.TrimPrefix(text, "Valor a pagar R$"))
+		} else if strings.HasPrefix(text, "Descontos R$") {
+			receipt.Discount = parseDecimal(strings.TrimPrefix(text, "Descontos R$"))
+		} else if strings.HasPrefix(text, "Troco R$") {
+			receipt.Change = parseDecimal(strings.TrimPrefix(text, "Troco R$"))
+		}
+	}
+
+	if key := findFirst(doc, byID("chaveAcesso")); key != nil {
+		receipt.AccessKey = digitsOnly(textOf(key))
+	}
+
+	if len(receipt.Items) == 0 {
+		return nil, ErrNoItems
+	}
+
+	return receipt, nil
+}
+
+func parseMGRow(row *html.Node) (Item, bool) {
+	cells := findAll(row, byTag("td"))
+	if len(cells) < 4 {
+		return Item{}, false
+	}
+
+	item := Item{Quantity: 1, Unit: "un"}
+
+	if name := findFirst(cells[0], byTag("h7")); name != nil {
+		item.Name = textOf(name)
+	}
+	if match := codeRegex.FindStringSubmatch(textOf(cells[0])); match != nil {
+		item.Code = match[1]
+	}
+
+	for _, cell := range cells[1:] {
+		text := textOf(cell)
+		switch {
+		case strings.HasPrefix(text, "Qtde"):
+			item.Quantity = parseDecimal(labelValue(text, ":"))
+		case strings.HasPrefix(text, "UN"):
+			item.Unit = strings.ToLower(labelValue(text, ":"))
+		case strings.HasPrefix(text, "Valor total"):
+			item.TotalPrice = parseDecimal(labelValue(text, "R$ "))
+		}
+	}
+
+	if item.Name == "" || item.TotalPrice == 0 {
+		return Item{}, false
+	}
+	item.UnitPrice = unitPrice(item.TotalPrice, item.Quantity)
+
+	return item, true
+}
@@ -0,0 +1,223 @@
+package nfce
+
+import (
+	"errors"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+var ErrNoItems = errors.New("no items found on the consultation page")
+
+// Receipt is the data read from a state consultation page.
+type Receipt struct {
+	Company string
+	CNPJ    string
+	Address string
+	Date    *time.Time
+	Total   float64
+	// Discount is the sum of every discount on the receipt, item discounts
+	// included; item totals are already net of their own.
+	Discount  float64
+	AccessKey string
+	Items     []Item
+
+	// Payment as shown by the portal; PaymentMethod is the printed text,
+	// e.g. "Cartão de Débito". TaxAmount is the Lei 12.741 approximation.
+	PaymentMethod string
+	AmountPaid    float64
+	Change        float64
+	TaxAmount     float64
+}
+
+type Item struct {
+	Code       string
+	Name       string
+	Quantity   float64
+	Unit       string
+	UnitPrice  float64
+	TotalPrice float64
+	// Discount is the item's own discount, already taken off TotalPrice.
+	Discount float64
+}
+
+// Parser reads a state's consultation page. Most states use the shared
+// "portal" layout; states with their own layout register a parser of their own.
+type Parser interface {
+	Parse(r io.Reader) (*Receipt, error)
+}
+
+var (
+	parsersMu sync.RWMutex
+	parsers   = map[string]Parser{
+		"MG": mgParser{},
+	}
+	defaultParser Parser = portalParser{}
+)
+
+func RegisterParser(state string, p Parser) {
+	parsersMu.Lock()
+	defer parsersMu.Unlock()
+	parsers[strings.ToUpper(state)] = p
+}
+
+func ParserFor(state string) Parser {
+	parsersMu.RLock()
+	defer parsersMu.RUnlock()
+	if p, ok := parsers[strings.ToUpper(state)]; ok {
+		return p
+	}
+	return defaultParser
+}
+
+var (
+	brasilia      = time.FixedZone("BRT", -3*60*60)
+	emissionRegex = regexp.MustCompile(`(\d{2}/\d{2}/\d{4})\s+(\d{2}:\d{2}(?::\d{2})?)`)
+	cnpjRegex     = regexp.MustCompile(`\d{2}\.?\d{3}\.?\d{3}/?\d{4}-?\d{2}`)
+	codeRegex     = regexp.MustCompile(`C[óo]digo:\s*([^)\s]+)`)
+	numberRegex   = regexp.MustCompile(`\d[\d.,]*`)
+)
+
+// unitPrice derives a unit price, rounded to cents, for layouts that only show
+// the line total.
+func unitPrice(total, quantity float64) float64 {
+	if quantity <= 0 {
+		return total
+	}
+	return math.Round(total/quantity*100) / 100
+}
+
+// parseDecimal reads numbers in either Brazilian ("1.234,56") or plain
+// ("1234.56") notation.
+func parseDecimal(s string) float64 {
+	match := numberRegex.FindString(s)
+	if match == "" {
+		return 0
+	}
+	if strings.Contains(match, ",") {
+		match = strings.ReplaceAll(match, ".", "")
+		match = strings.ReplaceAll(match, ",", ".")
+	}
+	value, _ := strconv.ParseFloat(strings.TrimRight(match, "."), 64)
+	return value
+}
+
+func parseEmission(text string) *time.Time {
+	match := emissionRegex.FindStringSubmatch(text)
+	if match == nil {
+		return nil
+	}
+	layout := "02/01/2006 15:04:05"
+	if len(match[2]) == 5 {
+		layout = "02/01/2006 15:04"
+	}
+	parsed, err := time.ParseInLocation(layout, match[1]+" "+match[2], brasilia)
+	if err != nil {
+		return nil
+	}
+	return &parsed
+}
+
+func digitsOnly(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// labelValue returns what follows label in text, e.g. "Qtde.: 2" → "2".
+func labelValue(text, label string) string {
+	idx := strings.Index(text, label)
+	if idx == -1 {
+		return strings.TrimSpace(text)
+	}
+	return strings.TrimSpace(text[idx+len(label):])
+}
+
+func hasClass(n *html.Node, class string) bool {
+	for _, attr := range n.Attr {
+		if attr.Key == "class" {
+			for _, c := range strings.Fields(attr.Val) {
+				if c == class {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func findAll(n *html.Node, match func(*html.Node) bool) []*html.Node {
+	var out []*html.Node
+	var walk func(*html.Node)
+	walk = func(node *html.Node) {
+		if node.Type == html.ElementNode && match(node) {
+			out = append(out, node)
+		}
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(n)
+	return out
+}
+
+func findFirst(n *html.Node, match func(*html.Node) bool) *html.Node {
+	if found := findAll(n, match); len(found) > 0 {
+		return found[0]
+	}
+	return nil
+}
+
+func byID(id string) func(*html.Node) bool {
+	return func(n *html.Node) bool { return attr(n, "id") == id }
+}
+
+func byClass(class string) func(*html.Node) bool {
+	return func(n *html.Node) bool { return hasClass(n, class) }
+}
+
+func byTag(tag string) func(*html.Node) bool {
+	return func(n *html.Node) bool { return n.Data == tag }
+}
+
+// textOf returns the visible text of a node with whitespace collapsed.
+func textOf(n *html.Node) string {
+	if n == nil {
+		return ""
+	}
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(node *html.Node) {
+		if node.Type == html.TextNode {
+			b.WriteString(node.Data)
+			b.WriteByte(' ')
+		}
+		if node.Type == html.ElementNode && (node.Data == "script" || node.Data == "style") {
+			return
+		}
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(b.String()), " ")
+}
@@ -0,0 +1,133 @@
+package nfce
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html/charset"
+)
+
+// consultationURLs are the public QR code consultation pages, used when the
+// client sends only the payload and not the full URL. QR code URLs are only
+// fetched when their host is one of these.
+var consultationURLs = map[string]string{
+	"SP": "https://www.nfce.fazenda.sp.gov.br/NFCeConsultaPublica/Paginas/ConsultaQRCode.aspx",
+	"RS": "https://www.sefaz.rs.gov.br/NFCE/NFCE-COM.aspx",
+	"PR": "http://www.fazenda.pr.gov.br/nfce/qrcode",
+	"MG": "https://portalsped.fazenda.mg.gov.br/portalnfce/sistema/qrcode.xhtml",
+	"RJ": "https://consultadfe.fazenda.rj.gov.br/consultaNFCe/QRCode",
+	"SC": "https://sat.sef.sc.gov.br/nfce/consulta",
+	"BA": "http://nfe.sefaz.ba.gov.br/servicos/nfce/qrcode.aspx",
+	"GO": "http://nfe.sefaz.go.gov.br/nfeweb/sites/nfce/danfeNFCe",
+	"DF": "http://dec.fazenda.df.gov.br/ConsultarNFCe.aspx",
+}
+
+const maxPageSize = 5 << 20
+
+type Client struct {
+	httpClient *http.Client
+	// portalURL, when set, replaces the scheme and host of every consultation
+	// URL so requests go to a local stand-in instead of the state portals.
+	portalURL string
+}
+
+func NewClient(portalURL string) *Client {
+	return &Client{
+		httpClient: &http.Client{Timeout: 20 * time.Second},
+		portalURL:  portalURL,
+	}
+}
+
+// Fetch downloads the consultation page for the QR code and parses it with
+// the parser registered for the issuing state.
+func (c *Client) Fetch(ctx context.Context, qr *QRCode) (*Receipt, error) {
+	target, err := c.consultationURL(qr)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; BuyBuddy/1.0)")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach state portal: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("state portal returned status %d", resp.StatusCode)
+	}
+
+	body, err := charset.NewReader(io.LimitReader(resp.Body, maxPageSize), resp.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode portal page: %w", err)
+	}
+
+	receipt, err := ParserFor(qr.AccessKey.State).Parse(body)
+	if err != nil {
+		return nil, err
+	}
+
+	if receipt.AccessKey == "" {
+		receipt.AccessKey = qr.AccessKey.Key
+	}
+	if receipt.CNPJ == "" {
+		receipt.CNPJ = qr.AccessKey.CNPJ
+	}
+
+	return receipt, nil
+}
+
+// isConsultationHost reports whether host is the host of one of the
+// consultationURLs, port included.
+func isConsultationHost(host string) bool {
+	host = strings.ToLower(host)
+	for _, base := range consultationURLs {
+		if parsed, err := url.Parse(base); err == nil && parsed.Host == host {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Client) consultationURL(qr *QRCode) (string, error) {
+	target := qr.URL
+	if target != "" {
+		parsed, err := url.Parse(target)
+		if err != nil || !isConsultationHost(parsed.Host) {
+			return "", ErrUnknownPortal
+		}
+	} else {
+		base, ok := consultationURLs[qr.AccessKey.State]
+		if !ok {
+			return "", fmt.Errorf("no consultation URL known for state %s", qr.AccessKey.State)
+		}
+		target = base + "?p=" + url.QueryEscape(qr.Payload)
+	}
+
+	if c.portalURL == "" {
+		return target, nil
+	}
+
+	parsed, err := url.Parse(target)
+	if err != nil {
+		return "", errors.New("invalid consultation URL")
+	}
+	override, err := url.Parse(c.portalURL)
+	if err != nil {
+		return "", errors.New("invalid portal override URL")
+	}
+	parsed.Scheme = override.Scheme
+	parsed.Host = override.Host
+	return parsed.String(), nil
+}
@@ -0,0 +1,136 @@
+package nfce
+
+import (
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// portalParser reads the layout shared by SP, RS/SVRS, PR and most other
+// states: items are rows of #tabResult with txtTit/RCod/Rqtd/RUN/RvlUnit/valor
+// spans, and the totals are in #totalNota.
+type portalParser struct{}
+
+func (portalParser) Parse(r io.Reader) (*Receipt, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	receipt := &Receipt{}
+
+	if header := findFirst(doc, byID("u20")); header != nil {
+		receipt.Company = textOf(header)
+	} else if header := findFirst(doc, byClass("txtTopo")); header != nil {
+		receipt.Company = textOf(header)
+	}
+
+	if center := findFirst(doc, byClass("txtCenter")); center != nil {
+		texts := findAll(center, byClass("text"))
+		for _, t := range texts {
+			value := textOf(t)
+			if strings.Contains(value, "CNPJ") {
+				receipt.CNPJ = digitsOnly(cnpjRegex.FindString(value))
+			} else if receipt.Address == "" && value != "" {
+				receipt.Address = value
+			}
+		}
+	}
+
+	if table := findFirst(doc, byID("tabResult")); table != nil {
+		for _, row := range findAll(table, byTag("tr")) {
+			if item, ok := parsePortalRow(row); ok {
+				receipt.Items = append(receipt.Items, item)
+			}
+		}
+	}
+
+	if totals := findFirst(doc, byID("totalNota")); totals != nil {
+		var largestPayment float64
+		for _, line := range findAll(totals, byID("linhaTotal")) {
+			labelNode := findFirst(line, byTag("label"))
+			label := strings.ToLower(textOf(labelNode))
+			value := findFirst(line, byClass("totalNumb"))
+			if value == nil {
+				continue
+			}
+			amount := parseDecimal(textOf(value))
+
+			switch {
+			case hasClass(value, "txtMax") || strings.Contains(label, "valor a pagar"):
+				receipt.Total = amount
+			case strings.HasPrefix(label, "descontos"):
+				receipt.Discount = amount
+			case strings.HasPrefix(label, "troco"):
+				receipt.Change = amount
+			case strings.Contains(label, "tributos"):
+				receipt.TaxAmount = amount
+			case labelNode != nil && hasClass(labelNode, "tx"):
+				// Payment lines follow "Forma de pagamento"; keep the
+				// method that paid the most.
+				receipt.AmountPaid += amount
+				if amount > largestPayment {
+					largestPayment = amount
+					receipt.PaymentMethod = textOf(labelNode)
+				}
+			}
+		}
+	}
+
+	if infos := findFirst(doc, byID("infos")); infos != nil {
+		receipt.Date = parseEmission(textOf(infos))
+	} else {
+		receipt.Date = parseEmission(textOf(doc))
+	}
+
+	if key := findFirst(doc, byClass("chave")); key != nil {
+		receipt.AccessKey = digitsOnly(textOf(key))
+	}
+
+	if len(receipt.Items) == 0 {
+		return nil, ErrNoItems
+	}
+
+	return receipt, nil
+}
+
+func parsePortalRow(row *html.Node) (Item, bool) {
+	name := findFirst(row, byClass("txtTit"))
+	if name == nil || hasClass(name, "noWrap") {
+		return Item{}, false
+	}
+
+	item := Item{
+		Name:     textOf(name),
+		Quantity: 1,
+		Unit:     "un",
+	}
+
+	if code := findFirst(row, byClass("RCod")); code != nil {
+		if match := codeRegex.FindStringSubmatch(textOf(code)); match != nil {
+			item.Code = match[1]
+		}
+	}
+	if qty := findFirst(row, byClass("Rqtd")); qty != nil {
+		item.Quantity = parseDecimal(labelValue(textOf(qty), ":"))
+	}
+	if unit := findFirst(row, byClass("RUN")); unit != nil {
+		item.Unit = strings.ToLower(labelValue(textOf(unit), ":"))
+	}
+	if unitPrice := findFirst(row, byClass("RvlUnit")); unitPrice != nil {
+		item.UnitPrice = parseDecimal(labelValue(textOf(unitPrice), ":"))
+	}
+	if total := findFirst(row, byClass("valor")); total != nil {
+		item.TotalPrice = parseDecimal(textOf(total))
+	}
+
+	if item.Name == "" || item.TotalPrice == 0 {
+		return Item{}, false
+	}
+	if item.UnitPrice == 0 {
+		item.UnitPrice = unitPrice(item.TotalPrice, item.Quantity)
+	}
+
+	return item, true
+}
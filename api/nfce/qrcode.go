@@ -0,0 +1,68 @@
+package nfce
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+
+	"buybuddy-api/fiscal"
+)
+
+var (
+	ErrInvalidQRCode = errors.New("could not find an NFC-e access key in the QR code")
+	// ErrUnknownPortal is returned for QR code URLs that don't point to a
+	// known state consultation page; the server never fetches other hosts.
+	ErrUnknownPortal = errors.New("QR code URL is not a known state consultation page")
+)
+
+// QRCode is the content of an NFC-e QR code. Version 2 codes carry
+// "p=chave|versao|tpAmb|..." as a query parameter of the state's consultation
+// URL; some readers only return the payload itself.
+type QRCode struct {
+	URL       string
+	Payload   string
+	AccessKey *fiscal.AccessKey
+}
+
+func ParseQRCode(raw string) (*QRCode, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, ErrInvalidQRCode
+	}
+
+	qr := &QRCode{Payload: raw}
+
+	if strings.HasPrefix(strings.ToLower(raw), "http://") || strings.HasPrefix(strings.ToLower(raw), "https://") {
+		parsed, err := url.Parse(raw)
+		if err != nil {
+			return nil, ErrInvalidQRCode
+		}
+		if !isConsultationHost(parsed.Host) {
+			return nil, ErrUnknownPortal
+		}
+		qr.URL = raw
+		qr.Payload = parsed.Query().Get("p")
+		if qr.Payload == "" {
+			// A few states use "chNFe" instead of the v2 "p" parameter.
+			qr.Payload = parsed.Query().Get("chNFe")
+		}
+	} else {
+		qr.Payload = strings.TrimPrefix(raw, "p=")
+	}
+
+	keyPart := qr.Payload
+	if idx := strings.Index(keyPart, "|"); idx != -1 {
+		keyPart = keyPart[:idx]
+	}
+
+	key, err := fiscal.Parse(keyPart)
+	if err != nil {
+		return nil, ErrInvalidQRCode
+	}
+	if !key.IsNFCe() {
+		return nil, errors.New("QR code does not belong to an NFC-e (model 65)")
+	}
+	qr.AccessKey = key
+
+	return qr, nil
+}
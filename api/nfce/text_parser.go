@@ -0,0 +1,340 @@
+package nfce
+
+import (
+	"buybuddy-api/normalize"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// TextReceipt is a receipt read from the OCR text of a printed NFC-e (the
+// DANFE NFC-e), with the item lines the grammar could not read.
+type TextReceipt struct {
+	Receipt
+	Unparsed []UnparsedLine
+}
+
+// UnparsedLine is an item line, or the lines of one wrapped item, that did
+// not fit the grammar. Position is the number of items read before it, so
+// items read from it some other way can be put back in order.
+type UnparsedLine struct {
+	Text     string
+	Position int
+}
+
+const money = `\d{1,3}(?:\.\d{3})+,\d{2}|\d+[.,]\d{2}`
+
+var (
+	// itemLineRegex splits a DANFE item line from the right: description,
+	// quantity, unit, an optional "x", unit price and line total, as in
+	// "001 7891000100103 LEITE UHT 1L 2 UN x 4,99 9,98".
+	itemLineRegex = regexp.MustCompile(`^(.+?)\s+(\d+(?:[.,]\d{1,4})?)\s*([A-Za-z]{1,4})\.?\s*(?:[xX*]\s*)?(\d{1,3}(?:\.\d{3})+,\d{2,4}|\d+[.,]\d{2,4})\s+(` + money + `)$`)
+	// itemTailRegex is the second line of a wrapped item: "2 UN x 4,99 9,98".
+	itemTailRegex = regexp.MustCompile(`^(\d+(?:[.,]\d{1,4})?)\s*([A-Za-z]{1,4})\.?\s*(?:[xX*]\s*)?(\d{1,3}(?:\.\d{3})+,\d{2,4}|\d+[.,]\d{2,4})\s+(` + money + `)$`)
+	// itemHeadRegex reads the item number and product code off the
+	// description; codes have at least four digits.
+	itemHeadRegex  = regexp.MustCompile(`^(?:(\d{1,3})\s+)?(?:(\d{4,14})\s+)?(.+)$`)
+	itemStartRegex = regexp.MustCompile(`^\d{1,14}\s`)
+	moneyRegex     = regexp.MustCompile(money)
+	keyLineRegex   = regexp.MustCompile(`^[\d\s]+$`)
+)
+
+// Labels are matched on normalize.Key of the line.
+var (
+	headerNoise   = []string{"DANFE", "DOCUMENTO AUXILIAR", "NFC E", "NOTA FISCAL", "CNPJ", "IE ", "INSCRICAO", "CPF"}
+	itemsHeader   = []string{"CODIGO DESCRICAO", "COD DESCRICAO", "ITEM CODIGO", "DESCRICAO QTD", "DESCRICAO QTDE"}
+	itemsEnd      = []string{"QTD TOTAL", "QTDE TOTAL", "QUANTIDADE TOTAL", "VALOR TOTAL", "VALOR A PAGAR", "SUBTOTAL", "TOTAL R", "DESCONTOS", "DESCONTO R", "ACRESCIMO", "FORMA DE PAGAMENTO", "FORMA PAGAMENTO"}
+	paymentLabels = []string{"FORMA DE PAGAMENTO", "FORMA PAGAMENTO"}
+)
+
+// lineTolerance is how far quantity times unit price may be from the line
+// total, for prices printed rounded or truncated.
+const lineTolerance = 0.02
+
+// ParseText reads the OCR text of a printed NFC-e. The layout is the same
+// in every state: the issuer, a table of items, the totals and payments,
+// the access key and the emission date. Item lines are read only when their
+// numbers add up; the rest are returned in Unparsed.
+func ParseText(text string) *TextReceipt {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	p := &textParser{receipt: &TextReceipt{}}
+	p.parse(lines)
+	return p.receipt
+}
+
+type textParser struct {
+	receipt *TextReceipt
+
+	// pending holds lines of an item that hasn't added up yet.
+	pending  []string
+	keyLines string
+	// total is "Valor a pagar"; subtotal is "Valor total", before discounts.
+	total, subtotal float64
+	largestPayment  float64
+}
+
+func (p *textParser) parse(lines []string) {
+	const (
+		header = iota
+		items
+		footer
+	)
+	state := header
+	inPayments := false
+	sawItems := false
+
+	for i, line := range lines {
+		key := normalize.Key(line)
+
+		p.readKeyLine(line)
+		if p.receipt.Date == nil && strings.Contains(key, "EMISS") {
+			p.receipt.Date = parseEmission(line)
+		}
+
+		switch state {
+		case header:
+			if hasAnyPrefix(key, itemsHeader) {
+				state, sawItems = items, true
+				continue
+			}
+			if _, ok := parseItemLine(line); ok {
+				state, sawItems = items, true
+				p.readItem(line)
+				continue
+			}
+			p.readHeader(line, key, i)
+			continue
+		case items:
+			if !hasAnyPrefix(key, itemsEnd) {
+				p.readItem(line)
+				continue
+			}
+			p.flush()
+			state = footer
+		}
+
+		if hasAnyPrefix(key, paymentLabels) {
+			inPayments = true
+			continue
+		}
+		if p.readTotal(line, key) {
+			inPayments = false
+			continue
+		}
+		if inPayments {
+			p.readPayment(line)
+		}
+	}
+	p.flush()
+
+	// Without an item table, lines with amounts that are not totals may
+	// still be items the grammar doesn't know.
+	if !sawItems {
+		for _, line := range lines {
+			key := normalize.Key(line)
+			if moneyRegex.MatchString(line) && !hasAnyPrefix(key, itemsEnd) && !strings.Contains(key, "TROCO") && !strings.Contains(key, "TRIBUTOS") {
+				p.receipt.Unparsed = append(p.receipt.Unparsed, UnparsedLine{Text: line})
+			}
+		}
+	}
+
+	r := &p.receipt.Receipt
+	// The footer's discount includes the item discounts; OCR may have lost
+	// the line, but not the item discounts read above.
+	itemDiscounts := 0.0
+	for _, item := range r.Items {
+		itemDiscounts += item.Discount
+	}
+	if itemDiscounts > r.Discount {
+		r.Discount = math.Round(itemDiscounts*100) / 100
+	}
+	r.Total = p.total
+	if r.Total == 0 && p.subtotal > 0 {
+		r.Total = math.Round((p.subtotal-r.Discount)*100) / 100
+	}
+	if r.Date == nil {
+		for _, line := range lines {
+			if r.Date = parseEmission(line); r.Date != nil {
+				break
+			}
+		}
+	}
+}
+
+// readHeader takes the issuer's name from the first line that isn't a
+// document title, its CNPJ, and the address from the line after those.
+func (p *textParser) readHeader(line, key string, index int) {
+	r := &p.receipt.Receipt
+	if strings.Contains(key, "CNPJ") && r.CNPJ == "" {
+		r.CNPJ = digitsOnly(cnpjRegex.FindString(line))
+		return
+	}
+	if hasAnyPrefix(key, headerNoise) || keyLineRegex.MatchString(line) {
+		return
+	}
+	switch {
+	case r.Company == "" && index < 5:
+		r.Company = line
+	case r.Company != "" && r.Address == "" && strings.Contains(line, ","):
+		r.Address = line
+	}
+}
+
+// readItem reads an item line, joining the lines of items whose
+// description wrapped.
+func (p *textParser) readItem(line string) {
+	if key := normalize.Key(line); strings.HasPrefix(key, "DESCONTO") || strings.HasPrefix(key, "DESC ITEM") {
+		p.flush()
+		items := p.receipt.Items
+		if match := moneyRegex.FindAllString(line, -1); len(match) > 0 && len(items) > 0 {
+			last := &items[len(items)-1]
+			last.Discount = math.Round((last.Discount+parseDecimal(match[len(match)-1]))*100) / 100
+			last.TotalPrice = math.Round((last.TotalPrice-parseDecimal(match[len(match)-1]))*100) / 100
+			return
+		}
+		p.pending = []string{line}
+		p.flush()
+		return
+	}
+
+	// A line that starts with an item number or code begins a new item,
+	// unless it is the quantity and prices of a wrapped one.
+	if len(p.pending) > 0 && itemStartRegex.MatchString(line) && !itemTailRegex.MatchString(line) {
+		p.flush()
+	}
+
+	joined := strings.Join(append(p.pending, line), " ")
+	if item, ok := parseItemLine(joined); ok {
+		p.receipt.Items = append(p.receipt.Items, item)
+		p.pending = nil
+		return
+	}
+
+	p.pending = append(p.pending, line)
+	// No description wraps over more than three lines.
+	if len(p.pending) == 3 {
+		p.flush()
+	}
+}
+
+func (p *textParser) flush() {
+	if len(p.pending) == 0 {
+		return
+	}
+	p.receipt.Unparsed = append(p.receipt.Unparsed, UnparsedLine{
+		Text:     strings.Join(p.pending, " "),
+		Position: len(p.receipt.Items),
+	})
+	p.pending = nil
+}
+
+// readTotal reads the totals block and reports whether line was part of it.
+func (p *textParser) readTotal(line, key string) bool {
+	amounts := moneyRegex.FindAllString(line, -1)
+	if len(amounts) == 0 {
+		return false
+	}
+	amount := parseDecimal(amounts[len(amounts)-1])
+
+	r := &p.receipt.Receipt
+	switch {
+	case strings.HasPrefix(key, "VALOR A PAGAR"):
+		p.total = amount
+	case strings.HasPrefix(key, "VALOR TOTAL"), strings.HasPrefix(key, "SUBTOTAL"), strings.HasPrefix(key, "TOTAL R"):
+		p.subtotal = amount
+	case strings.HasPrefix(key, "DESCONTO"):
+		r.Discount = amount
+	case strings.HasPrefix(key, "TROCO"):
+		r.Change = amount
+	case strings.Contains(key, "TRIBUTOS") || strings.Contains(key, "12 741"):
+		r.TaxAmount = amount
+	default:
+		return false
+	}
+	return true
+}
+
+// readPayment reads a line of the payments block, "Cartão de Débito 42,51";
+// the method paying the most is the receipt's.
+func (p *textParser) readPayment(line string) {
+	amounts := moneyRegex.FindAllStringIndex(line, -1)
+	if len(amounts) == 0 {
+		return
+	}
+	last := amounts[len(amounts)-1]
+	method := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(line[:last[0]]), "R$"))
+	amount := parseDecimal(line[last[0]:last[1]])
+	if method == "" {
+		return
+	}
+
+	r := &p.receipt.Receipt
+	r.AmountPaid = math.Round((r.AmountPaid+amount)*100) / 100
+	if amount > p.largestPayment {
+		p.largestPayment = amount
+		r.PaymentMethod = method
+	}
+}
+
+// readKeyLine collects the access key, printed as groups of digits on one
+// or two lines. Keys a digit or two off are kept for fiscal.Repair.
+func (p *textParser) readKeyLine(line string) {
+	if p.receipt.AccessKey != "" {
+		return
+	}
+	if !keyLineRegex.MatchString(line) || !strings.Contains(line, " ") {
+		p.keyLines = ""
+		return
+	}
+	p.keyLines += digitsOnly(line)
+	if n := len(p.keyLines); n >= 42 && n <= 46 {
+		p.receipt.AccessKey = p.keyLines
+	} else if n > 46 {
+		p.keyLines = digitsOnly(line)
+	}
+}
+
+// parseItemLine reads one item line and checks that quantity times unit
+// price comes to the total.
+func parseItemLine(line string) (Item, bool) {
+	match := itemLineRegex.FindStringSubmatch(line)
+	if match == nil {
+		return Item{}, false
+	}
+	head := itemHeadRegex.FindStringSubmatch(match[1])
+	if head == nil || !hasLetter(head[3]) {
+		return Item{}, false
+	}
+
+	item := Item{
+		Code:       head[2],
+		Name:       head[3],
+		Quantity:   parseDecimal(match[2]),
+		Unit:       strings.ToLower(match[3]),
+		UnitPrice:  parseDecimal(match[4]),
+		TotalPrice: parseDecimal(match[5]),
+	}
+	if item.Quantity <= 0 || math.Abs(item.Quantity*item.UnitPrice-item.TotalPrice) > lineTolerance {
+		return Item{}, false
+	}
+	return item, true
+}
+
+func hasAnyPrefix(key string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasLetter(s string) bool {
+	return strings.IndexFunc(s, func(r rune) bool { return r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' }) != -1
+}
@@ -0,0 +1,61 @@
+package normalize
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var sizeRegex = regexp.MustCompile(`(\d+(?:[.,]\d+)?)\s*(KGS?|GRS?|G|ML|LTS?|LITROS?|L)\b`)
+
+// ProductKey identifies a product without a barcode: the normalized name with
+// package sizes in base units ("1,5L" and "1500 ML" both give "1500ML") and
+// the brand when the name doesn't already carry it.
+func ProductKey(name, brand string) string {
+	key := Key(normalizeSizes(strings.ToUpper(RemoveAccents(name))))
+	if key == "" {
+		return ""
+	}
+
+	if brandKey := Key(brand); brandKey != "" && !strings.Contains(" "+key+" ", " "+brandKey+" ") {
+		key += " " + brandKey
+	}
+	return key
+}
+
+func normalizeSizes(name string) string {
+	return sizeRegex.ReplaceAllStringFunc(name, func(match string) string {
+		parts := sizeRegex.FindStringSubmatch(match)
+		amount, err := strconv.ParseFloat(strings.Replace(parts[1], ",", ".", 1), 64)
+		if err != nil {
+			return match
+		}
+
+		unit := parts[2]
+		switch {
+		case strings.HasPrefix(unit, "KG"):
+			amount, unit = amount*1000, "G"
+		case strings.HasPrefix(unit, "G"):
+			unit = "G"
+		case unit == "ML":
+		default:
+			amount, unit = amount*1000, "ML"
+		}
+		return strconv.FormatFloat(amount, 'f', -1, 64) + unit
+	})
+}
+
+// IsGTIN reports whether code looks like a GTIN-8/12/13/14 barcode.
+func IsGTIN(code string) bool {
+	switch len(code) {
+	case 8, 12, 13, 14:
+	default:
+		return false
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,43 @@
+package normalize
+
+import "strings"
+
+// legalSuffixes are company-type markers dropped from the end of store names.
+var legalSuffixes = map[string]bool{
+	"LTDA": true, "ME": true, "EPP": true, "EIRELI": true, "MEI": true,
+	"SA": true, "S": true, "A": true, "CIA": true, "LIMITADA": true,
+}
+
+// unknownCompany is the placeholder used when no company could be read.
+const unknownCompany = "UNKNOWN COMPANY"
+
+// StoreKey is the key receipts without a CNPJ are clustered by:
+// "SUPERMERCADO X LTDA" and "Supermercado X" both give "SUPERMERCADO X".
+// It is empty for unknown companies.
+func StoreKey(company string) string {
+	key := Key(company)
+	if key == unknownCompany {
+		return ""
+	}
+	return strings.Join(trimLegalSuffixes(strings.Fields(key)), " ")
+}
+
+// StoreName cleans a company name as printed for display.
+func StoreName(company string) string {
+	words := strings.Fields(company)
+	for len(words) > 1 {
+		last := strings.ReplaceAll(Key(words[len(words)-1]), " ", "")
+		if last != "" && !legalSuffixes[last] {
+			break
+		}
+		words = words[:len(words)-1]
+	}
+	return TitleCase(strings.Join(words, " "))
+}
+
+func trimLegalSuffixes(words []string) []string {
+	for len(words) > 1 && legalSuffixes[words[len(words)-1]] {
+		words = words[:len(words)-1]
+	}
+	return words
+}
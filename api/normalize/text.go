@@ -0,0 +1,59 @@
+// Package normalize turns names printed or typed in different ways into
+// comparable keys and clean display forms.
+package normalize
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// RemoveAccents strips diacritics: "Feijão" becomes "Feijao".
+func RemoveAccents(value string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	result, _, err := transform.String(t, value)
+	if err != nil {
+		return value
+	}
+	return result
+}
+
+// Key upper-cases value, strips accents and punctuation and
+// collapses spaces, for comparing names typed or printed differently.
+func Key(value string) string {
+	value = strings.ToUpper(RemoveAccents(value))
+	value = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return ' '
+	}, value)
+	return strings.Join(strings.Fields(value), " ")
+}
+
+// lowercaseWords stay lower case in title-cased names.
+var lowercaseWords = map[string]bool{
+	"de": true, "da": true, "do": true, "das": true, "dos": true, "e": true,
+}
+
+// TitleCase turns an all-caps name into "Supermercado da Esquina". Names that
+// already mix cases are left alone.
+func TitleCase(value string) string {
+	if value != strings.ToUpper(value) {
+		return value
+	}
+
+	words := strings.Fields(strings.ToLower(value))
+	for i, word := range words {
+		if i > 0 && lowercaseWords[word] {
+			continue
+		}
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		words[i] = string(runes)
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,187 @@
+package repository
+
+import (
+	"buybuddy-api/models"
+	"buybuddy-api/normalize"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ItemMappingRepository struct {
+	db *gorm.DB
+}
+
+func NewItemMappingRepository(db *gorm.DB) *ItemMappingRepository {
+	return &ItemMappingRepository{db: db}
+}
+
+// GetByUserID lists the user's mappings, most used first. query filters by
+// raw or learned name.
+func (r *ItemMappingRepository) GetByUserID(userID, query string, storeID *uint, limit int) ([]models.ItemNameMapping, error) {
+	var mappings []models.ItemNameMapping
+	db := r.db.Where("user_id = ?", userID)
+	if query != "" {
+		db = db.Where("raw_name ILIKE ? OR name ILIKE ?", "%"+query+"%", "%"+query+"%")
+	}
+	if storeID != nil {
+		db = db.Where("store_id = ?", *storeID)
+	}
+	err := db.Order("usage_count DESC, last_used_at DESC").Limit(limit).Find(&mappings).Error
+	return mappings, err
+}
+
+func (r *ItemMappingRepository) GetByID(id uint, userID string) (*models.ItemNameMapping, error) {
+	var mapping models.ItemNameMapping
+	err := r.db.Where("id = ? AND user_id = ?", id, userID).First(&mapping).Error
+	if err != nil {
+		return nil, err
+	}
+	return &mapping, nil
+}
+
+// Top returns the limit mappings most worth putting in the receipt prompt:
+// those last seen at storeID, when known, then the ones the user corrected,
+// then the most used and most recent.
+func (r *ItemMappingRepository) Top(userID string, storeID *uint, limit int) ([]models.ItemNameMapping, error) {
+	var mappings []models.ItemNameMapping
+	db := r.db.Where("user_id = ?", userID)
+	if storeID != nil {
+		db = db.Order(fmt.Sprintf("COALESCE(store_id = %d, false) DESC", *storeID))
+	}
+	err := db.Order("corrected DESC, usage_count DESC, last_used_at DESC").
+		Limit(limit).
+		Find(&mappings).Error
+	return mappings, err
+}
+
+// Lookup returns the learned names for the given raw names, keyed by
+// normalize.Key of the raw name.
+func (r *ItemMappingRepository) Lookup(userID string, rawNames []string) (map[string]string, error) {
+	keys := make([]string, 0, len(rawNames))
+	for _, rawName := range rawNames {
+		if key := normalize.Key(rawName); key != "" {
+			keys = append(keys, key)
+		}
+	}
+
+	learned := make(map[string]string, len(keys))
+	if len(keys) == 0 {
+		return learned, nil
+	}
+
+	var mappings []models.ItemNameMapping
+	if err := r.db.Where("user_id = ? AND raw_key IN ?", userID, keys).Find(&mappings).Error; err != nil {
+		return nil, err
+	}
+	for _, mapping := range mappings {
+		learned[mapping.RawKey] = mapping.Name
+	}
+	return learned, nil
+}
+
+// Record learns the names of the items, counting one use of each mapping.
+// corrected marks names the user typed in rather than accepted.
+func (r *ItemMappingRepository) Record(userID string, storeID *uint, items []models.ReceiptItem, corrected bool) error {
+	now := time.Now()
+	for _, item := range items {
+		if err := r.record(userID, storeID, item.RawName, item.Name, corrected, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *ItemMappingRepository) record(userID string, storeID *uint, rawName, name string, corrected bool, at time.Time) error {
+	rawName = strings.TrimSpace(rawName)
+	name = strings.TrimSpace(name)
+	key := normalize.Key(rawName)
+	if key == "" || name == "" || name == rawName {
+		return nil
+	}
+
+	mapping := models.ItemNameMapping{
+		UserID:     userID,
+		RawKey:     key,
+		RawName:    rawName,
+		Name:       name,
+		StoreID:    storeID,
+		Corrected:  corrected,
+		UsageCount: 1,
+		LastUsedAt: at,
+	}
+	return r.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}, {Name: "raw_key"}},
+		// A name the user corrected is only replaced by another correction,
+		// not by a name accepted as extracted.
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"raw_name":     gorm.Expr(keepCorrected("raw_name")),
+			"name":         gorm.Expr(keepCorrected("name")),
+			"store_id":     gorm.Expr("COALESCE(EXCLUDED.store_id, item_name_mappings.store_id)"),
+			"corrected":    gorm.Expr("item_name_mappings.corrected OR EXCLUDED.corrected"),
+			"usage_count":  gorm.Expr("item_name_mappings.usage_count + 1"),
+			"last_used_at": gorm.Expr("GREATEST(item_name_mappings.last_used_at, EXCLUDED.last_used_at)"),
+			"updated_at":   time.Now(),
+		}),
+	}).Create(&mapping).Error
+}
+
+func keepCorrected(column string) string {
+	return "CASE WHEN item_name_mappings.corrected AND NOT EXCLUDED.corrected THEN item_name_mappings." + column + " ELSE EXCLUDED." + column + " END"
+}
+
+// Rename corrects the name a mapping gives.
+func (r *ItemMappingRepository) Rename(mapping *models.ItemNameMapping, name string) error {
+	mapping.Name = name
+	mapping.Corrected = true
+	return r.db.Model(mapping).Updates(map[string]interface{}{
+		"name":      name,
+		"corrected": true,
+	}).Error
+}
+
+// Delete forgets a mapping. It is learned again if the user saves the raw
+// name with a different name later.
+func (r *ItemMappingRepository) Delete(id uint, userID string) error {
+	result := r.db.Where("id = ? AND user_id = ?", id, userID).Delete(&models.ItemNameMapping{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// Backfill learns mappings from the receipts saved before mappings were
+// stored. It only runs while the user has no mappings, so deleted mappings
+// are not brought back on restart.
+func (r *ItemMappingRepository) Backfill() (int, error) {
+	var rows []struct {
+		UserID    string
+		StoreID   *uint
+		RawName   string
+		Name      string
+		CreatedAt time.Time
+	}
+	err := r.db.Table("receipt_items").
+		Select("receipts.user_id, receipts.store_id, receipt_items.raw_name, receipt_items.name, receipts.created_at").
+		Joins("JOIN receipts ON receipts.id = receipt_items.receipt_id AND receipts.deleted_at IS NULL").
+		Where("receipt_items.deleted_at IS NULL AND receipt_items.raw_name <> '' AND receipt_items.raw_name <> receipt_items.name").
+		Where("NOT EXISTS (SELECT 1 FROM item_name_mappings m WHERE m.user_id = receipts.user_id)").
+		Order("receipts.created_at ASC, receipt_items.id ASC").
+		Scan(&rows).Error
+	if err != nil {
+		return 0, err
+	}
+
+	for i, row := range rows {
+		if err := r.record(row.UserID, row.StoreID, row.RawName, row.Name, false, row.CreatedAt); err != nil {
+			return i, err
+		}
+	}
+	return len(rows), nil
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"buybuddy-api/models"
+	"buybuddy-api/normalize"
+	"strings"
+)
+
+// itemDocument is the text trigram matching runs on; it must match the
+// expression of idx_receipt_items_search_trgm to use the index.
+const itemDocument = "immutable_unaccent(lower(%[1]s.name || ' ' || %[1]s.raw_name || ' ' || coalesce(%[1]s.brand, '')))"
+
+// itemSearch is a search over receipt items: full-text with Portuguese
+// stemming, where every word may be a prefix, or trigram word similarity to
+// catch misspellings. Accents are ignored by both.
+type itemSearch struct {
+	tsquery string
+	text    string
+}
+
+func newItemSearch(text string) (itemSearch, bool) {
+	words := strings.Fields(strings.ToLower(normalize.Key(text)))
+	if len(words) == 0 {
+		return itemSearch{}, false
+	}
+	for i, word := range words {
+		words[i] = word + ":*"
+	}
+	return itemSearch{tsquery: strings.Join(words, " & "), text: strings.TrimSpace(text)}, true
+}
+
+// condition matches the items of the receipt_items alias.
+func (s itemSearch) condition(alias string) (string, []interface{}) {
+	sql := "(" + alias + ".search_vector @@ to_tsquery('portuguese_unaccent', ?) OR immutable_unaccent(lower(?)) <% " +
+		strings.ReplaceAll(itemDocument, "%[1]s", alias) + ")"
+	return sql, []interface{}{s.tsquery, s.text}
+}
+
+// rank scores how well items of the alias match, higher first.
+func (s itemSearch) rank(alias string) (string, []interface{}) {
+	sql := "ts_rank(" + alias + ".search_vector, to_tsquery('portuguese_unaccent', ?)) + word_similarity(immutable_unaccent(lower(?)), " +
+		strings.ReplaceAll(itemDocument, "%[1]s", alias) + ")"
+	return sql, []interface{}{s.tsquery, s.text}
+}
+
+// SearchItems finds the user's receipt items by name, raw name or brand,
+// best match first.
+func (r *ReceiptRepository) SearchItems(userID, text string, limit int) ([]models.ItemSearchResult, error) {
+	results := []models.ItemSearchResult{}
+	search, ok := newItemSearch(text)
+	if !ok {
+		return results, nil
+	}
+
+	condition, conditionArgs := search.condition("receipt_items")
+	rank, rankArgs := search.rank("receipt_items")
+
+	err := r.db.Table("receipt_items").
+		Select(`receipt_items.id AS item_id, receipt_items.receipt_id, receipt_items.product_id,
+			receipt_items.name, receipt_items.raw_name, receipt_items.brand, receipt_items.quantity,
+			receipt_items.unit, receipt_items.unit_price, receipt_items.total_price, receipt_items.price_per_unit,
+			receipt_items.size_unit, receipts.date, COALESCE(stores.name, receipts.company) AS store, `+rank+` AS rank`, rankArgs...).
+		Joins("JOIN receipts ON receipts.id = receipt_items.receipt_id AND receipts.deleted_at IS NULL").
+		Joins("LEFT JOIN stores ON stores.id = receipts.store_id").
+		Where("receipts.user_id = ? AND receipt_items.deleted_at IS NULL", userID).
+		Where(condition, conditionArgs...).
+		Order("rank DESC, receipts.date DESC NULLS LAST").
+		Limit(limit).
+		Scan(&results).Error
+	return results, err
+}
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"buybuddy-api/models"
+
+	"gorm.io/gorm"
+)
+
+type NormalizationRuleRepository struct {
+	db *gorm.DB
+}
+
+func NewNormalizationRuleRepository(db *gorm.DB) *NormalizationRuleRepository {
+	return &NormalizationRuleRepository{db: db}
+}
+
+// RuleItem is a saved item as the rules see it.
+type RuleItem struct {
+	ID          uint
+	ReceiptID   string
+	RawName     string
+	Name        string
+	Brand       string
+	Category    string
+	Subcategory string
+}
+
+// GetByUserID returns the user's rules in evaluation order.
+func (r *NormalizationRuleRepository) GetByUserID(userID string) ([]models.NormalizationRule, error) {
+	var rules []models.NormalizationRule
+	err := r.db.Where("user_id = ?", userID).Order("position ASC, id ASC").Find(&rules).Error
+	return rules, err
+}
+
+func (r *NormalizationRuleRepository) GetByID(id uint, userID string) (*models.NormalizationRule, error) {
+	var rule models.NormalizationRule
+	err := r.db.Where("id = ? AND user_id = ?", id, userID).First(&rule).Error
+	if err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// NextPosition returns the position after the user's last rule.
+func (r *NormalizationRuleRepository) NextPosition(userID string) (int, error) {
+	var position *int
+	err := r.db.Model(&models.NormalizationRule{}).
+		Where("user_id = ?", userID).
+		Select("MAX(position)").
+		Scan(&position).Error
+	if err != nil || position == nil {
+		return 0, err
+	}
+	return *position + 1, nil
+}
+
+func (r *NormalizationRuleRepository) Create(rule *models.NormalizationRule) error {
+	return r.db.Create(rule).Error
+}
+
+func (r *NormalizationRuleRepository) Update(rule *models.NormalizationRule) error {
+	return r.db.Save(rule).Error
+}
+
+func (r *NormalizationRuleRepository) Delete(id uint, userID string) error {
+	result := r.db.Where("id = ? AND user_id = ?", id, userID).Delete(&models.NormalizationRule{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetItems returns the user's saved items with their category names, for
+// dry runs.
+func (r *NormalizationRuleRepository) GetItems(userID string) ([]RuleItem, error) {
+	var items []RuleItem
+	err := r.db.Table("receipt_items").
+		Select(`receipt_items.id, receipt_items.receipt_id, receipt_items.raw_name, receipt_items.name,
+			receipt_items.brand, COALESCE(categories.name, '') AS category, COALESCE(subcategories.name, '') AS subcategory`).
+		Joins("JOIN receipts ON receipts.id = receipt_items.receipt_id AND receipts.deleted_at IS NULL").
+		Joins("LEFT JOIN categories ON categories.id = receipt_items.category_id").
+		Joins("LEFT JOIN subcategories ON subcategories.id = receipt_items.subcategory_id").
+		Where("receipts.user_id = ? AND receipt_items.deleted_at IS NULL", userID).
+		Order("receipts.date DESC NULLS LAST, receipt_items.id ASC").
+		Scan(&items).Error
+	return items, err
+}
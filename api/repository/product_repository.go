@@ -0,0 +1,262 @@
+package repository
+
+import (
+	"buybuddy-api/models"
+	"buybuddy-api/normalize"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+type ProductRepository struct {
+	db *gorm.DB
+}
+
+func NewProductRepository(db *gorm.DB) *ProductRepository {
+	return &ProductRepository{db: db}
+}
+
+// GetByUserID lists the user's products with price statistics, most bought
+// first. query filters by product or item name.
+func (r *ProductRepository) GetByUserID(userID string, query string, limit int) ([]models.ProductSummary, error) {
+	var products []models.ProductSummary
+	db := r.db.Table("products").
+		Select(`products.*, COUNT(receipt_items.id) AS purchase_count, MAX(receipts.date) AS last_purchased,
+			COALESCE(MIN(receipt_items.unit_price), 0) AS min_unit_price,
+			COALESCE(MAX(receipt_items.unit_price), 0) AS max_unit_price,
+			COALESCE(AVG(receipt_items.unit_price), 0) AS avg_unit_price,
+			COALESCE((
+				SELECT ri.unit_price FROM receipt_items ri
+				JOIN receipts r ON r.id = ri.receipt_id AND r.deleted_at IS NULL
+				WHERE ri.product_id = products.id AND ri.deleted_at IS NULL
+				ORDER BY r.date DESC NULLS LAST LIMIT 1
+			), 0) AS last_unit_price,
+			COALESCE(MAX(NULLIF(receipt_items.size_unit, '')), '') AS size_unit,
+			COALESCE(MIN(NULLIF(receipt_items.price_per_unit, 0)), 0) AS min_price_per_unit,
+			COALESCE(MAX(NULLIF(receipt_items.price_per_unit, 0)), 0) AS max_price_per_unit,
+			COALESCE(ROUND(AVG(NULLIF(receipt_items.price_per_unit, 0))::numeric, 2), 0) AS avg_price_per_unit,
+			COALESCE((
+				SELECT ri.price_per_unit FROM receipt_items ri
+				JOIN receipts r ON r.id = ri.receipt_id AND r.deleted_at IS NULL
+				WHERE ri.product_id = products.id AND ri.deleted_at IS NULL AND ri.price_per_unit > 0
+				ORDER BY r.date DESC NULLS LAST LIMIT 1
+			), 0) AS last_price_per_unit`).
+		Joins("LEFT JOIN receipt_items ON receipt_items.product_id = products.id AND receipt_items.deleted_at IS NULL").
+		Joins("LEFT JOIN receipts ON receipts.id = receipt_items.receipt_id AND receipts.deleted_at IS NULL").
+		Where("products.user_id = ? AND products.merged_into_id IS NULL", userID)
+
+	if query != "" {
+		db = db.Where("products.name ILIKE ? OR products.brand ILIKE ? OR receipt_items.name ILIKE ? OR receipt_items.raw_name ILIKE ?",
+			"%"+query+"%", "%"+query+"%", "%"+query+"%", "%"+query+"%")
+	}
+
+	err := db.Group("products.id").
+		Order("purchase_count DESC, products.name ASC").
+		Limit(limit).
+		Scan(&products).Error
+	return products, err
+}
+
+func (r *ProductRepository) GetByID(id uint, userID string) (*models.Product, error) {
+	var product models.Product
+	err := r.db.Where("id = ? AND user_id = ? AND merged_into_id IS NULL", id, userID).First(&product).Error
+	if err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+// GetPurchases returns the items of a product, newest first.
+func (r *ProductRepository) GetPurchases(productID uint, userID string) ([]models.ProductPurchase, error) {
+	var purchases []models.ProductPurchase
+	err := r.db.Table("receipt_items").
+		Select(`receipt_items.id AS item_id, receipts.id AS receipt_id, receipts.date, receipts.company,
+			receipts.store_id, receipt_items.name, receipt_items.quantity, receipt_items.unit,
+			receipt_items.unit_price, receipt_items.total_price,
+			receipt_items.package_size, receipt_items.size_unit, receipt_items.price_per_unit`).
+		Joins("JOIN receipts ON receipts.id = receipt_items.receipt_id AND receipts.deleted_at IS NULL").
+		Where("receipt_items.product_id = ? AND receipts.user_id = ? AND receipt_items.deleted_at IS NULL", productID, userID).
+		Order("receipts.date DESC NULLS LAST").
+		Scan(&purchases).Error
+	return purchases, err
+}
+
+// Resolve finds or creates the user's product for an item. gtin must already
+// be a valid barcode or empty. It returns nil when the item has no name.
+func (r *ProductRepository) Resolve(userID, gtin, name, brand string) (*models.Product, error) {
+	key := normalize.ProductKey(name, brand)
+	if gtin == "" && key == "" {
+		return nil, nil
+	}
+
+	var product models.Product
+	if gtin != "" {
+		err := r.db.Where("user_id = ? AND gtin = ?", userID, gtin).First(&product).Error
+		if err == nil {
+			return r.follow(&product)
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+
+	if key != "" {
+		// Keys of merged products still match and lead to the product they
+		// were merged into; products that weren't merged come first.
+		query := r.db.Where("user_id = ? AND key = ?", userID, key)
+		if gtin != "" {
+			// Only adopt a product that has no barcode of its own yet.
+			query = query.Where("gtin = ''")
+		}
+		err := query.Order("merged_into_id IS NOT NULL, id ASC").First(&product).Error
+		if err == nil {
+			target, err := r.follow(&product)
+			if err != nil {
+				return nil, err
+			}
+			if gtin != "" && target.GTIN == "" {
+				target.GTIN = gtin
+				if err := r.db.Save(target).Error; err != nil {
+					return nil, err
+				}
+			}
+			return target, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+
+	product = models.Product{
+		UserID: userID,
+		GTIN:   gtin,
+		Key:    key,
+		Name:   name,
+		Brand:  brand,
+	}
+	if product.Name == "" {
+		product.Name = gtin
+	}
+	if err := r.db.Create(&product).Error; err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+// Merge moves the items of the source products to the target and marks the
+// sources as merged into it.
+func (r *ProductRepository) Merge(userID string, targetID uint, sourceIDs []uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.Product{}).
+			Where("id IN ? AND user_id = ? AND merged_into_id IS NULL", sourceIDs, userID).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if int(count) != len(sourceIDs) {
+			return gorm.ErrRecordNotFound
+		}
+
+		if err := tx.Model(&models.ReceiptItem{}).Unscoped().
+			Where("product_id IN ?", sourceIDs).
+			Update("product_id", targetID).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&models.Product{}).
+			Where("user_id = ? AND (id IN ? OR merged_into_id IN ?)", userID, sourceIDs, sourceIDs).
+			Update("merged_into_id", targetID).Error
+	})
+}
+
+// Split moves items of a product to a new product. The new product gets no
+// GTIN, so items scanned later with the barcode still land on the original.
+func (r *ProductRepository) Split(userID string, productID uint, itemIDs []uint, name, brand string) (*models.Product, error) {
+	var product *models.Product
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.ReceiptItem{}).
+			Joins("JOIN receipts ON receipts.id = receipt_items.receipt_id").
+			Where("receipt_items.id IN ? AND receipt_items.product_id = ? AND receipts.user_id = ?", itemIDs, productID, userID).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if int(count) != len(itemIDs) {
+			return gorm.ErrRecordNotFound
+		}
+
+		product = &models.Product{
+			UserID: userID,
+			Key:    normalize.ProductKey(name, brand),
+			Name:   name,
+			Brand:  brand,
+		}
+		if err := tx.Create(product).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&models.ReceiptItem{}).
+			Where("id IN ?", itemIDs).
+			Update("product_id", product.ID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return product, nil
+}
+
+// Backfill links receipt items saved before products existed.
+func (r *ProductRepository) Backfill() (int, error) {
+	var rows []struct {
+		ID      uint
+		UserID  string
+		Name    string
+		Brand   string
+		Barcode string
+	}
+	err := r.db.Table("receipt_items").
+		Select("receipt_items.id, receipts.user_id, receipt_items.name, receipt_items.brand, receipt_items.barcode").
+		Joins("JOIN receipts ON receipts.id = receipt_items.receipt_id").
+		Where("receipt_items.product_id IS NULL").
+		Order("receipt_items.barcode = '' ASC, receipt_items.id ASC").
+		Scan(&rows).Error
+	if err != nil {
+		return 0, err
+	}
+
+	linked := 0
+	for _, row := range rows {
+		gtin := ""
+		if normalize.IsGTIN(row.Barcode) {
+			gtin = row.Barcode
+		}
+		product, err := r.Resolve(row.UserID, gtin, row.Name, row.Brand)
+		if err != nil {
+			return linked, fmt.Errorf("item %d: %w", row.ID, err)
+		}
+		if product == nil {
+			continue
+		}
+
+		if err := r.db.Model(&models.ReceiptItem{}).Unscoped().
+			Where("id = ?", row.ID).
+			Update("product_id", product.ID).Error; err != nil {
+			return linked, err
+		}
+		linked++
+	}
+
+	return linked, nil
+}
+
+func (r *ProductRepository) follow(product *models.Product) (*models.Product, error) {
+	for depth := 0; product.MergedIntoID != nil && depth < maxMergeDepth; depth++ {
+		var target models.Product
+		if err := r.db.First(&target, *product.MergedIntoID).Error; err != nil {
+			return nil, err
+		}
+		product = &target
+	}
+	return product, nil
+}
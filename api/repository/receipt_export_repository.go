@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"buybuddy-api/models"
+	"time"
+)
+
+// ExportItems reads the user's receipt items dated in [from, to), oldest
+// receipt first with its items together, and passes them to fn one at a time
+// so an export never holds every item in memory. Receipts without a date
+// count from when they were saved.
+func (r *ReceiptRepository) ExportItems(userID string, from, to *time.Time, fn func(*models.ExportRow) error) error {
+	db := r.db.Table("receipt_items").
+		Select(`receipts.id AS receipt_id, COALESCE(receipts.date, receipts.created_at) AS date,
+			COALESCE(stores.name, receipts.company) AS store, receipts.issuer_cnpj AS store_cnpj,
+			receipts.access_key, receipts.payment_method, receipts.total AS receipt_total,
+			receipts.discount AS receipt_discount, receipt_items.id AS item_id, receipt_items.name,
+			receipt_items.raw_name, receipt_items.brand, receipt_items.barcode,
+			COALESCE(categories.name, '') AS category, COALESCE(subcategories.name, '') AS subcategory,
+			receipt_items.quantity, receipt_items.unit, receipt_items.unit_price, receipt_items.discount,
+			receipt_items.total_price`).
+		Joins("JOIN receipts ON receipts.id = receipt_items.receipt_id AND receipts.deleted_at IS NULL").
+		Joins("LEFT JOIN stores ON stores.id = receipts.store_id").
+		Joins("LEFT JOIN categories ON categories.id = receipt_items.category_id").
+		Joins("LEFT JOIN subcategories ON subcategories.id = receipt_items.subcategory_id").
+		Where("receipts.user_id = ? AND receipt_items.deleted_at IS NULL", userID)
+	if from != nil {
+		db = db.Where("COALESCE(receipts.date, receipts.created_at) >= ?", *from)
+	}
+	if to != nil {
+		db = db.Where("COALESCE(receipts.date, receipts.created_at) < ?", *to)
+	}
+
+	rows, err := db.Order("COALESCE(receipts.date, receipts.created_at), receipts.id, receipt_items.id").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row models.ExportRow
+		if err := r.db.ScanRows(rows, &row); err != nil {
+			return err
+		}
+		if err := fn(&row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
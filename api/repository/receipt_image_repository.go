@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"buybuddy-api/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type ReceiptImageRepository struct {
+	db *gorm.DB
+}
+
+func NewReceiptImageRepository(db *gorm.DB) *ReceiptImageRepository {
+	return &ReceiptImageRepository{db: db}
+}
+
+func (r *ReceiptImageRepository) Create(images []models.ReceiptImage) error {
+	if len(images) == 0 {
+		return nil
+	}
+	return r.db.Create(&images).Error
+}
+
+func (r *ReceiptImageRepository) UploadExists(uploadID string, userID string) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.ReceiptImage{}).
+		Where("upload_id = ? AND user_id = ? AND receipt_id IS NULL", uploadID, userID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// AttachToReceipt links the images of an upload to the receipt saved from it.
+func (r *ReceiptImageRepository) AttachToReceipt(uploadID string, userID string, receiptID string) (int64, error) {
+	result := r.db.Model(&models.ReceiptImage{}).
+		Where("upload_id = ? AND user_id = ? AND receipt_id IS NULL", uploadID, userID).
+		Update("receipt_id", receiptID)
+	return result.RowsAffected, result.Error
+}
+
+func (r *ReceiptImageRepository) GetByReceiptID(receiptID string, userID string) ([]models.ReceiptImage, error) {
+	var images []models.ReceiptImage
+	err := r.db.Where("receipt_id = ? AND user_id = ?", receiptID, userID).
+		Order("page ASC").
+		Find(&images).Error
+	return images, err
+}
+
+func (r *ReceiptImageRepository) GetByUploadID(uploadID string, userID string) ([]models.ReceiptImage, error) {
+	var images []models.ReceiptImage
+	err := r.db.Where("upload_id = ? AND user_id = ?", uploadID, userID).
+		Order("page ASC").
+		Find(&images).Error
+	return images, err
+}
+
+func (r *ReceiptImageRepository) GetPage(receiptID string, userID string, page int) (*models.ReceiptImage, error) {
+	var image models.ReceiptImage
+	err := r.db.Where("receipt_id = ? AND user_id = ? AND page = ?", receiptID, userID, page).
+		First(&image).Error
+	if err != nil {
+		return nil, err
+	}
+	return &image, nil
+}
+
+func (r *ReceiptImageRepository) Update(image *models.ReceiptImage) error {
+	return r.db.Save(image).Error
+}
+
+// PurgeUnlinked deletes images of every user that were uploaded before
+// cutoff but never saved with a receipt, and returns their storage keys.
+func (r *ReceiptImageRepository) PurgeUnlinked(cutoff time.Time) (int, []string, error) {
+	var images []models.ReceiptImage
+	var keys []string
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("receipt_id IS NULL AND created_at < ?", cutoff).
+			Find(&images).Error
+		if err != nil || len(images) == 0 {
+			return err
+		}
+
+		ids := make([]uint, len(images))
+		for i, image := range images {
+			ids[i] = image.ID
+			keys = append(keys, image.StorageKey)
+			if image.ThumbnailKey != "" {
+				keys = append(keys, image.ThumbnailKey)
+			}
+		}
+		return tx.Where("id IN ? AND receipt_id IS NULL", ids).Delete(&models.ReceiptImage{}).Error
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return len(images), keys, nil
+}
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"buybuddy-api/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type ReceiptJobRepository struct {
+	db *gorm.DB
+}
+
+func NewReceiptJobRepository(db *gorm.DB) *ReceiptJobRepository {
+	return &ReceiptJobRepository{db: db}
+}
+
+func (r *ReceiptJobRepository) Create(job *models.ReceiptJob) error {
+	return r.db.Create(job).Error
+}
+
+func (r *ReceiptJobRepository) GetByID(id string, userID string) (*models.ReceiptJob, error) {
+	var job models.ReceiptJob
+	err := r.db.Where("id = ? AND user_id = ?", id, userID).First(&job).Error
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// ClaimNext marks the oldest due queued job as processing and returns it, or
+// nil when there is none. SKIP LOCKED lets several workers claim concurrently.
+func (r *ReceiptJobRepository) ClaimNext() (*models.ReceiptJob, error) {
+	now := time.Now()
+
+	var job models.ReceiptJob
+	err := r.db.Raw(`
+		UPDATE receipt_jobs
+		SET status = ?, stage = '', attempts = attempts + 1, started_at = ?, updated_at = ?
+		WHERE id = (
+			SELECT id FROM receipt_jobs
+			WHERE status = ? AND next_attempt_at <= ?
+			ORDER BY next_attempt_at
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		)
+		RETURNING *`,
+		models.JobProcessing, now, now, models.JobQueued, now,
+	).Scan(&job).Error
+	if err != nil {
+		return nil, err
+	}
+	if job.ID == "" {
+		return nil, nil
+	}
+	return &job, nil
+}
+
+func (r *ReceiptJobRepository) SetStage(id string, stage string) error {
+	return r.db.Model(&models.ReceiptJob{}).Where("id = ?", id).Update("stage", stage).Error
+}
+
+func (r *ReceiptJobRepository) Complete(id string, result string) error {
+	now := time.Now()
+	return r.db.Model(&models.ReceiptJob{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":      models.JobCompleted,
+		"stage":       "",
+		"error":       "",
+		"result":      result,
+		"finished_at": now,
+	}).Error
+}
+
+// Retry puts the job back in the queue after a transient failure.
+func (r *ReceiptJobRepository) Retry(id string, errorMessage string, nextAttemptAt time.Time) error {
+	return r.db.Model(&models.ReceiptJob{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":          models.JobQueued,
+		"stage":           "",
+		"error":           errorMessage,
+		"next_attempt_at": nextAttemptAt,
+	}).Error
+}
+
+func (r *ReceiptJobRepository) Fail(id string, errorMessage string) error {
+	now := time.Now()
+	return r.db.Model(&models.ReceiptJob{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":      models.JobFailed,
+		"stage":       "",
+		"error":       errorMessage,
+		"finished_at": now,
+	}).Error
+}
+
+// RequeueInterrupted returns jobs left processing by a previous run of the
+// server to the queue. Their interrupted attempt is not counted.
+func (r *ReceiptJobRepository) RequeueInterrupted() (int64, error) {
+	result := r.db.Model(&models.ReceiptJob{}).
+		Where("status = ?", models.JobProcessing).
+		Updates(map[string]interface{}{
+			"status":          models.JobQueued,
+			"stage":           "",
+			"attempts":        gorm.Expr("GREATEST(attempts - 1, 0)"),
+			"next_attempt_at": time.Now(),
+		})
+	return result.RowsAffected, result.Error
+}
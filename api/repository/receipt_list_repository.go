@@ -0,0 +1,216 @@
+package repository
+
+import (
+	"buybuddy-api/models"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidCursor is returned for a cursor that was not issued for the
+// requested sort order.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// receiptSort is a listing order: the column expression, its direction and
+// how to read a receipt's value for the cursor.
+type receiptSort struct {
+	expr  string
+	desc  bool
+	value func(date *time.Time, createdAt time.Time, total float64) string
+	parse func(value string) (interface{}, error)
+}
+
+var receiptSorts = map[string]receiptSort{
+	models.ReceiptSortDateDesc:    {expr: "COALESCE(receipts.date, receipts.created_at)", desc: true, value: dateValue, parse: parseTime},
+	models.ReceiptSortDateAsc:     {expr: "COALESCE(receipts.date, receipts.created_at)", value: dateValue, parse: parseTime},
+	models.ReceiptSortTotalDesc:   {expr: "receipts.total", desc: true, value: totalValue, parse: parseTotal},
+	models.ReceiptSortTotalAsc:    {expr: "receipts.total", value: totalValue, parse: parseTotal},
+	models.ReceiptSortCreatedDesc: {expr: "receipts.created_at", desc: true, value: createdValue, parse: parseTime},
+}
+
+// receiptSummaryColumns selects a models.ReceiptSummary; stores must be
+// joined.
+const receiptSummaryColumns = `receipts.id, receipts.company, receipts.store_id, COALESCE(stores.name, '') AS store_name,
+	receipts.date, receipts.total, receipts.discount, receipts.payment_method, receipts.access_key,
+	receipts.image_url, receipts.reconciliation_status, receipts.created_at,
+	(SELECT COUNT(*) FROM receipt_items ri WHERE ri.receipt_id = receipts.id AND ri.deleted_at IS NULL) AS item_count`
+
+type receiptCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    string `json:"id"`
+}
+
+// IsReceiptSort reports whether sort is one of the ReceiptSort* orders.
+func IsReceiptSort(sort string) bool {
+	_, ok := receiptSorts[sort]
+	return ok
+}
+
+// CountReceipts counts the receipts matching the query's filters.
+func (r *ReceiptRepository) CountReceipts(userID string, q models.ReceiptListQuery) (int64, error) {
+	var count int64
+	err := r.filterReceipts(userID, q).Count(&count).Error
+	return count, err
+}
+
+// ListReceipts returns a page of receipts with their items and the cursor of
+// the next page, empty on the last one.
+func (r *ReceiptRepository) ListReceipts(userID string, q models.ReceiptListQuery) ([]models.Receipt, string, error) {
+	db, sort, err := r.pageReceipts(userID, q)
+	if err != nil {
+		return nil, "", err
+	}
+
+	receipts := []models.Receipt{}
+	err = db.Preload("Store").
+		Preload("Items.Category").
+		Preload("Items.Subcategory").
+		Find(&receipts).Error
+	if err != nil {
+		return nil, "", err
+	}
+
+	next := ""
+	if len(receipts) > q.Limit {
+		receipts = receipts[:q.Limit]
+		last := receipts[len(receipts)-1]
+		next = encodeCursor(q.Sort, sort.value(last.Date, last.CreatedAt, last.Total), last.ID)
+	}
+	return receipts, next, nil
+}
+
+// ListReceiptSummaries is ListReceipts without the items.
+func (r *ReceiptRepository) ListReceiptSummaries(userID string, q models.ReceiptListQuery) ([]models.ReceiptSummary, string, error) {
+	db, sort, err := r.pageReceipts(userID, q)
+	if err != nil {
+		return nil, "", err
+	}
+
+	summaries := []models.ReceiptSummary{}
+	err = db.Select(receiptSummaryColumns).
+		Joins("LEFT JOIN stores ON stores.id = receipts.store_id").
+		Scan(&summaries).Error
+	if err != nil {
+		return nil, "", err
+	}
+
+	next := ""
+	if len(summaries) > q.Limit {
+		summaries = summaries[:q.Limit]
+		last := summaries[len(summaries)-1]
+		next = encodeCursor(q.Sort, sort.value(last.Date, last.CreatedAt, last.Total), last.ID)
+	}
+	return summaries, next, nil
+}
+
+// pageReceipts orders the filtered receipts, starts after the cursor and
+// fetches one more than the limit to tell whether there is a next page.
+func (r *ReceiptRepository) pageReceipts(userID string, q models.ReceiptListQuery) (*gorm.DB, receiptSort, error) {
+	sort, ok := receiptSorts[q.Sort]
+	if !ok {
+		return nil, sort, ErrInvalidCursor
+	}
+
+	direction, comparison := "ASC", ">"
+	if sort.desc {
+		direction, comparison = "DESC", "<"
+	}
+
+	db := r.filterReceipts(userID, q)
+	if q.Cursor != "" {
+		cursor, err := decodeCursor(q.Cursor)
+		if err != nil || cursor.Sort != q.Sort {
+			return nil, sort, ErrInvalidCursor
+		}
+		value, err := sort.parse(cursor.Value)
+		if err != nil {
+			return nil, sort, ErrInvalidCursor
+		}
+		db = db.Where("("+sort.expr+", receipts.id) "+comparison+" (?, ?)", value, cursor.ID)
+	}
+
+	db = db.Order(sort.expr + " " + direction).
+		Order("receipts.id " + direction).
+		Limit(q.Limit + 1)
+	return db, sort, nil
+}
+
+func (r *ReceiptRepository) filterReceipts(userID string, q models.ReceiptListQuery) *gorm.DB {
+	db := r.db.Model(&models.Receipt{}).Where("receipts.user_id = ?", userID)
+
+	if q.From != nil {
+		db = db.Where("receipts.date >= ?", *q.From)
+	}
+	if q.To != nil {
+		db = db.Where("receipts.date < ?", *q.To)
+	}
+	if len(q.StoreIDs) > 0 {
+		db = db.Where("receipts.store_id IN ?", q.StoreIDs)
+	}
+	if len(q.CategoryIDs) > 0 {
+		db = db.Where(`EXISTS (SELECT 1 FROM receipt_items ci WHERE ci.receipt_id = receipts.id
+			AND ci.deleted_at IS NULL AND ci.category_id IN ?)`, q.CategoryIDs)
+	}
+	if q.MinTotal != nil {
+		db = db.Where("receipts.total >= ?", *q.MinTotal)
+	}
+	if q.MaxTotal != nil {
+		db = db.Where("receipts.total <= ?", *q.MaxTotal)
+	}
+	if search, ok := newItemSearch(q.Text); ok {
+		pattern := "%" + q.Text + "%"
+		condition, args := search.condition("ti")
+		db = db.Where(`receipts.company ILIKE ?
+			OR receipts.store_id IN (SELECT s.id FROM stores s WHERE s.name ILIKE ? OR s.chain ILIKE ?)
+			OR EXISTS (SELECT 1 FROM receipt_items ti WHERE ti.receipt_id = receipts.id AND ti.deleted_at IS NULL
+				AND `+condition+`)`,
+			append([]interface{}{pattern, pattern, pattern}, args...)...)
+	}
+
+	return db
+}
+
+func encodeCursor(sort, value, id string) string {
+	data, _ := json.Marshal(receiptCursor{Sort: sort, Value: value, ID: id})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(cursor string) (*receiptCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+	var decoded receiptCursor
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, err
+	}
+	return &decoded, nil
+}
+
+func dateValue(date *time.Time, createdAt time.Time, _ float64) string {
+	if date != nil {
+		return date.UTC().Format(time.RFC3339Nano)
+	}
+	return createdAt.UTC().Format(time.RFC3339Nano)
+}
+
+func createdValue(_ *time.Time, createdAt time.Time, _ float64) string {
+	return createdAt.UTC().Format(time.RFC3339Nano)
+}
+
+func totalValue(_ *time.Time, _ time.Time, total float64) string {
+	return strconv.FormatFloat(total, 'f', -1, 64)
+}
+
+func parseTime(value string) (interface{}, error) {
+	return time.Parse(time.RFC3339Nano, value)
+}
+
+func parseTotal(value string) (interface{}, error) {
+	return strconv.ParseFloat(value, 64)
+}
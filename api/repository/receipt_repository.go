@@ -2,9 +2,11 @@ package repository
 
 import (
 	"buybuddy-api/models"
+	"fmt"
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type ReceiptRepository struct {
@@ -22,6 +24,7 @@ func (r *ReceiptRepository) Create(receipt *models.Receipt) error {
 func (r *ReceiptRepository) GetByUserID(userID string) ([]models.Receipt, error) {
 	var receipts []models.Receipt
 	err := r.db.Where("user_id = ?", userID).
+		Preload("Store").
 		Preload("Items.Category").
 		Preload("Items.Subcategory").
 		Order("created_at DESC").
@@ -32,6 +35,7 @@ func (r *ReceiptRepository) GetByUserID(userID string) ([]models.Receipt, error)
 func (r *ReceiptRepository) GetByID(id string, userID string) (*models.Receipt, error) {
 	var receipt models.Receipt
 	err := r.db.Where("id = ? AND user_id = ?", id, userID).
+		Preload("Store").
 		Preload("Items.Category").
 		Preload("Items.Subcategory").
 		First(&receipt).Error
@@ -41,6 +45,106 @@ func (r *ReceiptRepository) GetByID(id string, userID string) (*models.Receipt,
 	return &receipt, nil
 }
 
+// SaveChanges updates the receipt's own columns, saves the given items
+// (creating those without an ID) and deletes removed items in one transaction.
+func (r *ReceiptRepository) SaveChanges(receipt *models.Receipt, items []models.ReceiptItem, deletedItemIDs []uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Save(receipt).Error; err != nil {
+			return err
+		}
+
+		for i := range items {
+			items[i].ReceiptID = receipt.ID
+			if err := tx.Omit(clause.Associations).Save(&items[i]).Error; err != nil {
+				return err
+			}
+		}
+
+		if len(deletedItemIDs) > 0 {
+			if err := tx.Where("receipt_id = ? AND id IN ?", receipt.ID, deletedItemIDs).
+				Delete(&models.ReceiptItem{}).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// FindDuplicateCandidates returns receipts that could be the same purchase
+// as one with this date and total: totals within 20% and dates within window,
+// or saved in the last two days when the dates may have been misread.
+func (r *ReceiptRepository) FindDuplicateCandidates(userID string, date *time.Time, total float64, window time.Duration) ([]models.Receipt, error) {
+	recent := r.db.Where("receipts.created_at >= ?", time.Now().Add(-48*time.Hour))
+	if date != nil {
+		recent = recent.Or("receipts.date BETWEEN ? AND ?", date.Add(-window), date.Add(window))
+	}
+
+	var receipts []models.Receipt
+	err := r.db.Where("user_id = ? AND total BETWEEN ? AND ?", userID, total*0.8, total*1.2).
+		Where(recent).
+		Preload("Store").
+		Preload("Items").
+		Order("created_at DESC").
+		Limit(20).
+		Find(&receipts).Error
+	return receipts, err
+}
+
+// BackfillMeasurements measures items saved before package sizes were
+// stored, in batches.
+func (r *ReceiptRepository) BackfillMeasurements(measure func([]models.ReceiptItem)) (int, error) {
+	measured := 0
+	for {
+		var items []models.ReceiptItem
+		err := r.db.Unscoped().
+			Where("size_unit = '' OR size_unit IS NULL").
+			Order("id ASC").
+			Limit(500).
+			Find(&items).Error
+		if err != nil || len(items) == 0 {
+			return measured, err
+		}
+
+		measure(items)
+		for _, item := range items {
+			if item.SizeUnit == "" {
+				return measured, fmt.Errorf("item %d could not be measured", item.ID)
+			}
+			if err := r.db.Model(&models.ReceiptItem{}).Unscoped().
+				Where("id = ?", item.ID).
+				Updates(map[string]interface{}{
+					"package_size":   item.PackageSize,
+					"size_unit":      item.SizeUnit,
+					"price_per_unit": item.PricePerUnit,
+				}).Error; err != nil {
+				return measured, err
+			}
+			measured++
+		}
+	}
+}
+
+func (r *ReceiptRepository) CreateReprocess(reprocess *models.ReceiptReprocess) error {
+	return r.db.Create(reprocess).Error
+}
+
+func (r *ReceiptRepository) GetReprocess(id string, receiptID string, userID string) (*models.ReceiptReprocess, error) {
+	var reprocess models.ReceiptReprocess
+	err := r.db.Where("id = ? AND receipt_id = ? AND user_id = ?", id, receiptID, userID).
+		First(&reprocess).Error
+	if err != nil {
+		return nil, err
+	}
+	return &reprocess, nil
+}
+
+func (r *ReceiptRepository) MarkReprocessApplied(reprocess *models.ReceiptReprocess) error {
+	now := time.Now()
+	reprocess.AppliedAt = &now
+	return r.db.Model(reprocess).Update("applied_at", now).Error
+}
+
 func (r *ReceiptRepository) Delete(id string, userID string) error {
 	return r.db.Where("id = ? AND user_id = ?", id, userID).
 		Delete(&models.Receipt{}).Error
@@ -84,14 +188,23 @@ func (r *ReceiptRepository) GetFirstReceiptDate(userID string) (*time.Time, erro
 }
 
 func (r *ReceiptRepository) QueryWithFilters(userID string, filter *models.AssistantQueryFilter, limit int) ([]models.Receipt, error) {
-	query := r.db.Where("receipts.user_id = ?", userID).
+	// Receipts other users split with this one count too, once the user
+	// accepted; callers narrow them to the user's share with
+	// utils.ApplySplits.
+	query := r.db.Where("(receipts.user_id = ? OR receipts.id IN (SELECT receipt_id FROM receipt_item_splits WHERE user_id = ? AND status = ?))", userID, userID, models.ShareStatusAccepted).
+		Preload("Store").
 		Preload("Items.Category").
 		Preload("Items.Subcategory")
 
 	if len(filter.Company) > 0 {
+		// Match the store's name and chain too, so "Supermercado X" finds
+		// receipts printed as "SUPERMERCADO X LTDA".
+		query = query.Joins("LEFT JOIN stores ON stores.id = receipts.store_id")
 		orConditions := r.db.Where("1 = 0")
 		for _, c := range filter.Company {
-			orConditions = orConditions.Or("receipts.company ILIKE ?", "%"+c+"%")
+			orConditions = orConditions.Or("receipts.company ILIKE ?", "%"+c+"%").
+				Or("stores.name ILIKE ?", "%"+c+"%").
+				Or("stores.chain ILIKE ?", "%"+c+"%")
 		}
 		query = query.Where(orConditions)
 	}
@@ -103,7 +216,14 @@ func (r *ReceiptRepository) QueryWithFilters(userID string, filter *models.Assis
 		query = query.Where("receipts.date <= ?", filter.DateTo)
 	}
 
-	needsItemJoin := len(filter.ProductName) > 0 || len(filter.Brand) > 0 ||
+	if len(filter.PaymentMethod) > 0 {
+		query = query.Where("receipts.payment_method IN ?", filter.PaymentMethod)
+	}
+	if filter.HasDiscount {
+		query = query.Where("receipts.discount > 0 OR EXISTS (SELECT 1 FROM receipt_items di WHERE di.receipt_id = receipts.id AND di.discount > 0 AND di.deleted_at IS NULL)")
+	}
+
+	needsItemJoin := len(filter.ProductName) > 0 || len(filter.ProductID) > 0 || len(filter.Brand) > 0 ||
 		len(filter.Category) > 0 || len(filter.Subcategory) > 0 ||
 		filter.MinPrice != nil || filter.MaxPrice != nil
 
@@ -115,16 +235,22 @@ func (r *ReceiptRepository) QueryWithFilters(userID string, filter *models.Assis
 		if len(filter.ProductName) > 0 {
 			orConditions := r.db.Where("1 = 0")
 			for _, name := range filter.ProductName {
-				orConditions = orConditions.Or("receipt_items.name ILIKE ?", "%"+name+"%")
-				orConditions = orConditions.Or("receipt_items.raw_name ILIKE ?", "%"+name+"%")
+				if search, ok := newItemSearch(name); ok {
+					condition, args := search.condition("receipt_items")
+					orConditions = orConditions.Or(condition, args...)
+				}
 			}
 			query = query.Where(orConditions)
 		}
 
+		if len(filter.ProductID) > 0 {
+			query = query.Where("receipt_items.product_id IN ?", filter.ProductID)
+		}
+
 		if len(filter.Brand) > 0 {
 			orConditions := r.db.Where("1 = 0")
 			for _, b := range filter.Brand {
-				orConditions = orConditions.Or("receipt_items.brand ILIKE ?", "%"+b+"%")
+				orConditions = orConditions.Or("immutable_unaccent(receipt_items.brand) ILIKE immutable_unaccent(?)", "%"+b+"%")
 			}
 			query = query.Where(orConditions)
 		}
@@ -180,6 +306,9 @@ func (r *ReceiptRepository) QueryWithFilters(userID string, filter *models.Assis
 	err := query.Order(orderBy).
 		Limit(queryLimit).
 		Find(&receipts).Error
+	if err != nil {
+		return nil, err
+	}
 
-	return receipts, err
+	return receipts, nil
 }
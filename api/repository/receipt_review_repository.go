@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"buybuddy-api/models"
+
+	"gorm.io/gorm"
+)
+
+// reviewQueue selects the user's unconfirmed items with a field whose
+// confidence is below the threshold.
+func (r *ReceiptRepository) reviewQueue(userID string, threshold float64) *gorm.DB {
+	return r.db.Model(&models.ReceiptItem{}).
+		Joins("JOIN receipts ON receipts.id = receipt_items.receipt_id AND receipts.deleted_at IS NULL").
+		Where("receipts.user_id = ? AND receipt_items.reviewed_at IS NULL", userID).
+		Where("jsonb_typeof(receipt_items.confidence) = 'object'").
+		Where("EXISTS (SELECT 1 FROM jsonb_each_text(receipt_items.confidence) c WHERE c.value::float < ?)", threshold)
+}
+
+// GetReviewQueue returns the user's items extraction was unsure of, least
+// sure first, with their receipt and store.
+func (r *ReceiptRepository) GetReviewQueue(userID string, threshold float64, limit int) ([]models.ReceiptItem, error) {
+	items := []models.ReceiptItem{}
+	err := r.reviewQueue(userID, threshold).
+		Preload("Receipt.Store").
+		Preload("Category").
+		Preload("Subcategory").
+		Order("(SELECT MIN(c.value::float) FROM jsonb_each_text(receipt_items.confidence) c) ASC").
+		Order("receipts.date DESC NULLS LAST").
+		Order("receipt_items.id").
+		Limit(limit).
+		Find(&items).Error
+	return items, err
+}
+
+// CountReviewQueue counts the items waiting in the user's review queue.
+func (r *ReceiptRepository) CountReviewQueue(userID string, threshold float64) (int64, error) {
+	var count int64
+	err := r.reviewQueue(userID, threshold).Count(&count).Error
+	return count, err
+}
+
+// GetItemReceiptID returns the receipt of one of the user's items.
+func (r *ReceiptRepository) GetItemReceiptID(itemID uint, userID string) (string, error) {
+	var receiptID string
+	err := r.db.Model(&models.ReceiptItem{}).
+		Joins("JOIN receipts ON receipts.id = receipt_items.receipt_id AND receipts.deleted_at IS NULL").
+		Where("receipt_items.id = ? AND receipts.user_id = ?", itemID, userID).
+		Select("receipt_items.receipt_id").
+		Limit(1).
+		Scan(&receiptID).Error
+	if err != nil {
+		return "", err
+	}
+	if receiptID == "" {
+		return "", gorm.ErrRecordNotFound
+	}
+	return receiptID, nil
+}
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"buybuddy-api/models"
+
+	"gorm.io/gorm"
+)
+
+// splitAmount is what a split comes to, to the centavo.
+const splitAmount = "ROUND((receipt_items.total_price * receipt_item_splits.share)::numeric, 2)"
+
+// GetSplitReceipt returns a receipt with its items to its owner or to a user
+// it was split with, who may still have to accept the splits.
+func (r *ReceiptRepository) GetSplitReceipt(id string, userID string) (*models.Receipt, error) {
+	var receipt models.Receipt
+	err := r.db.Where("id = ?", id).
+		Where(`(user_id = ? OR EXISTS (SELECT 1 FROM receipt_item_splits s WHERE s.receipt_id = receipts.id AND s.user_id = ? AND s.status <> ?))`,
+			userID, userID, models.ShareStatusRejected).
+		Preload("Items").
+		First(&receipt).Error
+	if err != nil {
+		return nil, err
+	}
+	return &receipt, nil
+}
+
+// GetSplits returns the splits of a receipt's current items with their
+// users, by item.
+func (r *ReceiptRepository) GetSplits(receiptID string) ([]models.ReceiptItemSplit, error) {
+	splits := []models.ReceiptItemSplit{}
+	err := r.db.Where("receipt_id = ?", receiptID).
+		Where("item_id IN (SELECT id FROM receipt_items WHERE receipt_id = ? AND deleted_at IS NULL)", receiptID).
+		Preload("User").
+		Order("item_id, id").
+		Find(&splits).Error
+	return splits, err
+}
+
+// ReplaceSplits swaps every split of a receipt for splits.
+func (r *ReceiptRepository) ReplaceSplits(receiptID string, splits []models.ReceiptItemSplit) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("receipt_id = ?", receiptID).Delete(&models.ReceiptItemSplit{}).Error; err != nil {
+			return err
+		}
+		if len(splits) == 0 {
+			return nil
+		}
+		return tx.Create(&splits).Error
+	})
+}
+
+// RespondToSplits accepts or rejects, with status, the pending splits of a
+// receipt given to userID, and returns how many there were.
+func (r *ReceiptRepository) RespondToSplits(receiptID string, userID string, status models.ShareStatus) (int64, error) {
+	result := r.db.Model(&models.ReceiptItemSplit{}).
+		Where("receipt_id = ? AND user_id = ? AND status = ?", receiptID, userID, models.ShareStatusPending).
+		Update("status", status)
+	return result.RowsAffected, result.Error
+}
+
+// GetSharedWithUser lists the receipts other users split with userID and
+// what the user's share of each comes to, newest first.
+func (r *ReceiptRepository) GetSharedWithUser(userID string) ([]models.SharedReceipt, error) {
+	return r.sharedWithUser(userID, models.ShareStatusAccepted)
+}
+
+// GetPendingSplits lists the receipts other users want to split with
+// userID, waiting for the user to accept or reject them.
+func (r *ReceiptRepository) GetPendingSplits(userID string) ([]models.SharedReceipt, error) {
+	return r.sharedWithUser(userID, models.ShareStatusPending)
+}
+
+func (r *ReceiptRepository) sharedWithUser(userID string, status models.ShareStatus) ([]models.SharedReceipt, error) {
+	shared := []models.SharedReceipt{}
+	err := r.db.Table("receipt_item_splits").
+		Select(`receipts.id AS receipt_id, receipts.user_id AS owner_id, users.name AS owner_name,
+			users.email AS owner_email, COALESCE(stores.name, receipts.company) AS store, receipts.date,
+			COUNT(*) AS item_count, SUM(`+splitAmount+`) AS amount`).
+		Joins("JOIN receipt_items ON receipt_items.id = receipt_item_splits.item_id AND receipt_items.deleted_at IS NULL").
+		Joins("JOIN receipts ON receipts.id = receipt_item_splits.receipt_id AND receipts.deleted_at IS NULL").
+		Joins("JOIN users ON users.id = receipts.user_id").
+		Joins("LEFT JOIN stores ON stores.id = receipts.store_id").
+		Where("receipt_item_splits.user_id = ? AND receipt_item_splits.status = ?", userID, status).
+		Group("receipts.id, users.id, stores.name").
+		Order("receipts.date DESC NULLS LAST").
+		Scan(&shared).Error
+	return shared, err
+}
+
+// GetSplitBalances nets what each user the caller split receipts with owes
+// the caller against what the caller owes them, largest first. Only accepted
+// splits count.
+func (r *ReceiptRepository) GetSplitBalances(userID string) ([]models.SplitBalance, error) {
+	balances := []models.SplitBalance{}
+	err := r.db.Raw(`
+		SELECT users.id AS user_id, users.email, users.name,
+			SUM(owed.owed_to_you) AS owed_to_you, SUM(owed.you_owe) AS you_owe,
+			SUM(owed.owed_to_you) - SUM(owed.you_owe) AS net
+		FROM (
+			SELECT CASE WHEN receipts.user_id = @user THEN receipt_item_splits.user_id ELSE receipts.user_id END AS other_id,
+				CASE WHEN receipts.user_id = @user THEN `+splitAmount+` ELSE 0 END AS owed_to_you,
+				CASE WHEN receipts.user_id = @user THEN 0 ELSE `+splitAmount+` END AS you_owe
+			FROM receipt_item_splits
+			JOIN receipt_items ON receipt_items.id = receipt_item_splits.item_id AND receipt_items.deleted_at IS NULL
+			JOIN receipts ON receipts.id = receipt_item_splits.receipt_id AND receipts.deleted_at IS NULL
+			WHERE (receipts.user_id = @user OR receipt_item_splits.user_id = @user)
+				AND receipt_item_splits.status = @accepted
+		) owed
+		JOIN users ON users.id = owed.other_id
+		GROUP BY users.id, users.email, users.name
+		ORDER BY ABS(SUM(owed.owed_to_you) - SUM(owed.you_owe)) DESC`,
+		map[string]interface{}{"user": userID, "accepted": models.ShareStatusAccepted}).
+		Scan(&balances).Error
+	return balances, err
+}
+
+// GetAcceptedSplits returns the accepted splits of the given receipts.
+func (r *ReceiptRepository) GetAcceptedSplits(receiptIDs []string) ([]models.ReceiptItemSplit, error) {
+	splits := []models.ReceiptItemSplit{}
+	if len(receiptIDs) == 0 {
+		return splits, nil
+	}
+	err := r.db.Where("receipt_id IN ? AND status = ?", receiptIDs, models.ShareStatusAccepted).
+		Find(&splits).Error
+	return splits, err
+}
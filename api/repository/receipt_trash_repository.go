@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"buybuddy-api/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// GetTrash returns the user's deleted receipts, most recently deleted first.
+func (r *ReceiptRepository) GetTrash(userID string) ([]models.TrashedReceipt, error) {
+	receipts := []models.TrashedReceipt{}
+	err := r.db.Unscoped().Model(&models.Receipt{}).
+		Select(receiptSummaryColumns+", receipts.deleted_at").
+		Joins("LEFT JOIN stores ON stores.id = receipts.store_id").
+		Where("receipts.user_id = ? AND receipts.deleted_at IS NOT NULL", userID).
+		Order("receipts.deleted_at DESC").
+		Scan(&receipts).Error
+	return receipts, err
+}
+
+// GetTrashed returns one of the user's deleted receipts.
+func (r *ReceiptRepository) GetTrashed(id string, userID string) (*models.Receipt, error) {
+	var receipt models.Receipt
+	err := r.db.Unscoped().
+		Where("id = ? AND user_id = ? AND deleted_at IS NOT NULL", id, userID).
+		First(&receipt).Error
+	if err != nil {
+		return nil, err
+	}
+	return &receipt, nil
+}
+
+// Restore takes a receipt out of the trash.
+func (r *ReceiptRepository) Restore(id string, userID string) error {
+	result := r.db.Unscoped().Model(&models.Receipt{}).
+		Where("id = ? AND user_id = ? AND deleted_at IS NOT NULL", id, userID).
+		Update("deleted_at", nil)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// Purge permanently deletes a receipt in the trash with its items, images
+// and reprocesses. It returns the storage keys of the images, for the caller
+// to delete.
+func (r *ReceiptRepository) Purge(id string, userID string) ([]string, error) {
+	ids, keys, err := r.purge(func(db *gorm.DB) *gorm.DB {
+		return db.Where("id = ? AND user_id = ?", id, userID)
+	})
+	if err == nil && len(ids) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return keys, err
+}
+
+// EmptyTrash permanently deletes every receipt in the user's trash, returning
+// how many and the storage keys of their images.
+func (r *ReceiptRepository) EmptyTrash(userID string) (int, []string, error) {
+	ids, keys, err := r.purge(func(db *gorm.DB) *gorm.DB {
+		return db.Where("user_id = ?", userID)
+	})
+	return len(ids), keys, err
+}
+
+// PurgeExpired permanently deletes receipts of every user deleted before the
+// cutoff, returning how many and the storage keys of their images.
+func (r *ReceiptRepository) PurgeExpired(cutoff time.Time) (int, []string, error) {
+	ids, keys, err := r.purge(func(db *gorm.DB) *gorm.DB {
+		return db.Where("deleted_at < ?", cutoff)
+	})
+	return len(ids), keys, err
+}
+
+// purge hard-deletes the trashed receipts matched by scope. Everything that
+// belongs to a receipt goes with it through ON DELETE CASCADE.
+func (r *ReceiptRepository) purge(scope func(*gorm.DB) *gorm.DB) ([]string, []string, error) {
+	var ids []string
+	var keys []string
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := scope(tx.Unscoped().Model(&models.Receipt{})).
+			Where("deleted_at IS NOT NULL").
+			Pluck("id", &ids).Error
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+
+		var images []models.ReceiptImage
+		if err := tx.Where("receipt_id IN ?", ids).Find(&images).Error; err != nil {
+			return err
+		}
+		for _, image := range images {
+			keys = append(keys, image.StorageKey)
+			if image.ThumbnailKey != "" {
+				keys = append(keys, image.ThumbnailKey)
+			}
+		}
+
+		return tx.Unscoped().Where("id IN ?", ids).Delete(&models.Receipt{}).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return ids, keys, nil
+}
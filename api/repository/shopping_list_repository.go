@@ -177,15 +177,26 @@ func (r *ShoppingListRepository) ShareExists(listID, userID string) (bool, error
 	return count > 0, err
 }
 
+// GetItemSuggestions returns product names matching query, most often bought
+// first, so the same product under different item names is suggested once.
+// Products match on their name ignoring accents, or through their items by
+// full-text search.
 func (r *ShoppingListRepository) GetItemSuggestions(userID string, query string, limit int) ([]string, error) {
 	var names []string
 
-	err := r.db.Model(&models.ReceiptItem{}).
-		Joins("JOIN receipts ON receipts.id = receipt_items.receipt_id").
-		Where("receipts.user_id = ? AND receipt_items.name ILIKE ?", userID, "%"+query+"%").
-		Select("DISTINCT receipt_items.name").
+	db := r.db.Table("products").
+		Joins("JOIN receipt_items ON receipt_items.product_id = products.id AND receipt_items.deleted_at IS NULL").
+		Where("products.user_id = ? AND products.merged_into_id IS NULL", userID)
+	if search, ok := newItemSearch(query); ok {
+		condition, args := search.condition("receipt_items")
+		db = db.Where(r.db.Where("immutable_unaccent(lower(products.name)) LIKE immutable_unaccent(lower(?))", "%"+query+"%").
+			Or(condition, args...))
+	}
+
+	err := db.Group("products.id, products.name").
+		Order("COUNT(receipt_items.id) DESC").
 		Limit(limit).
-		Pluck("name", &names).Error
+		Pluck("products.name", &names).Error
 
 	return names, err
 }
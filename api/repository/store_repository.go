@@ -0,0 +1,220 @@
+package repository
+
+import (
+	"buybuddy-api/fiscal"
+	"buybuddy-api/models"
+	"buybuddy-api/normalize"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// maxMergeDepth guards against cycles when following merged stores.
+const maxMergeDepth = 8
+
+type StoreRepository struct {
+	db *gorm.DB
+}
+
+func NewStoreRepository(db *gorm.DB) *StoreRepository {
+	return &StoreRepository{db: db}
+}
+
+// GetByUserID lists the user's stores with their receipt totals.
+func (r *StoreRepository) GetByUserID(userID string) ([]models.StoreSummary, error) {
+	var stores []models.StoreSummary
+	err := r.db.Table("stores").
+		Select(`stores.*, COUNT(receipts.id) AS receipt_count,
+			COALESCE(SUM(receipts.total), 0) AS total_spent, MAX(receipts.date) AS last_visit`).
+		Joins("LEFT JOIN receipts ON receipts.store_id = stores.id AND receipts.deleted_at IS NULL").
+		Where("stores.user_id = ? AND stores.merged_into_id IS NULL", userID).
+		Group("stores.id").
+		Order("stores.name ASC").
+		Scan(&stores).Error
+	return stores, err
+}
+
+func (r *StoreRepository) GetByID(id uint, userID string) (*models.Store, error) {
+	var store models.Store
+	err := r.db.Where("id = ? AND user_id = ? AND merged_into_id IS NULL", id, userID).First(&store).Error
+	if err != nil {
+		return nil, err
+	}
+	return &store, nil
+}
+
+func (r *StoreRepository) Update(store *models.Store) error {
+	return r.db.Save(store).Error
+}
+
+// Resolve finds the user's store for a receipt, creating it when needed. A
+// valid CNPJ identifies the store; otherwise the normalized company name is
+// used. It returns nil when neither is known.
+func (r *StoreRepository) Resolve(userID string, details models.StoreDetails) (*models.Store, error) {
+	key := normalize.StoreKey(details.Company)
+	cnpj := details.CNPJ
+	if !fiscal.ValidCNPJ(cnpj) {
+		cnpj = ""
+	}
+	if cnpj == "" && key == "" {
+		return nil, nil
+	}
+
+	var store models.Store
+	if cnpj != "" {
+		err := r.db.Where("user_id = ? AND cnpj = ?", userID, cnpj).First(&store).Error
+		if err == nil {
+			return r.follow(&store)
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+
+	if key != "" {
+		// Names of merged stores still match and lead to the store they
+		// were merged into; stores that weren't merged come first.
+		query := r.db.Where("user_id = ? AND name_key = ?", userID, key)
+		if cnpj != "" {
+			// A store first seen without a CNPJ takes it on; branches
+			// with their own CNPJ stay separate stores.
+			query = query.Where("cnpj = ''")
+		}
+		err := query.Order("merged_into_id IS NOT NULL, id ASC").First(&store).Error
+		if err == nil {
+			target, err := r.follow(&store)
+			if err != nil {
+				return nil, err
+			}
+			if cnpj != "" && target.CNPJ == "" {
+				target.CNPJ = cnpj
+				fillStoreDetails(target, details)
+				if err := r.db.Save(target).Error; err != nil {
+					return nil, err
+				}
+			}
+			return target, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+
+	store = models.Store{
+		UserID:    userID,
+		CNPJ:      cnpj,
+		NameKey:   key,
+		Name:      normalize.StoreName(details.Company),
+		LegalName: details.Company,
+	}
+	if key == "" {
+		store.Name = fiscal.FormatCNPJ(cnpj)
+		store.LegalName = ""
+	}
+	fillStoreDetails(&store, details)
+
+	if err := r.db.Create(&store).Error; err != nil {
+		return nil, err
+	}
+	return &store, nil
+}
+
+// Merge moves the receipts of the source stores to the target and marks the
+// sources as merged into it.
+func (r *StoreRepository) Merge(userID string, targetID uint, sourceIDs []uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.Store{}).
+			Where("id IN ? AND user_id = ? AND merged_into_id IS NULL", sourceIDs, userID).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if int(count) != len(sourceIDs) {
+			return gorm.ErrRecordNotFound
+		}
+
+		if err := tx.Model(&models.Receipt{}).Unscoped().
+			Where("store_id IN ? AND user_id = ?", sourceIDs, userID).
+			Update("store_id", targetID).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.ItemNameMapping{}).
+			Where("store_id IN ? AND user_id = ?", sourceIDs, userID).
+			Update("store_id", targetID).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&models.Store{}).
+			Where("user_id = ? AND (id IN ? OR merged_into_id IN ?)", userID, sourceIDs, sourceIDs).
+			Update("merged_into_id", targetID).Error
+	})
+}
+
+// Backfill links receipts saved before stores existed. Receipts with a CNPJ
+// go first so that receipts with only a company name join their stores.
+func (r *StoreRepository) Backfill() (int, error) {
+	var rows []struct {
+		ID         string
+		UserID     string
+		Company    string
+		IssuerCNPJ string
+		State      string
+	}
+	err := r.db.Model(&models.Receipt{}).Unscoped().
+		Select("id, user_id, company, issuer_cnpj, state").
+		Where("store_id IS NULL").
+		Order("issuer_cnpj = '' ASC, created_at ASC").
+		Scan(&rows).Error
+	if err != nil {
+		return 0, err
+	}
+
+	linked := 0
+	for _, row := range rows {
+		store, err := r.Resolve(row.UserID, models.StoreDetails{
+			CNPJ:    row.IssuerCNPJ,
+			Company: row.Company,
+			State:   row.State,
+		})
+		if err != nil {
+			return linked, fmt.Errorf("receipt %s: %w", row.ID, err)
+		}
+		if store == nil {
+			continue
+		}
+
+		if err := r.db.Model(&models.Receipt{}).Unscoped().
+			Where("id = ?", row.ID).
+			Update("store_id", store.ID).Error; err != nil {
+			return linked, err
+		}
+		linked++
+	}
+
+	return linked, nil
+}
+
+func (r *StoreRepository) follow(store *models.Store) (*models.Store, error) {
+	for depth := 0; store.MergedIntoID != nil && depth < maxMergeDepth; depth++ {
+		var target models.Store
+		if err := r.db.First(&target, *store.MergedIntoID).Error; err != nil {
+			return nil, err
+		}
+		store = &target
+	}
+	return store, nil
+}
+
+func fillStoreDetails(store *models.Store, details models.StoreDetails) {
+	if store.Address == "" {
+		store.Address = details.Address
+	}
+	if store.City == "" {
+		store.City = details.City
+	}
+	if store.State == "" {
+		store.State = details.State
+	}
+}
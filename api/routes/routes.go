@@ -3,26 +3,47 @@ package routes
 import (
 	"buybuddy-api/config"
 	"buybuddy-api/handlers"
+	"buybuddy-api/jobs"
+	"buybuddy-api/llm"
 	"buybuddy-api/middleware"
 	"buybuddy-api/repository"
+	"buybuddy-api/storage"
+	"context"
 
 	"github.com/labstack/echo/v4"
 	"gorm.io/gorm"
 )
 
-func Setup(e *echo.Echo, cfg *config.Config, db *gorm.DB) {
+func Setup(e *echo.Echo, cfg *config.Config, db *gorm.DB, store storage.Store, llms *llm.Registry) {
 	userRepo := repository.NewUserRepository(db)
 	receiptRepo := repository.NewReceiptRepository(db)
 	categoryRepo := repository.NewCategoryRepository(db)
 	chatRepo := repository.NewChatRepository(db)
 	prefsRepo := repository.NewPreferencesRepository(db)
 	shoppingListRepo := repository.NewShoppingListRepository(db)
+	receiptImageRepo := repository.NewReceiptImageRepository(db)
+	receiptJobRepo := repository.NewReceiptJobRepository(db)
+	storeRepo := repository.NewStoreRepository(db)
+	productRepo := repository.NewProductRepository(db)
+	itemMappingRepo := repository.NewItemMappingRepository(db)
+	ruleRepo := repository.NewNormalizationRuleRepository(db)
+
+	receiptJobs := jobs.NewRunner(receiptJobRepo, cfg.ReceiptJobs)
 
 	authHandler := handlers.NewAuthHandler(cfg, userRepo)
-	receiptHandler := handlers.NewReceiptHandler(cfg, receiptRepo, categoryRepo)
-	assistantHandler := handlers.NewAssistantHandler(cfg, receiptRepo, chatRepo, prefsRepo, categoryRepo)
-	preferencesHandler := handlers.NewPreferencesHandler(prefsRepo)
+	receiptHandler := handlers.NewReceiptHandler(cfg, receiptRepo, categoryRepo, receiptImageRepo, storeRepo, productRepo, itemMappingRepo, ruleRepo, receiptJobRepo, receiptJobs, store, llms)
+	assistantHandler := handlers.NewAssistantHandler(llms, receiptRepo, chatRepo, prefsRepo, categoryRepo)
+	preferencesHandler := handlers.NewPreferencesHandler(prefsRepo, llms)
 	shoppingListHandler := handlers.NewShoppingListHandler(shoppingListRepo, userRepo)
+	storeHandler := handlers.NewStoreHandler(storeRepo)
+	productHandler := handlers.NewProductHandler(productRepo)
+	itemMappingHandler := handlers.NewItemMappingHandler(itemMappingRepo)
+	ruleHandler := handlers.NewNormalizationRuleHandler(ruleRepo, categoryRepo)
+	exportHandler := handlers.NewExportHandler(receiptRepo, prefsRepo)
+	splitHandler := handlers.NewSplitHandler(receiptRepo, userRepo)
+
+	receiptJobs.Start(context.Background(), receiptHandler.RunReceiptJob)
+	jobs.StartTrashPurge(context.Background(), receiptRepo, receiptImageRepo, store, cfg.TrashRetention())
 
 	e.GET("/health", handlers.Health)
 
@@ -36,11 +57,64 @@ func Setup(e *echo.Echo, cfg *config.Config, db *gorm.DB) {
 	receipts := api.Group("/receipts")
 	receipts.Use(middleware.AuthMiddleware(cfg.JWTSecret))
 	receipts.POST("/process", receiptHandler.ProcessReceipt)
+	receipts.POST("/process-text", receiptHandler.ProcessText)
+	receipts.POST("/import-qr", receiptHandler.ImportQRCode)
+	receipts.POST("/import-xml", receiptHandler.ImportXML)
+	receipts.POST("/jobs", receiptHandler.CreateReceiptJob)
+	receipts.GET("/jobs/:id", receiptHandler.GetReceiptJob)
 	receipts.POST("", receiptHandler.SaveReceipt)
 	receipts.GET("", receiptHandler.GetReceipts)
+	receipts.GET("/items/search", receiptHandler.SearchItems)
+	receipts.GET("/export", exportHandler.ExportReceipts)
+	receipts.GET("/splits", splitHandler.GetSharedReceipts)
+	receipts.GET("/splits/balances", splitHandler.GetSplitBalances)
+	receipts.GET("/splits/invites", splitHandler.GetSplitInvites)
+	receipts.PUT("/splits/invites/:id/accept", splitHandler.AcceptSplits)
+	receipts.PUT("/splits/invites/:id/reject", splitHandler.RejectSplits)
+	receipts.GET("/review", receiptHandler.GetReviewQueue)
+	receipts.POST("/review/:itemId", receiptHandler.ReviewItem)
+	receipts.GET("/trash", receiptHandler.GetTrash)
+	receipts.DELETE("/trash", receiptHandler.EmptyTrash)
+	receipts.DELETE("/trash/:id", receiptHandler.PurgeReceipt)
 	receipts.GET("/:id", receiptHandler.GetReceipt)
+	receipts.GET("/:id/images", receiptHandler.GetReceiptImages)
+	receipts.GET("/:id/image", receiptHandler.GetReceiptImage)
+	receipts.PUT("/:id", receiptHandler.UpdateReceipt)
+	receipts.PATCH("/:id/items/:itemId", receiptHandler.UpdateReceiptItem)
+	receipts.POST("/:id/reprocess", receiptHandler.ReprocessReceipt)
+	receipts.POST("/:id/reprocess/:reprocessId/accept", receiptHandler.AcceptReprocess)
+	receipts.GET("/:id/splits", splitHandler.GetReceiptSplits)
+	receipts.PUT("/:id/splits", splitHandler.UpdateReceiptSplits)
+	receipts.POST("/:id/restore", receiptHandler.RestoreReceipt)
 	receipts.DELETE("/:id", receiptHandler.DeleteReceipt)
 
+	stores := api.Group("/stores")
+	stores.Use(middleware.AuthMiddleware(cfg.JWTSecret))
+	stores.GET("", storeHandler.GetStores)
+	stores.PUT("/:id", storeHandler.UpdateStore)
+	stores.POST("/:id/merge", storeHandler.MergeStores)
+
+	products := api.Group("/products")
+	products.Use(middleware.AuthMiddleware(cfg.JWTSecret))
+	products.GET("", productHandler.GetProducts)
+	products.GET("/:id", productHandler.GetProduct)
+	products.POST("/:id/merge", productHandler.MergeProducts)
+	products.POST("/:id/split", productHandler.SplitProduct)
+
+	itemMappings := api.Group("/item-mappings")
+	itemMappings.Use(middleware.AuthMiddleware(cfg.JWTSecret))
+	itemMappings.GET("", itemMappingHandler.GetItemMappings)
+	itemMappings.PUT("/:id", itemMappingHandler.UpdateItemMapping)
+	itemMappings.DELETE("/:id", itemMappingHandler.DeleteItemMapping)
+
+	rules := api.Group("/normalization-rules")
+	rules.Use(middleware.AuthMiddleware(cfg.JWTSecret))
+	rules.GET("", ruleHandler.GetRules)
+	rules.POST("", ruleHandler.CreateRule)
+	rules.POST("/dry-run", ruleHandler.DryRunRule)
+	rules.PUT("/:id", ruleHandler.UpdateRule)
+	rules.DELETE("/:id", ruleHandler.DeleteRule)
+
 	assistant := api.Group("/assistant")
 	assistant.Use(middleware.AuthMiddleware(cfg.JWTSecret))
 	assistant.POST("/ask", assistantHandler.AskQuestion)
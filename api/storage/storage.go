@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"buybuddy-api/config"
+)
+
+var ErrNotFound = errors.New("object not found")
+
+// Store keeps receipt originals and derived files (thumbnails) by key.
+// Keys are slash-separated paths such as "receipts/<user>/<upload>/page-1.jpg".
+type Store interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+}
+
+func New(cfg config.StorageConfig) (Store, error) {
+	switch cfg.Driver {
+	case "", "local":
+		return NewLocalStore(cfg.LocalPath)
+	case "s3":
+		return NewS3Store(cfg.S3)
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.Driver)
+	}
+}
+
+// DeleteAll deletes every key, carrying on past failures, and returns them
+// joined.
+func DeleteAll(ctx context.Context, s Store, keys []string) error {
+	var errs []error
+	for _, key := range keys {
+		if err := s.Delete(ctx, key); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,166 @@
+// Package units reads package sizes and units of measure as printed on
+// receipts and converts them to a standard unit per dimension, so prices of
+// different package sizes can be compared.
+package units
+
+import (
+	"buybuddy-api/normalize"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Standard units: prices are compared per kilogram, litre or unit.
+const (
+	Kilogram = "kg"
+	Litre    = "L"
+	Unit     = "un"
+)
+
+// unitFactors gives each unit's standard unit and how many standard units
+// one of it is.
+var unitFactors = map[string]struct {
+	standard string
+	factor   float64
+}{
+	"KG": {Kilogram, 1}, "KGS": {Kilogram, 1}, "QUILO": {Kilogram, 1}, "QUILOS": {Kilogram, 1},
+	"G": {Kilogram, 0.001}, "GR": {Kilogram, 0.001}, "GRS": {Kilogram, 0.001},
+	"GRAMA": {Kilogram, 0.001}, "GRAMAS": {Kilogram, 0.001}, "MG": {Kilogram, 0.000001},
+	"L": {Litre, 1}, "LT": {Litre, 1}, "LTS": {Litre, 1}, "LITRO": {Litre, 1}, "LITROS": {Litre, 1},
+	"ML": {Litre, 0.001},
+	"UN": {Unit, 1}, "UND": {Unit, 1}, "UNID": {Unit, 1}, "UNIDADE": {Unit, 1}, "UNIDADES": {Unit, 1},
+	"U": {Unit, 1}, "PC": {Unit, 1}, "PCS": {Unit, 1}, "PECA": {Unit, 1},
+	"DZ": {Unit, 12}, "DUZIA": {Unit, 12}, "DUZIAS": {Unit, 12},
+}
+
+var (
+	multipackRegex = regexp.MustCompile(`\b(\d+)\s*X\s*(\d+(?:[.,]\d+)?)\s*(KGS?|GRS?|GR|G|MG|ML|LTS?|L)\b`)
+	sizeRegex      = regexp.MustCompile(`(\d+(?:[.,]\d+)?)\s*(KGS?|GRAMAS?|GRS?|G|MG|ML|LITROS?|LTS?|L)\b`)
+	countRegex     = regexp.MustCompile(`(?:\bC/\s*|\bCOM\s+)(\d+)\b|\b(\d+)\s*(?:UN|UND|UNID|UNIDADES)\b`)
+	dozenRegex     = regexp.MustCompile(`\b(\d+)?\s*(?:DZ|DUZIAS?)\b`)
+)
+
+// Size is an amount in a standard unit.
+type Size struct {
+	Amount float64
+	Unit   string
+}
+
+// Measurement is how much of a standard unit one unit of an item's quantity
+// holds, and what the item cost per standard unit.
+type Measurement struct {
+	Size         float64
+	Unit         string
+	PricePerUnit float64
+}
+
+// ParseUnit returns the standard unit of a unit of measure ("KG", "ml",
+// "dz", ...) and how many standard units one of it is.
+func ParseUnit(unit string) (string, float64, bool) {
+	key := strings.TrimSuffix(normalize.Key(unit), ".")
+	f, ok := unitFactors[strings.ReplaceAll(key, " ", "")]
+	if !ok {
+		return "", 0, false
+	}
+	return f.standard, f.factor, true
+}
+
+// Convert converts amount between units of the same dimension: grams to
+// kilograms, litres to millilitres, dozens to units.
+func Convert(amount float64, from, to string) (float64, bool) {
+	fromStandard, fromFactor, ok := ParseUnit(from)
+	if !ok {
+		return 0, false
+	}
+	toStandard, toFactor, ok := ParseUnit(to)
+	if !ok || fromStandard != toStandard {
+		return 0, false
+	}
+	return amount * fromFactor / toFactor, true
+}
+
+// ParseSize finds the package size in a product name: "ARROZ 5KG" is 5 kg,
+// "CERVEJA 6X350ML" 2.1 L, "OVOS C/12" and "OVOS DZ" 12 units.
+func ParseSize(name string) (Size, bool) {
+	name = strings.ToUpper(normalize.RemoveAccents(name))
+
+	if parts := multipackRegex.FindStringSubmatch(name); parts != nil {
+		count, err := strconv.Atoi(parts[1])
+		amount, ok := parseAmount(parts[2])
+		if err == nil && ok && count > 0 {
+			if size, ok := toStandard(float64(count)*amount, parts[3]); ok {
+				return size, true
+			}
+		}
+	}
+
+	if parts := sizeRegex.FindStringSubmatch(name); parts != nil {
+		if amount, ok := parseAmount(parts[1]); ok {
+			if size, ok := toStandard(amount, parts[2]); ok {
+				return size, true
+			}
+		}
+	}
+
+	if parts := countRegex.FindStringSubmatch(name); parts != nil {
+		digits := parts[1]
+		if digits == "" {
+			digits = parts[2]
+		}
+		if count, err := strconv.Atoi(digits); err == nil && count > 0 {
+			return Size{Amount: float64(count), Unit: Unit}, true
+		}
+	}
+
+	if parts := dozenRegex.FindStringSubmatch(name); parts != nil {
+		dozens := 1
+		if parts[1] != "" {
+			if n, err := strconv.Atoi(parts[1]); err == nil && n > 0 {
+				dozens = n
+			}
+		}
+		return Size{Amount: float64(12 * dozens), Unit: Unit}, true
+	}
+
+	return Size{}, false
+}
+
+// Measure works out an item's size and price per standard unit. Items sold
+// by weight or volume are measured by their unit; items sold by the unit or
+// package by the size in their name, or as single units when it has none.
+// totalPrice is what was paid for the whole quantity.
+func Measure(name, unit string, quantity, totalPrice float64) Measurement {
+	standard, factor, ok := ParseUnit(unit)
+
+	m := Measurement{Size: 1, Unit: Unit}
+	if ok && standard != Unit {
+		m = Measurement{Size: factor, Unit: standard}
+	} else if size, found := ParseSize(name); found {
+		m = Measurement{Size: size.Amount, Unit: size.Unit}
+	} else if ok {
+		m.Size = factor
+	}
+
+	if quantity > 0 && totalPrice > 0 {
+		m.PricePerUnit = math.Round(totalPrice/(quantity*m.Size)*100) / 100
+	}
+	return m
+}
+
+func toStandard(amount float64, unit string) (Size, bool) {
+	standard, factor, ok := ParseUnit(unit)
+	if !ok || amount <= 0 {
+		return Size{}, false
+	}
+	return Size{Amount: math.Round(amount*factor*1e6) / 1e6, Unit: standard}, true
+}
+
+// parseAmount reads "1,5" and "1.5" as decimals and "1.000" as a thousand.
+func parseAmount(text string) (float64, bool) {
+	if i := strings.Index(text, "."); i >= 0 && len(text)-i-1 == 3 {
+		text = strings.Replace(text, ".", "", 1)
+	}
+	amount, err := strconv.ParseFloat(strings.Replace(text, ",", ".", 1), 64)
+	return amount, err == nil
+}
@@ -1,19 +1,18 @@
 package utils
 
 import (
+	"buybuddy-api/llm"
 	"buybuddy-api/models"
+	"buybuddy-api/normalize"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
 	"time"
-
-	"google.golang.org/genai"
 )
 
-const cheapModel = "gemini-2.5-flash-lite"
-
 const schemaDescription = `Database schema for user receipts:
 
 RECEIPTS table:
@@ -21,6 +20,10 @@ RECEIPTS table:
 - company: store/company name where purchase was made
 - date: purchase date (YYYY-MM-DD format)
 - total: total amount paid
+- discount: receipt-level discount
+- tax_amount: approximate taxes included in the total (Lei 12.741/2012)
+- payment_method: credit, debit, pix, cash, voucher or other (may be empty)
+- change: change given back
 
 RECEIPT_ITEMS table (each receipt has multiple items):
 - name: cleaned product name
@@ -29,16 +32,12 @@ RECEIPT_ITEMS table (each receipt has multiple items):
 - quantity: amount purchased
 - unit: unit of measurement (un, kg, L, etc.)
 - unit_price: price per unit
-- total_price: total price for this item
+- total_price: total price for this item, after its discount
+- discount: discount applied to this item
 - category: product category name
 - subcategory: product subcategory name
-- barcode: product barcode (may be empty)`
-
-func createGeminiClient(ctx context.Context, apiKey string) (*genai.Client, error) {
-	return genai.NewClient(ctx, &genai.ClientConfig{
-		APIKey: apiKey,
-	})
-}
+- barcode: product barcode (may be empty)
+- product_id: links purchases of the same product across receipts`
 
 func buildConversationContext(conversationHistory []models.ChatMessage) string {
 	if len(conversationHistory) == 0 {
@@ -125,6 +124,8 @@ OPTION B - Query needed (for questions about purchases, prices, products, spendi
     "dateTo": "YYYY-MM-DD if date range mentioned",
     "minPrice": null or number,
     "maxPrice": null or number,
+    "paymentMethod": ["credit" | "debit" | "pix" | "cash" | "voucher" | "other" if payment method mentioned],
+    "hasDiscount": true only if the user asks about discounts,
     "limit": number (how many results needed, e.g., 1 for "last purchase", 5 for "last 5", null for all),
     "orderBy": "date_desc" | "date_asc" | "total_desc" | "total_asc" (default: date_desc),
     "returnFullReceipt": false (set to true ONLY if user needs to see ALL items from matching receipts, not just the queried products)
@@ -147,6 +148,7 @@ OPTION B - Query needed (for questions about purchases, prices, products, spendi
 IMPORTANT NOTES:
 - When searching for multiple specific product names (e.g., "patinho bovino", "leite"), the category filter will be ignored automatically since products span multiple categories
 - Use returnFullReceipt: true only when user asks something like "what else did I buy with X" or "show me the full receipt"
+- Questions about taxes paid or totals by payment method ("how much did I pay in taxes this year", "what did I spend via PIX") need whole receipts: leave productName empty and use dateFrom/dateTo and paymentMethod
 
 LIMIT AND ORDER EXAMPLES:
 - "last purchase" → limit: 1, orderBy: "date_desc"
@@ -166,26 +168,9 @@ For the general query, make it less restrictive than specific:
 Only include non-empty fields. Omit fields with empty arrays or null values.`, schemaDescription, categoryList, currentTime.Format("2006-01-02"), currentTime.Weekday().String(), firstReceiptInfo, conversationContext, question)
 }
 
-func parseIntentResponse(response string) (*models.AssistantIntentResponse, error) {
-	response = strings.TrimSpace(response)
-	response = strings.TrimPrefix(response, "```json")
-	response = strings.TrimPrefix(response, "```")
-	response = strings.TrimSuffix(response, "```")
-	response = strings.TrimSpace(response)
-
-	var intent models.AssistantIntentResponse
-	if err := json.Unmarshal([]byte(response), &intent); err != nil {
-		return nil, fmt.Errorf("failed to parse intent response: %w", err)
-	}
-	return &intent, nil
-}
-
-func DetectIntentAndGenerateQuery(ctx context.Context, question string, conversationHistory []models.ChatMessage, firstReceiptDate *time.Time, categories []models.Category, apiKey string) (*models.AssistantIntentResponse, error) {
-	client, err := createGeminiClient(ctx, apiKey)
-	if err != nil {
-		return nil, err
-	}
-
+// DetectIntentAndGenerateQuery has the intent model answer the question
+// directly or turn it into receipt queries.
+func DetectIntentAndGenerateQuery(ctx context.Context, chat llm.ChatModel, modelName string, question string, conversationHistory []models.ChatMessage, firstReceiptDate *time.Time, categories []models.Category) (*models.AssistantIntentResponse, error) {
 	brasilia := time.FixedZone("BRT", -3*60*60)
 	currentTime := time.Now().In(brasilia)
 
@@ -193,37 +178,20 @@ func DetectIntentAndGenerateQuery(ctx context.Context, question string, conversa
 
 	log.Println("Intent detection prompt:", prompt)
 
-	var intent *models.AssistantIntentResponse
 	var lastErr error
 
 	for attempt := 0; attempt < 2; attempt++ {
-		resp, err := client.Models.GenerateContent(ctx, cheapModel, []*genai.Content{
-			{
-				Role: "user",
-				Parts: []*genai.Part{
-					{Text: prompt},
-				},
-			},
-		}, nil)
-		if err != nil {
-			lastErr = fmt.Errorf("failed to generate content: %w", err)
-			continue
-		}
-
-		if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
-			lastErr = fmt.Errorf("empty response from model")
-			continue
-		}
-
-		text := resp.Candidates[0].Content.Parts[0].Text
-		log.Println("Intent detection response:", text)
-		intent, err = parseIntentResponse(text)
-		if err != nil {
+		var intent llm.Intent
+		if err := chat.GenerateJSON(ctx, llm.ChatRequest{Model: modelName, Prompt: prompt}, &intent); err != nil {
+			if raw, ok := llm.RawOutput(err); ok {
+				log.Println("Intent detection response:", raw)
+			}
 			lastErr = err
 			continue
 		}
 
-		return intent, nil
+		log.Printf("Intent detection response: %+v", intent)
+		return intent.Response(), nil
 	}
 
 	return nil, fmt.Errorf("failed after 2 attempts: %w", lastErr)
@@ -244,16 +212,33 @@ func FormatReceiptsCompact(receipts []models.Receipt, filter *models.AssistantQu
 		"cat": "category",
 		"sc":  "subcategory",
 		"bc":  "barcode",
+		"pid": "product id, the same for every purchase of a product",
+		"ds":  "receipt discount",
+		"tx":  "approximate taxes in total",
+		"pm":  "payment method",
+		"dc":  "item discount",
+		"sz":  "package size in su per unit of quantity",
+		"su":  "standard unit: kg, L or un",
+		"ppu": "price paid per su, for comparing different package sizes",
 	}
 
-	shouldFilterItems := filter != nil && !filter.ReturnFullReceipt && len(filter.ProductName) > 0
+	shouldFilterItems := filter != nil && !filter.ReturnFullReceipt &&
+		(len(filter.ProductName) > 0 || len(filter.ProductID) > 0)
 
 	compactReceipts := make([]models.CompactReceipt, 0, len(receipts))
 	for _, r := range receipts {
+		company := strings.TrimSpace(r.Company)
+		if r.Store != nil {
+			company = r.Store.Name
+		}
+
 		cr := models.CompactReceipt{
-			ID:      r.ID,
-			Company: strings.TrimSpace(r.Company),
-			Total:   r.Total,
+			ID:       r.ID,
+			Company:  company,
+			Total:    r.Total,
+			Discount: r.Discount,
+			Tax:      r.TaxAmount,
+			Payment:  r.PaymentMethod,
 		}
 		if r.Date != nil {
 			cr.Date = r.Date.Format("2006-01-02")
@@ -272,6 +257,7 @@ func FormatReceiptsCompact(receipts []models.Receipt, filter *models.AssistantQu
 				Unit:    strings.TrimSpace(item.Unit),
 				UP:      item.UnitPrice,
 				TP:      item.TotalPrice,
+				Disc:    item.Discount,
 			}
 			if brand := strings.TrimSpace(item.Brand); brand != "" {
 				ci.Brand = brand
@@ -285,6 +271,14 @@ func FormatReceiptsCompact(receipts []models.Receipt, filter *models.AssistantQu
 			if barcode := strings.TrimSpace(item.Barcode); barcode != "" {
 				ci.Barcode = barcode
 			}
+			if item.ProductID != nil {
+				ci.Product = *item.ProductID
+			}
+			if item.SizeUnit != "" {
+				ci.Size = item.PackageSize
+				ci.SizeU = item.SizeUnit
+				ci.PPU = item.PricePerUnit
+			}
 			items = append(items, ci)
 		}
 		if len(items) > 0 || !shouldFilterItems {
@@ -300,16 +294,53 @@ func FormatReceiptsCompact(receipts []models.Receipt, filter *models.AssistantQu
 }
 
 func itemMatchesFilter(item models.ReceiptItem, filter *models.AssistantQueryFilter) bool {
+	if item.ProductID != nil {
+		for _, id := range filter.ProductID {
+			if *item.ProductID == id {
+				return true
+			}
+		}
+	}
+	words := strings.Fields(normalize.Key(item.Name + " " + item.RawName + " " + item.Brand))
 	for _, name := range filter.ProductName {
-		nameLower := strings.ToLower(name)
-		if strings.Contains(strings.ToLower(item.Name), nameLower) ||
-			strings.Contains(strings.ToLower(item.RawName), nameLower) {
+		if wordsMatch(strings.Fields(normalize.Key(name)), words) {
 			return true
 		}
 	}
 	return false
 }
 
+// wordsMatch is a loose, in-memory counterpart of the item search the
+// receipts were fetched with: every query word must start an item word or
+// share a stem with one, so "feijao" matches "FEIJÃO" and "tomates" matches
+// "TOMATE".
+func wordsMatch(query, words []string) bool {
+	if len(query) == 0 {
+		return false
+	}
+	for _, q := range query {
+		found := false
+		for _, word := range words {
+			if strings.HasPrefix(word, q) || sameStem(q, word) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// sameStem reports whether two words share all but at most two trailing
+// letters of the shorter one, and at least three.
+func sameStem(a, b string) bool {
+	shorter := min(len(a), len(b))
+	n := max(3, shorter-2)
+	return shorter >= n && a[:n] == b[:n]
+}
+
 func MergeResults(specific, general []models.Receipt) []models.Receipt {
 	if len(specific) >= 10 {
 		return specific
@@ -338,16 +369,7 @@ func MergeResults(specific, general []models.Receipt) []models.Receipt {
 	return result
 }
 
-func GenerateAnswer(ctx context.Context, question string, receipts *models.CompactReceiptResponse, conversationHistory []models.ChatMessage, apiKey string, modelName string) (string, error) {
-	client, err := createGeminiClient(ctx, apiKey)
-	if err != nil {
-		return "", err
-	}
-
-	if modelName == "" {
-		modelName = "gemini-2.5-flash-lite"
-	}
-
+func GenerateAnswer(ctx context.Context, chat llm.ChatModel, modelName string, question string, receipts *models.CompactReceiptResponse, conversationHistory []models.ChatMessage) (string, error) {
 	receiptsJSON, err := json.Marshal(receipts)
 	if err != nil {
 		return "", fmt.Errorf("failed to marshal receipts: %w", err)
@@ -369,7 +391,10 @@ IMPORTANT GUIDELINES:
 - If no relevant data found, tell the user you don't have that information
 - Use conversation context for references like "that product" or "the last one"
 - When counting "how many times" user bought something, count RECEIPTS (separate purchases/dates), not line items
+- Items with the same "pid" are the same product, even when their names differ
+- To compare prices of different package sizes or stores, compare "ppu" (price per kg, L or unit in "su"), not "up"
 - Each receipt ID represents one purchase occasion, even if the same product appears multiple times in one receipt
+- For taxes, add up "tx" across receipts; for spending by payment method, add up "t" of receipts with that "pm"
 
 WHEN PROVIDING PRODUCT HISTORY:
 - Product name and brand (if available)
@@ -384,25 +409,12 @@ WHEN PROVIDING PRODUCT HISTORY:
 Respond in the same language as the user's question. Be concise but informative.`, string(receiptsJSON), conversationContext, question)
 
 	log.Println("Answer generation prompt:", prompt)
-	resp, err := client.Models.GenerateContent(ctx, modelName, []*genai.Content{
-		{
-			Role: "user",
-			Parts: []*genai.Part{
-				{Text: prompt},
-			},
-		},
-	}, nil)
-	if err != nil {
-		return "", fmt.Errorf("failed to generate content: %w", err)
-	}
-
-	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
+	text, err := chat.Generate(ctx, llm.ChatRequest{Model: modelName, Prompt: prompt})
+	if errors.Is(err, llm.ErrEmptyResponse) {
 		return "I'm sorry, I couldn't find an answer to your question.", nil
 	}
-
-	text := resp.Candidates[0].Content.Parts[0].Text
-	if text == "" {
-		return "I'm sorry, I couldn't process your request.", nil
+	if err != nil {
+		return "", err
 	}
 
 	return text, nil
@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"buybuddy-api/models"
+	"buybuddy-api/normalize"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	// DuplicateWindow is how far apart two receipts' dates can be and
+	// still be the same purchase.
+	DuplicateWindow = 24 * time.Hour
+	// duplicateThreshold is the score from which a receipt is reported as
+	// a likely duplicate.
+	duplicateThreshold = 0.75
+)
+
+// Weights of each signal in the duplicate score; they add up to 1.
+const (
+	storeWeight = 0.2
+	timeWeight  = 0.2
+	totalWeight = 0.3
+	itemsWeight = 0.3
+)
+
+// FindDuplicates scores the saved candidates against a receipt about to be
+// saved and returns those that are likely the same purchase, best first.
+// Receipts from different stores are never duplicates.
+func FindDuplicates(receipt *models.Receipt, candidates []models.Receipt) []models.DuplicateCandidate {
+	duplicates := []models.DuplicateCandidate{}
+	for i := range candidates {
+		candidate := scoreDuplicate(receipt, &candidates[i])
+		if candidate.Score >= duplicateThreshold {
+			duplicates = append(duplicates, candidate)
+		}
+	}
+	sort.SliceStable(duplicates, func(i, j int) bool {
+		return duplicates[i].Score > duplicates[j].Score
+	})
+	return duplicates
+}
+
+func scoreDuplicate(receipt, saved *models.Receipt) models.DuplicateCandidate {
+	candidate := models.DuplicateCandidate{
+		Receipt:         saved,
+		TotalDifference: RoundCents(receipt.Total - saved.Total),
+		ItemSimilarity:  itemSimilarity(receipt.Items, saved.Items),
+	}
+
+	storeScore := 0.5
+	switch {
+	case receipt.StoreID != nil && saved.StoreID != nil:
+		if *receipt.StoreID != *saved.StoreID {
+			return candidate
+		}
+		storeScore = 1
+	case normalize.StoreKey(receipt.Company) != "" && normalize.StoreKey(receipt.Company) == normalize.StoreKey(saved.Company):
+		storeScore = 1
+	}
+	candidate.SameStore = storeScore == 1
+
+	timeScore := 0.5
+	if receipt.Date != nil && saved.Date != nil {
+		minutes := math.Abs(receipt.Date.Sub(*saved.Date).Minutes())
+		candidate.MinutesApart = &minutes
+		switch {
+		case minutes <= 2:
+			timeScore = 1
+		case minutes >= DuplicateWindow.Minutes():
+			timeScore = 0
+		default:
+			timeScore = 0.8 * (1 - minutes/DuplicateWindow.Minutes())
+		}
+	}
+
+	totalScore := 0.0
+	if difference := math.Abs(candidate.TotalDifference); difference <= TotalTolerance {
+		totalScore = 1
+	} else if receipt.Total > 0 {
+		// Off by 20% or more scores nothing.
+		totalScore = math.Max(0, 1-5*difference/receipt.Total)
+	}
+
+	itemsScore := candidate.ItemSimilarity
+	if len(receipt.Items) == 0 && len(saved.Items) == 0 {
+		itemsScore = 0.5
+	}
+
+	score := storeWeight*storeScore + timeWeight*timeScore + totalWeight*totalScore + itemsWeight*itemsScore
+	candidate.Score = math.Round(score*100) / 100
+	return candidate
+}
+
+// itemSimilarity is the Jaccard similarity of the two item lists counted as
+// multisets of normalized raw names.
+func itemSimilarity(a, b []models.ReceiptItem) float64 {
+	counts := make(map[string][2]int)
+	for _, item := range a {
+		key := itemKey(item)
+		c := counts[key]
+		c[0]++
+		counts[key] = c
+	}
+	for _, item := range b {
+		key := itemKey(item)
+		c := counts[key]
+		c[1]++
+		counts[key] = c
+	}
+
+	intersection, union := 0, 0
+	for _, c := range counts {
+		intersection += min(c[0], c[1])
+		union += max(c[0], c[1])
+	}
+	if union == 0 {
+		return 0
+	}
+	return math.Round(float64(intersection)/float64(union)*100) / 100
+}
+
+func itemKey(item models.ReceiptItem) string {
+	if key := normalize.Key(item.RawName); key != "" {
+		return key
+	}
+	return normalize.Key(item.Name)
+}
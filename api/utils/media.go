@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	MIMETypeJPEG = "image/jpeg"
+	MIMETypePNG  = "image/png"
+	MIMETypeWebP = "image/webp"
+	MIMETypeHEIC = "image/heic"
+	MIMETypeHEIF = "image/heif"
+	MIMETypePDF  = "application/pdf"
+)
+
+var supportedReceiptMIMETypes = map[string]bool{
+	MIMETypeJPEG: true,
+	MIMETypePNG:  true,
+	MIMETypeWebP: true,
+	MIMETypeHEIC: true,
+	MIMETypeHEIF: true,
+	MIMETypePDF:  true,
+}
+
+var mimeTypeExtensions = map[string]string{
+	MIMETypeJPEG: ".jpg",
+	MIMETypePNG:  ".png",
+	MIMETypeWebP: ".webp",
+	MIMETypeHEIC: ".heic",
+	MIMETypeHEIF: ".heif",
+	MIMETypePDF:  ".pdf",
+}
+
+func ExtensionForMIMEType(mimeType string) string {
+	if ext, ok := mimeTypeExtensions[mimeType]; ok {
+		return ext
+	}
+	return ".bin"
+}
+
+// ReceiptPart is one photo or document of a receipt sent to the model.
+type ReceiptPart struct {
+	MIMEType string
+	Data     []byte
+}
+
+func (p ReceiptPart) IsImage() bool {
+	return strings.HasPrefix(p.MIMEType, "image/")
+}
+
+// DetectMIMEType sniffs the receipt file type. net/http covers JPEG, PNG,
+// WebP and PDF; HEIC/HEIF (the iPhone camera default) is recognized from its
+// ISO-BMFF "ftyp" brand. declared is used only when sniffing is inconclusive.
+func DetectMIMEType(data []byte, declared string) (string, error) {
+	if mimeType := detectHEIF(data); mimeType != "" {
+		return mimeType, nil
+	}
+
+	detected := http.DetectContentType(data)
+	if idx := strings.Index(detected, ";"); idx != -1 {
+		detected = detected[:idx]
+	}
+	if supportedReceiptMIMETypes[detected] {
+		return detected, nil
+	}
+
+	declared = strings.ToLower(strings.TrimSpace(declared))
+	if declared == "image/jpg" {
+		declared = MIMETypeJPEG
+	}
+	if detected == "application/octet-stream" && supportedReceiptMIMETypes[declared] {
+		return declared, nil
+	}
+
+	return "", fmt.Errorf("unsupported file type %s, send JPEG, PNG, WebP, HEIC or PDF", detected)
+}
+
+func detectHEIF(data []byte) string {
+	if len(data) < 12 || !bytes.Equal(data[4:8], []byte("ftyp")) {
+		return ""
+	}
+
+	switch string(data[8:12]) {
+	case "heic", "heix", "hevc", "hevx", "heim", "heis":
+		return MIMETypeHEIC
+	case "mif1", "msf1", "heif":
+		return MIMETypeHEIF
+	}
+	return ""
+}
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"buybuddy-api/models"
+	"strings"
+)
+
+// paymentCodes maps the NF-e tPag codes to payment methods.
+var paymentCodes = map[string]string{
+	"01": models.PaymentCash,
+	"03": models.PaymentCredit,
+	"04": models.PaymentDebit,
+	"10": models.PaymentVoucher,
+	"11": models.PaymentVoucher,
+	"12": models.PaymentVoucher,
+	"13": models.PaymentVoucher,
+	"17": models.PaymentPIX,
+	"20": models.PaymentPIX,
+}
+
+// PaymentMethodFromCode returns the payment method for an NF-e tPag code.
+func PaymentMethodFromCode(code string) string {
+	if method, ok := paymentCodes[code]; ok {
+		return method
+	}
+	return models.PaymentOther
+}
+
+// NormalizePaymentMethod maps the payment text printed on receipts
+// ("Cartão de Crédito", "PIX", "Dinheiro", ...) or one of the Payment*
+// constants to a constant. Empty text stays empty.
+func NormalizePaymentMethod(text string) string {
+	text = strings.ToLower(strings.TrimSpace(text))
+	if text == "" {
+		return ""
+	}
+
+	switch {
+	case text == models.PaymentCredit || strings.Contains(text, "créd") || strings.Contains(text, "cred"):
+		return models.PaymentCredit
+	case text == models.PaymentDebit || strings.Contains(text, "déb") || strings.Contains(text, "deb"):
+		return models.PaymentDebit
+	case strings.Contains(text, "pix"):
+		return models.PaymentPIX
+	case text == models.PaymentCash || strings.Contains(text, "dinheiro") || strings.Contains(text, "espécie"):
+		return models.PaymentCash
+	case text == models.PaymentVoucher || strings.Contains(text, "vale") || strings.Contains(text, "voucher"):
+		return models.PaymentVoucher
+	}
+	return models.PaymentOther
+}
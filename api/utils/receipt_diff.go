@@ -0,0 +1,273 @@
+package utils
+
+import (
+	"buybuddy-api/models"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+const priceTolerance = 0.005
+
+// ParseReceiptDate accepts the date formats the model and the app send.
+func ParseReceiptDate(value string) *time.Time {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"} {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return &parsed
+		}
+	}
+	return nil
+}
+
+// ItemName picks the display name from an extracted item: the user's custom
+// name, then "name", then the first of the model's nameOptions.
+func ItemName(item map[string]interface{}) string {
+	if customName := mapString(item, "customName"); customName != "" {
+		return customName
+	}
+	if name := mapString(item, "name"); name != "" {
+		return name
+	}
+	if nameOptions, ok := item["nameOptions"].([]interface{}); ok && len(nameOptions) > 0 {
+		if first, ok := nameOptions[0].(string); ok {
+			return first
+		}
+	}
+	if nameOptions, ok := item["nameOptions"].([]string); ok && len(nameOptions) > 0 {
+		return nameOptions[0]
+	}
+	return ""
+}
+
+// ItemCategory returns the first categoryOptions entry, falling back to the
+// older flat category/subcategory fields.
+func ItemCategory(item map[string]interface{}) (string, string) {
+	if categoryOptions, ok := item["categoryOptions"].([]interface{}); ok && len(categoryOptions) > 0 {
+		if first, ok := categoryOptions[0].(map[string]interface{}); ok {
+			if category := mapString(first, "category"); category != "" {
+				return category, mapString(first, "subcategory")
+			}
+		}
+	}
+	return mapString(item, "category"), mapString(item, "subcategory")
+}
+
+// ItemNameOptions returns the model's nameOptions, most likely first.
+func ItemNameOptions(item map[string]interface{}) []string {
+	return nameOptions(item)
+}
+
+// ItemCategoryOptions returns the model's categoryOptions, most likely
+// first.
+func ItemCategoryOptions(item map[string]interface{}) []models.CategoryOption {
+	raw, ok := item["categoryOptions"].([]interface{})
+	if !ok {
+		return nil
+	}
+	var options []models.CategoryOption
+	for _, entry := range raw {
+		if option, ok := entry.(map[string]interface{}); ok {
+			if category := mapString(option, "category"); category != "" {
+				options = append(options, models.CategoryOption{Category: category, Subcategory: mapString(option, "subcategory")})
+			}
+		}
+	}
+	return options
+}
+
+// ItemConfidence returns how sure the model was of each field of an item,
+// clamped to 0..1, or nil when it didn't say.
+func ItemConfidence(item map[string]interface{}) map[string]float64 {
+	fields, _ := item["confidence"].(map[string]interface{})
+	var confidence map[string]float64
+	for field, value := range fields {
+		if number, ok := value.(float64); ok {
+			if confidence == nil {
+				confidence = make(map[string]float64)
+			}
+			confidence[field] = math.Max(0, math.Min(1, number))
+		}
+	}
+	return confidence
+}
+
+// DiffReceipt compares a saved receipt with a new extraction of the same
+// images, field by field and item by item.
+func DiffReceipt(saved *models.Receipt, proposed *ReceiptData) models.ReceiptDiff {
+	diff := models.ReceiptDiff{
+		Fields: []models.FieldChange{},
+		Items:  []models.ItemDiff{},
+	}
+
+	if strings.TrimSpace(saved.Company) != strings.TrimSpace(proposed.Company) && proposed.Company != "" {
+		diff.Fields = append(diff.Fields, models.FieldChange{Field: "company", Current: saved.Company, Proposed: proposed.Company})
+	}
+
+	if proposedDate := ParseReceiptDate(proposed.Date); proposedDate != nil {
+		if saved.Date == nil || !sameWallClock(*saved.Date, *proposedDate) {
+			var current interface{}
+			if saved.Date != nil {
+				current = saved.Date.Format(time.RFC3339)
+			}
+			diff.Fields = append(diff.Fields, models.FieldChange{Field: "date", Current: current, Proposed: proposed.Date})
+		}
+	}
+
+	if !samePrice(saved.Total, proposed.Total) && proposed.Total != 0 {
+		diff.Fields = append(diff.Fields, models.FieldChange{Field: "total", Current: saved.Total, Proposed: proposed.Total})
+	}
+
+	if proposed.AccessKey != "" && proposed.AccessKey != saved.AccessKey {
+		diff.Fields = append(diff.Fields, models.FieldChange{Field: "accessKey", Current: saved.AccessKey, Proposed: proposed.AccessKey})
+	}
+
+	matched := make(map[int]bool)
+	for i, item := range proposed.Items {
+		savedIdx := findMatchingItem(item, saved.Items, matched)
+		if savedIdx == -1 {
+			diff.Items = append(diff.Items, models.ItemDiff{
+				Key:      fmt.Sprintf("new:%d", i),
+				Status:   models.ItemDiffAdded,
+				Proposed: item,
+			})
+			continue
+		}
+
+		matched[savedIdx] = true
+		current := saved.Items[savedIdx]
+		changes := itemChanges(current, item)
+
+		status := models.ItemDiffChanged
+		if len(changes) == 0 {
+			status = models.ItemDiffUnchanged
+		}
+		diff.Items = append(diff.Items, models.ItemDiff{
+			Key:      fmt.Sprintf("item:%d", current.ID),
+			Status:   status,
+			ItemID:   &saved.Items[savedIdx].ID,
+			Current:  &saved.Items[savedIdx],
+			Proposed: item,
+			Changes:  changes,
+		})
+	}
+
+	for i := range saved.Items {
+		if matched[i] {
+			continue
+		}
+		diff.Items = append(diff.Items, models.ItemDiff{
+			Key:     fmt.Sprintf("item:%d", saved.Items[i].ID),
+			Status:  models.ItemDiffRemoved,
+			ItemID:  &saved.Items[i].ID,
+			Current: &saved.Items[i],
+		})
+	}
+
+	return diff
+}
+
+// findMatchingItem pairs an extracted item with a saved one, trying the
+// strictest criteria first: same raw name and price, same raw name, same
+// display name, then same price with mostly the same words.
+func findMatchingItem(item map[string]interface{}, saved []models.ReceiptItem, matched map[int]bool) int {
+	rawName := normalizeLineName(mapString(item, "rawName"))
+	name := normalizeLineName(ItemName(item))
+	total := mapFloat(item, "totalPrice")
+
+	criteria := []func(models.ReceiptItem) bool{
+		func(s models.ReceiptItem) bool {
+			return rawName != "" && normalizeLineName(s.RawName) == rawName && samePrice(s.TotalPrice, total)
+		},
+		func(s models.ReceiptItem) bool {
+			return rawName != "" && normalizeLineName(s.RawName) == rawName
+		},
+		func(s models.ReceiptItem) bool {
+			return name != "" && normalizeLineName(s.Name) == name
+		},
+		func(s models.ReceiptItem) bool {
+			return samePrice(s.TotalPrice, total) && wordOverlap(normalizeLineName(s.RawName), rawName) >= 0.5
+		},
+	}
+
+	for _, matches := range criteria {
+		for i, s := range saved {
+			if !matched[i] && matches(s) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func itemChanges(current models.ReceiptItem, proposed map[string]interface{}) []models.FieldChange {
+	var changes []models.FieldChange
+
+	compareString := func(field, currentValue, proposedValue string) {
+		if proposedValue != "" && strings.TrimSpace(currentValue) != strings.TrimSpace(proposedValue) {
+			changes = append(changes, models.FieldChange{Field: field, Current: currentValue, Proposed: proposedValue})
+		}
+	}
+	compareNumber := func(field string, currentValue float64) {
+		if _, ok := proposed[field]; !ok {
+			return
+		}
+		if proposedValue := mapFloat(proposed, field); !samePrice(currentValue, proposedValue) {
+			changes = append(changes, models.FieldChange{Field: field, Current: currentValue, Proposed: proposedValue})
+		}
+	}
+
+	compareString("rawName", current.RawName, mapString(proposed, "rawName"))
+	compareString("name", current.Name, ItemName(proposed))
+	compareString("brand", current.Brand, mapString(proposed, "brand"))
+	compareNumber("quantity", current.Quantity)
+	compareString("unit", current.Unit, mapString(proposed, "unit"))
+	compareNumber("unitPrice", current.UnitPrice)
+	compareNumber("totalPrice", current.TotalPrice)
+
+	category, subcategory := ItemCategory(proposed)
+	currentCategory, currentSubcategory := "", ""
+	if current.Category != nil {
+		currentCategory = current.Category.Name
+	}
+	if current.Subcategory != nil {
+		currentSubcategory = current.Subcategory.Name
+	}
+	compareString("category", currentCategory, category)
+	compareString("subcategory", currentSubcategory, subcategory)
+
+	return changes
+}
+
+func samePrice(a, b float64) bool {
+	return math.Abs(a-b) < priceTolerance
+}
+
+func sameWallClock(a, b time.Time) bool {
+	return a.Format("2006-01-02T15:04") == b.Format("2006-01-02T15:04")
+}
+
+func wordOverlap(a, b string) float64 {
+	wordsA := strings.Fields(a)
+	wordsB := strings.Fields(b)
+	if len(wordsA) == 0 || len(wordsB) == 0 {
+		return 0
+	}
+
+	set := make(map[string]bool, len(wordsA))
+	for _, w := range wordsA {
+		set[w] = true
+	}
+	common := 0
+	for _, w := range wordsB {
+		if set[w] {
+			common++
+		}
+	}
+
+	longest := len(wordsA)
+	if len(wordsB) > longest {
+		longest = len(wordsB)
+	}
+	return float64(common) / float64(longest)
+}
@@ -1,20 +1,44 @@
 package utils
 
 import (
+	"buybuddy-api/llm"
+	"buybuddy-api/models"
 	"context"
-	"encoding/json"
 	"fmt"
 	"strings"
-
-	"google.golang.org/genai"
 )
 
 type ReceiptData struct {
 	Company   string                   `json:"company"`
 	Date      string                   `json:"date"`
 	Total     float64                  `json:"total"`
+	Discount  float64                  `json:"discount,omitempty"`
 	AccessKey string                   `json:"accessKey"`
 	Items     []map[string]interface{} `json:"items"`
+
+	// TaxAmount is the approximate tax printed under Lei 12.741/2012;
+	// PaymentMethod is one of the models.Payment* constants.
+	TaxAmount     float64 `json:"taxAmount,omitempty"`
+	PaymentMethod string  `json:"paymentMethod,omitempty"`
+	AmountPaid    float64 `json:"amountPaid,omitempty"`
+	Change        float64 `json:"change,omitempty"`
+
+	// Reconciliation compares the items with the total; see ReconcileReceiptData.
+	Reconciliation *models.Reconciliation `json:"reconciliation,omitempty"`
+
+	// AccessKeyStatus is "valid", "repaired" or "invalid" once the key has
+	// been checked; AccessKeyCandidates lists possible corrections when the
+	// key could not be repaired unambiguously.
+	AccessKeyStatus     string   `json:"accessKeyStatus,omitempty"`
+	AccessKeyOriginal   string   `json:"accessKeyOriginal,omitempty"`
+	AccessKeyCandidates []string `json:"accessKeyCandidates,omitempty"`
+
+	// UploadID identifies the stored originals; send it back when saving.
+	UploadID string `json:"uploadId,omitempty"`
+
+	// UnparsedLines are lines of OCR text that may be items but could not
+	// be read, for the user to add by hand.
+	UnparsedLines []string `json:"unparsedLines,omitempty"`
 }
 
 type CategoryInfo struct {
@@ -27,23 +51,19 @@ type ItemMapping struct {
 	Name    string
 }
 
-func ProcessReceiptWithGemini(ctx context.Context, imageData []byte, apiKey string, categories []CategoryInfo, itemMappings []ItemMapping, modelName string) (*ReceiptData, error) {
-	client, err := genai.NewClient(ctx, &genai.ClientConfig{
-		APIKey: apiKey,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to create Gemini client: %w", err)
-	}
-
-	if modelName == "" {
-		modelName = "gemini-2.5-flash"
+// ExtractReceipt has the receipt model read the pages, with the category
+// list and the user's learned item names in the prompt.
+func ExtractReceipt(ctx context.Context, extractor llm.ReceiptExtractor, modelName string, parts []ReceiptPart, categories []CategoryInfo, itemMappings []ItemMapping) (*ReceiptData, error) {
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("no receipt image provided")
 	}
 
 	categoriesText := buildCategoriesText(categories)
 	itemMappingsText := buildItemMappingsText(itemMappings)
+	partsText := buildPartsText(parts)
 
 	prompt := fmt.Sprintf(`Você é uma IA especializada em ler notas fiscais brasileiras.
-Analise esta imagem de nota fiscal e extraia as seguintes informações:
+Analise esta nota fiscal e extraia as seguintes informações:
 1. Nome da empresa/loja
 2. Data e hora da compra
 3. Valor total
@@ -58,7 +78,10 @@ REGRAS IMPORTANTES:
 - Preços devem estar em formato decimal (ex: 10.50)
 - Data deve estar no formato ISO 8601: "YYYY-MM-DDTHH:MM:SS" (ex: "2024-03-15T14:30:00")
 - A Chave de Acesso é um código de 44 dígitos, geralmente rotulado como "Chave de Acesso" ou mostrado como número de código de barras
-
+- total é o valor a pagar, já com descontos; discount é a soma de todos os descontos da nota ("Desconto", "Descontos"), incluindo os descontos dos itens, 0 se não houver
+- taxAmount é o valor aproximado dos tributos (Lei 12.741/2012, "Tributos Totais Incidentes", "Val Aprox Tributos"), 0 se não houver
+- paymentMethod é a forma de pagamento: "credit" (cartão de crédito), "debit" (cartão de débito), "pix", "cash" (dinheiro), "voucher" (vale alimentação/refeição) ou "other"; amountPaid é o valor pago e change é o troco, 0 se não houver
+%s
 Para cada item, você DEVE extrair no mínimo:
 - rawName: O nome EXATO do produto como escrito na nota fiscal, incluindo abreviações (OBRIGATÓRIO)
 - nameOptions: Um array de 1-3 versões MELHORADAS e legíveis do nome do produto - expanda abreviações, corrija erros, deixe claro. A primeira opção deve ser a mais provável, seguida de alternativas se aplicável (OBRIGATÓRIO)
@@ -69,7 +92,10 @@ Adicionalmente, extraia se visível:
 - quantity: Quantidade numérica
 - unit: Unidade de medida ("kg", "un", "L", "g", "ml", "cx" para caixa, etc.)
 - unitPrice: Preço por unidade (se visível, calcule a partir de total/quantidade se necessário)
+- discount: Desconto aplicado a este item (0 se não houver); totalPrice já deve estar com o desconto, que também entra no discount da nota
 - categoryOptions: Array de 1-2 possíveis categorias com suas subcategorias em PORTUGUÊS. A primeira deve ser a mais provável. Formato: [{"category": "Alimentos", "subcategory": "Laticínios"}]
+- page: Número (começando em 1) da imagem ou documento onde o item foi lido
+- confidence: Sua confiança, de 0 a 1, em cada campo do item: {"name": 0.9, "category": 0.8, "quantity": 1.0, "totalPrice": 1.0}. Use valores baixos quando a abreviação for ambígua, a categoria for incerta ou o texto estiver borrado
 
 EXEMPLOS DE MELHORIA DE NOME DE PRODUTO:
 - rawName: "LT UHT ITAMBE" → nameOptions: ["Leite UHT Itambé"]
@@ -89,6 +115,11 @@ Retorne os dados neste formato JSON exato:
   "company": "Company Name or null",
   "date": "2024-03-15T14:30:00 or null",
   "total": 0.00 or null,
+  "discount": 0.00,
+  "taxAmount": 0.00,
+  "paymentMethod": "credit" | "debit" | "pix" | "cash" | "voucher" | "other" | null,
+  "amountPaid": 0.00,
+  "change": 0.00,
   "accessKey": "44-digit number or null",
   "items": [
     {
@@ -99,6 +130,9 @@ Retorne os dados neste formato JSON exato:
       "unit": "un",
       "unitPrice": 0.00,
       "totalPrice": 0.00,
+      "discount": 0.00,
+      "page": 1,
+      "confidence": {"name": 0.9, "category": 0.8, "quantity": 1.0, "totalPrice": 1.0},
       "categoryOptions": [
         {"category": "Laticínios", "subcategory": "Leite"},
         {"category": "Bebidas", "subcategory": "Leite"}
@@ -110,58 +144,37 @@ Retorne os dados neste formato JSON exato:
 CRITICAL: If you cannot extract the required fields (rawName, nameOptions and totalPrice) for any items, return an error:
 {
   "error": "Could not extract required item information (name and price) from the receipt"
-}`, itemMappingsText, categoriesText)
-
-	resp, err := client.Models.GenerateContent(ctx, modelName, []*genai.Content{
-		{
-			Role: "user",
-			Parts: []*genai.Part{
-				{Text: prompt},
-				{InlineData: &genai.Blob{
-					MIMEType: "image/jpeg",
-					Data:     imageData,
-				}},
-			},
-		},
-	}, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate content: %w", err)
-	}
+}`, partsText, itemMappingsText, categoriesText)
 
-	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
-		return nil, fmt.Errorf("no response from Gemini")
+	pages := make([]llm.Page, len(parts))
+	for i, part := range parts {
+		pages[i] = llm.Page{MIMEType: part.MIMEType, Data: part.Data}
 	}
 
-	textPart := resp.Candidates[0].Content.Parts[0]
-	if textPart.Text == "" {
-		return nil, fmt.Errorf("unexpected response format from Gemini")
-	}
-
-	responseText := textPart.Text
-
-	var result struct {
-		Error     string                   `json:"error"`
-		Company   *string                  `json:"company"`
-		Total     *float64                 `json:"total"`
-		AccessKey *string                  `json:"accessKey"`
-		Items     []map[string]interface{} `json:"items"`
-	}
-
-	cleanJSON := extractJSON(responseText)
-	if err := json.Unmarshal([]byte(cleanJSON), &result); err != nil {
-		return nil, fmt.Errorf("failed to parse Gemini response: %w", err)
+	result, err := extractor.ExtractReceipt(ctx, llm.ReceiptRequest{Model: modelName, Prompt: prompt, Pages: pages})
+	if err != nil {
+		return nil, err
 	}
 
 	if result.Error != "" {
-		return nil, fmt.Errorf("gemini error: %s", result.Error)
+		return nil, fmt.Errorf("model error: %s", result.Error)
 	}
 
 	if result.Company == nil && result.Total == nil {
 		return nil, fmt.Errorf("insufficient data extracted from receipt")
 	}
 
+	items := make([]map[string]interface{}, 0, len(result.Items))
+	for i := range result.Items {
+		fields, err := result.Items[i].Fields()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, fields)
+	}
+
 	receiptData := &ReceiptData{
-		Items: result.Items,
+		Items: MergeOverlappingItems(items, parts),
 	}
 
 	if result.Company != nil {
@@ -170,10 +183,34 @@ CRITICAL: If you cannot extract the required fields (rawName, nameOptions and to
 		receiptData.Company = "Unknown Company"
 	}
 
+	if result.Date != nil {
+		receiptData.Date = *result.Date
+	}
+
 	if result.Total != nil {
 		receiptData.Total = *result.Total
 	}
 
+	if result.Discount != nil && *result.Discount > 0 {
+		receiptData.Discount = *result.Discount
+	}
+
+	if result.TaxAmount != nil && *result.TaxAmount > 0 {
+		receiptData.TaxAmount = *result.TaxAmount
+	}
+
+	if result.PaymentMethod != nil {
+		receiptData.PaymentMethod = NormalizePaymentMethod(*result.PaymentMethod)
+	}
+
+	if result.AmountPaid != nil && *result.AmountPaid > 0 {
+		receiptData.AmountPaid = *result.AmountPaid
+	}
+
+	if result.Change != nil && *result.Change > 0 {
+		receiptData.Change = *result.Change
+	}
+
 	if result.AccessKey != nil {
 		receiptData.AccessKey = *result.AccessKey
 	}
@@ -185,24 +222,25 @@ CRITICAL: If you cannot extract the required fields (rawName, nameOptions and to
 	return receiptData, nil
 }
 
-func extractJSON(text string) string {
-	start := -1
-	end := -1
+func buildPartsText(parts []ReceiptPart) string {
+	if len(parts) < 2 {
+		return ""
+	}
 
-	for i, char := range text {
-		if char == '{' && start == -1 {
-			start = i
-		}
-		if char == '}' {
-			end = i + 1
+	hasPDF := false
+	for _, part := range parts {
+		if !part.IsImage() {
+			hasPDF = true
 		}
 	}
 
-	if start != -1 && end != -1 && end > start {
-		return text[start:end]
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("- Você recebeu %d arquivos, em ordem, que formam UMA ÚNICA nota fiscal. Extraia uma única nota com todos os itens\n", len(parts)))
+	builder.WriteString("- Fotos consecutivas de notas longas se sobrepõem: um item visível no fim de uma foto e no início da seguinte deve aparecer UMA única vez\n")
+	if hasPDF {
+		builder.WriteString("- Documentos PDF (DANFE) podem ter várias páginas; leia todas\n")
 	}
-
-	return text
+	return builder.String()
 }
 
 func buildCategoriesText(categories []CategoryInfo) string {
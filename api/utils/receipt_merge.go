@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"math"
+	"strings"
+)
+
+// MergeOverlappingItems drops items that were read twice because consecutive
+// photos of a long receipt overlap. The model tags each item with the 1-based
+// "page" it was read from; when the last lines of one photo repeat as the
+// first lines of the next, the repeated lines are removed from the later one.
+// Repeated lines that are not on a photo boundary are genuine purchases and
+// are kept.
+func MergeOverlappingItems(items []map[string]interface{}, parts []ReceiptPart) []map[string]interface{} {
+	if len(parts) < 2 {
+		return items
+	}
+
+	byPage := make(map[int][]int)
+	for i, item := range items {
+		page := itemPage(item)
+		if page > 0 {
+			byPage[page] = append(byPage[page], i)
+		}
+	}
+
+	dropped := make(map[int]bool)
+	for page := 1; page < len(parts); page++ {
+		if !parts[page-1].IsImage() || !parts[page].IsImage() {
+			continue
+		}
+
+		prev := byPage[page]
+		next := byPage[page+1]
+		overlap := boundaryOverlap(items, prev, next)
+		for _, idx := range next[:overlap] {
+			dropped[idx] = true
+		}
+	}
+
+	if len(dropped) == 0 {
+		return items
+	}
+
+	merged := make([]map[string]interface{}, 0, len(items)-len(dropped))
+	for i, item := range items {
+		if !dropped[i] {
+			merged = append(merged, item)
+		}
+	}
+	return merged
+}
+
+// boundaryOverlap returns the length of the longest run of items at the end
+// of prev that repeats at the start of next.
+func boundaryOverlap(items []map[string]interface{}, prev, next []int) int {
+	maxOverlap := len(prev)
+	if len(next) < maxOverlap {
+		maxOverlap = len(next)
+	}
+
+	for k := maxOverlap; k > 0; k-- {
+		matches := true
+		for i := 0; i < k; i++ {
+			if !sameLine(items[prev[len(prev)-k+i]], items[next[i]]) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return k
+		}
+	}
+	return 0
+}
+
+func sameLine(a, b map[string]interface{}) bool {
+	nameA := normalizeLineName(mapString(a, "rawName"))
+	nameB := normalizeLineName(mapString(b, "rawName"))
+	if nameA == "" || nameA != nameB {
+		return false
+	}
+	return math.Abs(mapFloat(a, "totalPrice")-mapFloat(b, "totalPrice")) < 0.01
+}
+
+func normalizeLineName(name string) string {
+	return strings.Join(strings.Fields(strings.ToUpper(name)), " ")
+}
+
+func itemPage(item map[string]interface{}) int {
+	return int(mapFloat(item, "page"))
+}
+
+func mapString(m map[string]interface{}, key string) string {
+	if str, ok := m[key].(string); ok {
+		return str
+	}
+	return ""
+}
+
+func mapFloat(m map[string]interface{}, key string) float64 {
+	switch v := m[key].(type) {
+	case float64:
+		return v
+	case int:
+		return float64(v)
+	}
+	return 0
+}
@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"buybuddy-api/llm"
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ReadReceiptLines has a chat model read receipt lines the text grammar
+// could not parse. The result maps the index of each line the model
+// understood to its item, or to nil when the line is not an item; lines
+// the model skipped are left out.
+func ReadReceiptLines(ctx context.Context, chat llm.ChatModel, modelName string, lines []string, categories []CategoryInfo, itemMappings []ItemMapping) (map[int]map[string]interface{}, error) {
+	if len(lines) == 0 {
+		return map[int]map[string]interface{}{}, nil
+	}
+
+	var numbered strings.Builder
+	for i, line := range lines {
+		numbered.WriteString(fmt.Sprintf("%d: %s\n", i+1, line))
+	}
+
+	prompt := fmt.Sprintf(`Você é uma IA especializada em ler notas fiscais brasileiras (NFC-e).
+As linhas abaixo vieram do OCR de uma nota fiscal e não puderam ser lidas automaticamente. Cada uma pode ser um item (às vezes com a descrição quebrada ou com erros de OCR) ou outro texto da nota.
+
+REGRAS IMPORTANTES:
+- Responda com uma entrada por linha, usando o número da linha em "line"
+- Se a linha for um item, preencha "item"; se não for um item (cabeçalho, aviso, total), use "item": null
+- Se não conseguir entender a linha, não a inclua na resposta
+- NÃO invente ou imagine nenhuma informação; use apenas o que está na linha
+- Preços devem estar em formato decimal (ex: 10.50)
+- rawName é a descrição EXATA do produto como escrita na linha
+- nameOptions é um array de 1-3 versões legíveis do nome, expandindo abreviações, a mais provável primeiro
+- totalPrice é o valor total do item, já com desconto (OBRIGATÓRIO)
+- Se visíveis: brand, quantity, unit ("kg", "un", "L", "g", "ml", "cx"), unitPrice, discount e categoryOptions (1-2 categorias em PORTUGUÊS)
+- confidence é sua confiança, de 0 a 1, em cada campo: use valores baixos quando o OCR estiver confuso
+%s
+CATEGORIAS E SUBCATEGORIAS DISPONÍVEIS (EM PORTUGUÊS):
+%s
+
+LINHAS:
+%s
+Retorne os dados neste formato JSON exato:
+{
+  "lines": [
+    {"line": 1, "item": {"rawName": "LT UHT ITAMBE", "nameOptions": ["Leite UHT Itambé"], "quantity": 2, "unit": "un", "unitPrice": 4.99, "totalPrice": 9.98, "confidence": {"name": 0.9, "category": 0.8, "quantity": 1.0, "totalPrice": 1.0}, "categoryOptions": [{"category": "Laticínios", "subcategory": "Leite"}]}},
+    {"line": 2, "item": null}
+  ]
+}`, buildItemMappingsText(itemMappings), buildCategoriesText(categories), numbered.String())
+
+	var result llm.ReceiptLines
+	if err := chat.GenerateJSON(ctx, llm.ChatRequest{Model: modelName, Prompt: prompt}, &result); err != nil {
+		return nil, err
+	}
+
+	items := make(map[int]map[string]interface{}, len(result.Lines))
+	for _, line := range result.Lines {
+		if line.Line > len(lines) {
+			continue
+		}
+		if line.Item == nil {
+			items[line.Line-1] = nil
+			continue
+		}
+		fields, err := line.Item.Fields()
+		if err != nil {
+			return nil, err
+		}
+		items[line.Line-1] = fields
+	}
+	return items, nil
+}
@@ -0,0 +1,150 @@
+package utils
+
+import (
+	"buybuddy-api/models"
+	"fmt"
+	"math"
+)
+
+const (
+	// lineTolerance absorbs the truncation receipts apply to weighed items.
+	lineTolerance = 0.02
+	// TotalTolerance absorbs rounding across the item sum.
+	TotalTolerance = 0.01
+)
+
+// ReconcileItems checks that each item's quantity times unit price, less its
+// discount, matches its total and that the items, less the receipt discount,
+// add up to total. Items with a negative total are discount lines and only
+// count towards the sum.
+//
+// The receipt discount is the sum of every discount on the receipt, while
+// item totals are already net of their own discounts and discount lines are
+// in the sum, so only the rest of the receipt discount is taken off.
+func ReconcileItems(total, discount float64, items []models.ReceiptItem) models.Reconciliation {
+	result := models.Reconciliation{
+		Warnings: []models.ReconciliationWarning{},
+	}
+
+	itemDiscounts := 0.0
+	for i, item := range items {
+		result.ItemsTotal += item.TotalPrice
+		if item.TotalPrice < 0 {
+			itemDiscounts -= item.TotalPrice
+		} else {
+			itemDiscounts += item.Discount
+		}
+		if warning := checkLine(i, item); warning != nil {
+			if item.ID != 0 {
+				id := item.ID
+				warning.ItemID = &id
+			}
+			result.Warnings = append(result.Warnings, *warning)
+		}
+	}
+
+	result.ItemsTotal = RoundCents(result.ItemsTotal)
+	result.Discount = RoundCents(math.Max(discount-itemDiscounts, 0))
+	result.ExpectedTotal = RoundCents(result.ItemsTotal - result.Discount)
+	result.Difference = RoundCents(total - result.ExpectedTotal)
+
+	switch {
+	case len(items) == 0:
+		result.Warnings = append(result.Warnings, models.ReconciliationWarning{
+			Code:    models.WarningNoItems,
+			Message: "no items were read from the receipt",
+			Actual:  total,
+		})
+	case total <= 0:
+		result.Warnings = append(result.Warnings, models.ReconciliationWarning{
+			Code:     models.WarningMissingTotal,
+			Message:  "the receipt total is missing",
+			Expected: result.ExpectedTotal,
+		})
+	case math.Abs(result.Difference) > TotalTolerance:
+		result.Warnings = append(result.Warnings, models.ReconciliationWarning{
+			Code:     models.WarningTotalMismatch,
+			Message:  totalMismatchMessage(result.Difference),
+			Expected: total,
+			Actual:   result.ExpectedTotal,
+		})
+	}
+
+	result.Status = models.ReconciliationBalanced
+	if len(result.Warnings) > 0 {
+		result.Status = models.ReconciliationDiscrepancy
+	}
+
+	return result
+}
+
+// ReconcileReceiptData reconciles freshly extracted data before it is saved.
+func ReconcileReceiptData(data *ReceiptData) models.Reconciliation {
+	items := make([]models.ReceiptItem, 0, len(data.Items))
+	for _, item := range data.Items {
+		quantity := mapFloat(item, "quantity")
+		if quantity == 0 {
+			quantity = 1
+		}
+		items = append(items, models.ReceiptItem{
+			Name:       ItemName(item),
+			Quantity:   quantity,
+			UnitPrice:  mapFloat(item, "unitPrice"),
+			TotalPrice: mapFloat(item, "totalPrice"),
+			Discount:   mapFloat(item, "discount"),
+		})
+	}
+	return ReconcileItems(data.Total, data.Discount, items)
+}
+
+// ApplyReconciliation stores the outcome of ReconcileItems on the receipt.
+func ApplyReconciliation(receipt *models.Receipt, items []models.ReceiptItem) models.Reconciliation {
+	result := ReconcileItems(receipt.Total, receipt.Discount, items)
+	receipt.ReconciliationStatus = result.Status
+	receipt.ReconciliationWarnings = result.Warnings
+	return result
+}
+
+func checkLine(index int, item models.ReceiptItem) *models.ReconciliationWarning {
+	if item.TotalPrice < 0 {
+		return nil
+	}
+
+	if item.TotalPrice == 0 {
+		return &models.ReconciliationWarning{
+			Code:    models.WarningMissingPrice,
+			Message: fmt.Sprintf("%s has no price", item.Name),
+			Item:    &index,
+		}
+	}
+
+	if item.UnitPrice <= 0 || item.Quantity <= 0 {
+		return nil
+	}
+
+	expected := RoundCents(item.Quantity*item.UnitPrice - item.Discount)
+	if math.Abs(expected-item.TotalPrice) <= lineTolerance {
+		return nil
+	}
+
+	return &models.ReconciliationWarning{
+		Code: models.WarningLineTotalMismatch,
+		Message: fmt.Sprintf("%s: %g × %.2f comes to %.2f, but the line total is %.2f",
+			item.Name, item.Quantity, item.UnitPrice, expected, item.TotalPrice),
+		Item:     &index,
+		Expected: expected,
+		Actual:   item.TotalPrice,
+	}
+}
+
+func totalMismatchMessage(difference float64) string {
+	if difference > 0 {
+		return fmt.Sprintf("the items add up to %.2f less than the total; a line may be missing or misread", difference)
+	}
+	return fmt.Sprintf("the items add up to %.2f more than the total; a price may be misread or a discount missing", -difference)
+}
+
+// RoundCents rounds a value in reais to whole centavos.
+func RoundCents(value float64) float64 {
+	return math.Round(value*100) / 100
+}
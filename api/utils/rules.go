@@ -0,0 +1,140 @@
+package utils
+
+import (
+	"buybuddy-api/models"
+	"regexp"
+	"sort"
+)
+
+// RuleSet is a user's enabled normalization rules compiled in evaluation
+// order.
+type RuleSet struct {
+	rules    []models.NormalizationRule
+	patterns []*regexp.Regexp
+}
+
+// CompileRulePattern compiles a rule pattern the way rules are matched.
+func CompileRulePattern(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile("(?i)" + pattern)
+}
+
+// NewRuleSet orders the rules by position and ID. Disabled rules and rules
+// whose pattern does not compile are left out.
+func NewRuleSet(rules []models.NormalizationRule) *RuleSet {
+	ordered := make([]models.NormalizationRule, len(rules))
+	copy(ordered, rules)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if ordered[i].Position != ordered[j].Position {
+			return ordered[i].Position < ordered[j].Position
+		}
+		return ordered[i].ID < ordered[j].ID
+	})
+
+	set := &RuleSet{}
+	for _, rule := range ordered {
+		if !rule.Enabled {
+			continue
+		}
+		pattern, err := CompileRulePattern(rule.Pattern)
+		if err != nil {
+			continue
+		}
+		set.rules = append(set.rules, rule)
+		set.patterns = append(set.patterns, pattern)
+	}
+	return set
+}
+
+// Match returns the first rule whose pattern matches the raw name.
+func (s *RuleSet) Match(rawName string) *models.NormalizationRule {
+	if s == nil || rawName == "" {
+		return nil
+	}
+	for i, pattern := range s.patterns {
+		if pattern.MatchString(rawName) {
+			return &s.rules[i]
+		}
+	}
+	return nil
+}
+
+// ApplyToData rewrites the extracted items the rules match. The rule's name
+// and category become the first options, ahead of the model's, with full
+// confidence, and the item's ruleId records which rule applied. It returns
+// the number of items changed.
+func (s *RuleSet) ApplyToData(data *ReceiptData) int {
+	changed := 0
+	for _, item := range data.Items {
+		rawName := mapString(item, "rawName")
+		if rawName == "" {
+			rawName = ItemName(item)
+		}
+		rule := s.Match(rawName)
+		if rule == nil {
+			continue
+		}
+
+		if rule.Name != "" {
+			item["nameOptions"] = prependOption(nameOptions(item), rule.Name)
+			delete(item, "name")
+			setConfidence(item, "name", 1)
+		}
+		if rule.Brand != "" {
+			item["brand"] = rule.Brand
+		}
+		if rule.Category != "" {
+			option := map[string]interface{}{"category": rule.Category, "subcategory": rule.Subcategory}
+			options := []interface{}{option}
+			if existing, ok := item["categoryOptions"].([]interface{}); ok {
+				for _, other := range existing {
+					if otherMap, ok := other.(map[string]interface{}); ok &&
+						mapString(otherMap, "category") == rule.Category && mapString(otherMap, "subcategory") == rule.Subcategory {
+						continue
+					}
+					options = append(options, other)
+				}
+			}
+			item["categoryOptions"] = options
+			setConfidence(item, "category", 1)
+		}
+		item["ruleId"] = rule.ID
+		changed++
+	}
+	return changed
+}
+
+func nameOptions(item map[string]interface{}) []string {
+	switch options := item["nameOptions"].(type) {
+	case []string:
+		return options
+	case []interface{}:
+		names := make([]string, 0, len(options))
+		for _, option := range options {
+			if name, ok := option.(string); ok {
+				names = append(names, name)
+			}
+		}
+		return names
+	}
+	return nil
+}
+
+// setConfidence marks how sure extraction is of a field of the item.
+func setConfidence(item map[string]interface{}, field string, value float64) {
+	confidence, ok := item["confidence"].(map[string]interface{})
+	if !ok {
+		confidence = make(map[string]interface{})
+		item["confidence"] = confidence
+	}
+	confidence[field] = value
+}
+
+func prependOption(options []string, first string) []string {
+	result := []string{first}
+	for _, option := range options {
+		if option != first {
+			result = append(result, option)
+		}
+	}
+	return result
+}
@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"buybuddy-api/models"
+	"math"
+)
+
+// ShareTolerance absorbs float error in shares that add up to a whole item.
+const ShareTolerance = 1e-6
+
+// ApplySplits narrows receipts to userID's part of them for spending
+// queries: on the user's own receipts, items lose the shares split off to
+// others; on receipts split with the user, only the user's share of the
+// split items is left. splits are the accepted splits of the receipts;
+// receipts without any are left alone.
+func ApplySplits(userID string, receipts []models.Receipt, splits []models.ReceiptItemSplit) {
+	if len(splits) == 0 {
+		return
+	}
+
+	// The share of each split item that is split off, and the part of it
+	// that went to userID.
+	splitOff := make(map[uint]float64)
+	mine := make(map[uint]float64)
+	for _, split := range splits {
+		splitOff[split.ItemID] += split.Share
+		if split.UserID == userID {
+			mine[split.ItemID] += split.Share
+		}
+	}
+
+	for i := range receipts {
+		receipt := &receipts[i]
+		owned := receipt.UserID == userID
+
+		var full, kept float64
+		items := receipt.Items[:0]
+		for _, item := range receipt.Items {
+			full += item.TotalPrice
+
+			share := mine[item.ID]
+			if owned {
+				share = 1 - splitOff[item.ID]
+			}
+			if share < ShareTolerance {
+				continue
+			}
+			if share < 1-ShareTolerance {
+				scaleItem(&item, share)
+			}
+			kept += item.TotalPrice
+			items = append(items, item)
+		}
+		receipt.Items = items
+
+		if full > 0 && math.Abs(full-kept) >= 0.005 {
+			ratio := kept / full
+			receipt.Total = RoundCents(receipt.Total * ratio)
+			receipt.Discount = RoundCents(receipt.Discount * ratio)
+			receipt.TaxAmount = RoundCents(receipt.TaxAmount * ratio)
+		}
+	}
+}
+
+func scaleItem(item *models.ReceiptItem, share float64) {
+	item.Quantity *= share
+	item.TotalPrice = RoundCents(item.TotalPrice * share)
+	item.Discount = RoundCents(item.Discount * share)
+	item.TaxAmount = RoundCents(item.TaxAmount * share)
+}
@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+)
+
+const ThumbnailSize = 320
+
+var ErrThumbnailUnsupported = errors.New("thumbnails are only generated for JPEG, PNG and GIF images")
+
+// GenerateThumbnail scales an image down so its longest side is at most
+// maxSize pixels and encodes it as JPEG. Each output pixel is the average of
+// the source pixels it covers, which keeps small receipt text legible.
+func GenerateThumbnail(data []byte, maxSize int) ([]byte, error) {
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrThumbnailUnsupported
+	}
+
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width == 0 || height == 0 {
+		return nil, ErrThumbnailUnsupported
+	}
+
+	dstWidth, dstHeight := width, height
+	if width > maxSize || height > maxSize {
+		if width >= height {
+			dstWidth = maxSize
+			dstHeight = max(1, height*maxSize/width)
+		} else {
+			dstHeight = maxSize
+			dstWidth = max(1, width*maxSize/height)
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < dstHeight; y++ {
+		y0 := bounds.Min.Y + y*height/dstHeight
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*height/dstHeight)
+		for x := 0; x < dstWidth; x++ {
+			x0 := bounds.Min.X + x*width/dstWidth
+			x1 := max(x0+1, bounds.Min.X+(x+1)*width/dstWidth)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r += uint64(cr)
+					g += uint64(cg)
+					b += uint64(cb)
+					a += uint64(ca)
+					n++
+				}
+			}
+
+			offset := dst.PixOffset(x, y)
+			dst.Pix[offset] = uint8(r / n >> 8)
+			dst.Pix[offset+1] = uint8(g / n >> 8)
+			dst.Pix[offset+2] = uint8(b / n >> 8)
+			dst.Pix[offset+3] = uint8(a / n >> 8)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
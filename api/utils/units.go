@@ -0,0 +1,22 @@
+package utils
+
+import (
+	"buybuddy-api/models"
+	"buybuddy-api/units"
+)
+
+// MeasureItems sets each item's package size and price per standard unit.
+// The size is read from the raw name, as printed, or else the name.
+func MeasureItems(items []models.ReceiptItem) {
+	for i := range items {
+		name := items[i].RawName
+		if _, ok := units.ParseSize(name); !ok {
+			name = items[i].Name
+		}
+
+		m := units.Measure(name, items[i].Unit, items[i].Quantity, items[i].TotalPrice)
+		items[i].PackageSize = m.Size
+		items[i].SizeUnit = m.Unit
+		items[i].PricePerUnit = m.PricePerUnit
+	}
+}